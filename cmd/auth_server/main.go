@@ -2,42 +2,117 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/multitracer"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/kwinso/medods-test-task/internal"
 	"github.com/kwinso/medods-test-task/internal/config"
 	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/metrics"
+	"github.com/kwinso/medods-test-task/internal/tracing"
 )
 
 func main() {
-	logger := log.New(os.Stdout, "[medods-auth] ", log.LstdFlags)
+	logger := logging.New(os.Stdout, slog.LevelInfo)
 
 	cfg, err := config.Load()
 	if err != nil {
-		logger.Fatal(err)
+		fatal(logger, "Failed to load config", err)
 	}
 
-	ctx := context.Background()
-	conn, err := pgx.Connect(ctx, cfg.DatabaseURL)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TraceExporter)
+	if err != nil {
+		fatal(logger, "Failed to set up tracing", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Error("Failed to flush traces", logging.Err(err))
+		}
+	}()
+
+	m := metrics.New()
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.DatabaseURL)
 	if err != nil {
-		logger.Fatal(err)
+		fatal(logger, "Failed to parse database URL", err)
 	}
-	defer conn.Close(ctx)
+	poolConfig.ConnConfig.Tracer = multitracer.New(metrics.NewQueryTracer(m), tracing.NewQueryTracer())
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		fatal(logger, "Failed to connect to database", err)
+	}
+	defer pool.Close()
 
 	if cfg.MigrationsSource != "" {
 		run, err := db.ApplyMigrations(cfg.DatabaseURL, cfg.MigrationsSource)
 		if err != nil {
-			logger.Fatal("Failed to apply migrations: ", err)
+			fatal(logger, "Failed to apply migrations", err)
 		}
 		if run {
-			logger.Println("Applied migrations")
+			logger.Info("Applied migrations")
 		}
 	}
 
-	logger.Printf("Starting server on port %d\n", cfg.Port)
-	if err := internal.ServeWithConfig(*cfg, conn, logger); err != nil {
-		log.Fatal(err)
+	settings := config.NewStore(cfg)
+	go reloadConfig(ctx, settings, logger)
+
+	logger.Info("Starting server", "port", cfg.Port)
+	if err := internal.ServeWithConfig(ctx, settings, pool, m, logger); err != nil {
+		fatal(logger, "Server stopped", err)
+	}
+}
+
+// reloadConfig reloads the config on SIGHUP and every ReloadInterval until ctx is done.
+// An invalid config is rejected and the current one is kept
+func reloadConfig(ctx context.Context, settings *config.Store, logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval := settings.Get().ReloadInterval; interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var lastIgnored []string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		case <-tick:
+		}
+
+		applied, ignored, err := settings.Reload()
+		if err != nil {
+			logger.Error("Failed to reload config, keeping the current one", logging.Err(err))
+			continue
+		}
+		// periodic reloads would repeat the same warning otherwise
+		if len(ignored) > 0 && !slices.Equal(ignored, lastIgnored) {
+			logger.Warn("Some changed settings require a restart and were not applied", "settings", ignored)
+		}
+		lastIgnored = ignored
+		if len(applied) > 0 {
+			logger.Info("Reloaded config", "applied", applied)
+		}
 	}
 }
+
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
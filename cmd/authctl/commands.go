@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/services"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+var (
+	errGUIDRequired  = errors.New("GUID argument is required")
+	errInvalidGUID   = errors.New("GUID argument is not a valid GUID")
+	errInvalidSteps  = errors.New("steps must be positive")
+	errInvalidLimit  = fmt.Errorf("limit must be between 1 and %d", math.MaxInt32)
+	errReplayPartial = errors.New("some reports could not be delivered")
+	errKeysOutput    = errors.New("either -out <file> or -print is required, the keys are secret")
+	errMemoryStorage = errors.New("sessions in memory storage live in the server process and can't be managed by authctl")
+)
+
+// signingKeySize matches the output of HS512, shorter keys weaken the signature
+const signingKeySize = 64
+
+// legacyKeyID is used for the rotated out key if it had no ID. Tokens without `kid` are checked against every key anyway
+const legacyKeyID = "legacy"
+
+func migrateUp(_ context.Context, args []string) error {
+	if err := parseFlags("migrate up", args); err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	applied, err := db.ApplyMigrations(cfg.DatabaseURL, cfg.MigrationsSource)
+	if err != nil {
+		return err
+	}
+	if applied {
+		fmt.Println("migrations applied")
+	} else {
+		fmt.Println("no pending migrations")
+	}
+	return nil
+}
+
+func migrateDown(_ context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+	steps := fs.Int("steps", 1, "number of migrations to roll back")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *steps <= 0 {
+		return errInvalidSteps
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	if err := db.RollbackMigrations(cfg.DatabaseURL, cfg.MigrationsSource, *steps); err != nil {
+		return err
+	}
+	fmt.Printf("rolled back %d migration(s)\n", *steps)
+	return nil
+}
+
+func migrateStatus(ctx context.Context, args []string) error {
+	if err := parseFlags("migrate status", args); err != nil {
+		return err
+	}
+	a, err := newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	latest, err := db.LatestMigrationVersion()
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := db.MigrationVersion(ctx, a.pool)
+	if errors.Is(err, db.ErrNoMigrationsApplied) {
+		fmt.Printf("applied: none\nlatest: %d\n", latest)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("applied: %d\nlatest: %d\n", version, latest)
+	if dirty {
+		fmt.Printf("migration %d failed halfway and must be fixed manually\n", version)
+	}
+	return nil
+}
+
+func sessionsList(ctx context.Context, args []string) error {
+	guid, err := parseGUID("sessions list", args)
+	if err != nil {
+		return err
+	}
+	a, err := newSessionsApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	sessions, err := a.auth.ListSessions(ctx, guid)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tIP\tUSER AGENT\tAMR\tCREATED AT\tREFRESHED AT")
+	for _, session := range sessions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", session.ID, session.IpAddress, session.UserAgent,
+			strings.Join(session.Amr, ","), session.CreatedAt.Format(time.RFC3339), session.RefreshedAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func sessionsRevoke(ctx context.Context, args []string) error {
+	guid, err := parseGUID("sessions revoke", args)
+	if err != nil {
+		return err
+	}
+	a, err := newSessionsApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	// sessions may be deleted even if revoking their access tokens failed
+	revoked, err := a.auth.RevokeSessions(ctx, guid)
+	if revoked > 0 || err == nil {
+		fmt.Printf("revoked %d session(s)\n", revoked)
+	}
+	return err
+}
+
+func tokenMint(ctx context.Context, args []string) error {
+	guid, err := parseGUID("token mint", args)
+	if err != nil {
+		return err
+	}
+	a, err := newSessionsApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	tokenPair, err := a.auth.AuthorizeByGUID(ctx, guid, []string{tokens.AMRExternal}, "authctl", netip.MustParseAddr("127.0.0.1"))
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(api.TokenPair{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokens.EncodeRefreshTokenToBase64(tokenPair.RefreshToken),
+	})
+}
+
+func keysRotate(_ context.Context, args []string) error {
+	fs := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	out := fs.String("out", "", "write the env vars to a new file readable only by the owner")
+	printKeys := fs.Bool("print", false, "print the env vars with the keys in plaintext")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if (*out == "") == !*printKeys { // exactly one of them
+		return errKeysOutput
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	key := make([]byte, signingKeySize)
+	kid := make([]byte, 4)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if _, err := rand.Read(kid); err != nil {
+		return err
+	}
+
+	previousKeys := make(map[string]string, len(cfg.JwtPreviousKeys)+1)
+	for previousKid, previousKey := range cfg.JwtPreviousKeys {
+		previousKeys[previousKid] = previousKey
+	}
+	currentKid := cfg.JwtKeyID
+	if currentKid == "" {
+		currentKid = legacyKeyID
+	}
+	previousKeys[currentKid] = cfg.JwtKey
+
+	pairs := make([]string, 0, len(previousKeys))
+	for previousKid, previousKey := range previousKeys {
+		pairs = append(pairs, previousKid+":"+previousKey)
+	}
+	slices.Sort(pairs)
+
+	env := fmt.Sprintf("AUTH_JWT_KEY=%s\nAUTH_JWT_KEY_ID=%s\nAUTH_JWT_PREVIOUS_KEYS=%s\n",
+		base64.RawURLEncoding.EncodeToString(key), hex.EncodeToString(kid), strings.Join(pairs, ","))
+	notice := fmt.Sprintf("# tokens signed with the old keys stay valid for up to %s, remove them from AUTH_JWT_PREVIOUS_KEYS after that\n",
+		cfg.TokenTTL+cfg.JwtLeeway)
+
+	if *printKeys {
+		fmt.Print(notice + env)
+		return nil
+	}
+
+	// an existing file is never overwritten, it may hold the only copy of the current keys
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(notice + env); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%swrote AUTH_JWT_KEY, AUTH_JWT_KEY_ID and AUTH_JWT_PREVIOUS_KEYS to %s\n", notice, *out)
+	return nil
+}
+
+func webhooksList(ctx context.Context, args []string) error {
+	limit, err := parseLimit("webhooks list", args)
+	if err != nil {
+		return err
+	}
+	a, err := newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	deadLetters, err := a.deadLetters.List(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tGUID\tAUTH ID\tATTEMPTS\tCREATED AT\tERROR")
+	for _, deadLetter := range deadLetters {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", deadLetter.ID, deadLetter.Guid, deadLetter.AuthID,
+			deadLetter.Attempts, deadLetter.CreatedAt.Format(time.RFC3339), deadLetter.Error)
+	}
+	return w.Flush()
+}
+
+func webhooksReplay(ctx context.Context, args []string) error {
+	limit, err := parseLimit("webhooks replay", args)
+	if err != nil {
+		return err
+	}
+	a, err := newApp(ctx)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	delivered, failed, err := a.deadLetters.Replay(ctx, limit)
+	fmt.Printf("delivered %d report(s), %d failed\n", delivered, failed)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return errReplayPartial
+	}
+	return nil
+}
+
+func configValidate(_ context.Context, args []string) error {
+	if err := parseFlags("config validate", args); err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if _, err := services.NewAuthenticator(*cfg); err != nil {
+		return fmt.Errorf("authenticator: %w", err)
+	}
+
+	fmt.Println("config is valid")
+	return nil
+}
+
+// parseFlags rejects arguments for commands that don't take any
+func parseFlags(name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+func parseGUID(name string, args []string) (string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 || fs.Arg(0) == "" {
+		return "", errGUIDRequired
+	}
+	if !api.IsValidGUID(fs.Arg(0)) {
+		return "", errInvalidGUID
+	}
+	return fs.Arg(0), nil
+}
+
+func parseLimit(name string, args []string) (int32, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	limit := fs.Int("limit", 100, "maximum number of reports")
+	if err := fs.Parse(args); err != nil {
+		return 0, err
+	}
+	if *limit <= 0 || *limit > math.MaxInt32 {
+		return 0, errInvalidLimit
+	}
+	return int32(*limit), nil
+}
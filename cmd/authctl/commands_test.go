@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kwinso/medods-test-task/internal/config"
+)
+
+func setTestEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("AUTH_WEBHOOK_URL", "http://localhost/webhook")
+	t.Setenv("AUTH_DB_URL", "postgres://localhost/auth")
+	t.Setenv("AUTH_JWT_KEY", "current-key")
+	t.Setenv("AUTH_JWT_KEY_ID", "current")
+	t.Setenv("AUTH_REFRESH_TOKEN_PEPPER", "pepper")
+	t.Setenv("AUTH_AUTHENTICATOR", config.AuthenticatorNone)
+	t.Setenv("AUTH_ALLOW_INSECURE_AUTHENTICATOR", "true")
+}
+
+func TestKeysRotateWritesFile(t *testing.T) {
+	setTestEnv(t)
+	out := filepath.Join(t.TempDir(), "keys.env")
+
+	if err := keysRotate(context.Background(), []string{"-out", out}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("expected the file to be readable only by the owner, got %s", perm)
+	}
+
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		if name, value, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(line, "#") {
+			env[name] = value
+		}
+	}
+	key, err := base64.RawURLEncoding.DecodeString(env["AUTH_JWT_KEY"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != signingKeySize {
+		t.Errorf("expected a %d byte key, got %d", signingKeySize, len(key))
+	}
+	if env["AUTH_JWT_PREVIOUS_KEYS"] != "current:current-key" {
+		t.Errorf("expected the current key to be moved to the previous keys, got %q", env["AUTH_JWT_PREVIOUS_KEYS"])
+	}
+
+	if err := keysRotate(context.Background(), []string{"-out", out}); !errors.Is(err, os.ErrExist) {
+		t.Errorf("expected the existing file to be kept, got %v", err)
+	}
+}
+
+func TestKeysRotateRequiresOutput(t *testing.T) {
+	setTestEnv(t)
+	out := filepath.Join(t.TempDir(), "keys.env")
+
+	for name, args := range map[string][]string{
+		"no output":   nil,
+		"both output": {"-out", out, "-print"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := keysRotate(context.Background(), args); !errors.Is(err, errKeysOutput) {
+				t.Errorf("expected %v, got %v", errKeysOutput, err)
+			}
+		})
+	}
+}
+
+func TestSessionCommandsRejectMemoryStorage(t *testing.T) {
+	setTestEnv(t)
+	t.Setenv("AUTH_SESSION_STORAGE", config.SessionStorageMemory)
+
+	for name, run := range map[string]command{
+		"sessions list":   sessionsList,
+		"sessions revoke": sessionsRevoke,
+		"token mint":      tokenMint,
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := run(context.Background(), []string{"12345678-1234-1234-1234-123456789012"})
+			if !errors.Is(err, errMemoryStorage) {
+				t.Errorf("expected %v, got %v", errMemoryStorage, err)
+			}
+		})
+	}
+}
+
+func TestParseGUID(t *testing.T) {
+	cases := map[string]struct {
+		args     []string
+		expected error
+	}{
+		"valid":       {args: []string{"12345678-1234-1234-1234-123456789012"}},
+		"missing":     {expected: errGUIDRequired},
+		"empty":       {args: []string{""}, expected: errGUIDRequired},
+		"two":         {args: []string{"12345678-1234-1234-1234-123456789012", "87654321-4321-4321-4321-210987654321"}, expected: errGUIDRequired},
+		"not a guid":  {args: []string{"not-a-guid"}, expected: errInvalidGUID},
+		"sql pattern": {args: []string{"%"}, expected: errInvalidGUID},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			guid, err := parseGUID("sessions list", tc.args)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, err)
+			}
+			if tc.expected == nil && guid != tc.args[0] {
+				t.Errorf("expected %s, got %s", tc.args[0], guid)
+			}
+		})
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	cases := map[string]struct {
+		args     []string
+		expected int32
+		err      error
+	}{
+		"default":      {expected: 100},
+		"max":          {args: []string{"-limit", "2147483647"}, expected: math.MaxInt32},
+		"zero":         {args: []string{"-limit", "0"}, err: errInvalidLimit},
+		"negative":     {args: []string{"-limit", "-1"}, err: errInvalidLimit},
+		"out of int32": {args: []string{"-limit", "2147483648"}, err: errInvalidLimit},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			limit, err := parseLimit("webhooks list", tc.args)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected %v, got %v", tc.err, err)
+			}
+			if limit != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, limit)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+// authctl operates the auth service: migrations, sessions, signing keys and webhook dead letters.
+// It reads the same AUTH_* env vars as the server.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/services"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+const usage = `Usage: authctl <command> [arguments]
+
+Commands:
+  migrate up                  apply all pending migrations
+  migrate down [-steps n]     roll back the last n migrations (1 by default)
+  migrate status              show the applied and the latest migration versions
+  sessions list <guid>        list the sessions of the user
+  sessions revoke <guid>      delete all sessions of the user and revoke their access tokens
+  token mint <guid>           issue a token pair for the user, bypassing the authenticator
+  keys rotate -out <file>     generate a new signing key and write the env vars to deploy it to a new file
+  keys rotate -print          the same, but print the env vars with the keys to stdout
+  webhooks list [-limit n]    list dead-lettered webhook reports
+  webhooks replay [-limit n]  deliver dead-lettered webhook reports again
+  config validate             load the config and the authenticator and report errors
+`
+
+type command func(ctx context.Context, args []string) error
+
+var commands = map[string]map[string]command{
+	"migrate": {
+		"up":     migrateUp,
+		"down":   migrateDown,
+		"status": migrateStatus,
+	},
+	"sessions": {
+		"list":   sessionsList,
+		"revoke": sessionsRevoke,
+	},
+	"token": {
+		"mint": tokenMint,
+	},
+	"keys": {
+		"rotate": keysRotate,
+	},
+	"webhooks": {
+		"list":   webhooksList,
+		"replay": webhooksReplay,
+	},
+	"config": {
+		"validate": configValidate,
+	},
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	run, ok := commands[os.Args[1]][os.Args[2]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1]+" "+os.Args[2], usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[3:]); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// app holds the services the commands operate with
+type app struct {
+	cfg           *config.Config
+	pool          *pgxpool.Pool
+	closeAuthRepo func() error
+	auth          services.AuthService
+	deadLetters   services.DeadLetterService
+}
+
+func newApp(ctx context.Context) (*app, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.New(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := config.NewStore(cfg)
+	clock := tokens.NewSystemClock()
+	authRepo, closeAuthRepo, err := repositories.NewAuthRepositoryForStorage(settings, pool, clock)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	logger := logging.New(os.Stderr, slog.LevelWarn)
+
+	webhookReportsService := services.NewWebhookReportsService(settings)
+	deadLettersRepo := repositories.NewPgxDeadLettersRepository(pool)
+
+	rolesService := services.NewRolesService(repositories.NewPgxRolesRepository(pool))
+	// revocations are picked up by the running servers through the database, no need to listen for them here
+	revocationService := services.NewRevocationService(repositories.NewPgxRevocationsRepository(pool), nil, settings,
+		clock, logger)
+	authService := services.NewAuthService(authRepo, rolesService, revocationService,
+		&webhookReportsService, logger, settings, clock, tokens.NewSystemEntropy())
+
+	return &app{
+		cfg:           cfg,
+		pool:          pool,
+		closeAuthRepo: closeAuthRepo,
+		auth:          authService,
+		deadLetters:   services.NewDeadLetterService(deadLettersRepo, &webhookReportsService),
+	}, nil
+}
+
+// newSessionsApp creates the app for the commands that work with sessions. Sessions in memory storage can't be
+// reached from another process, so it's rejected instead of operating on an empty storage.
+func newSessionsApp(ctx context.Context) (*app, error) {
+	a, err := newApp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if a.cfg.SessionStorage == config.SessionStorageMemory {
+		a.Close()
+		return nil, errMemoryStorage
+	}
+	return a, nil
+}
+
+func (a *app) Close() {
+	_ = a.closeAuthRepo()
+	a.pool.Close()
+}
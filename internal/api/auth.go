@@ -2,7 +2,10 @@ package api
 
 type LoginRequest struct {
 	// GUID for the user that is logging in
-	GUID string `json:"guid" binding:"required" validate:"guid" example:"12345678-1234-1234-1234-123456789012"`
+	GUID string `json:"guid" binding:"required,guid" example:"12345678-1234-1234-1234-123456789012"`
+	// Assertion is a proof of identity for the GUID, e.g. a signed JWT from the patient registry.
+	// Whether it's required depends on the authenticator the server is configured with.
+	Assertion string `json:"assertion,omitempty" example:"eyJhbGciOiJSUzI1NiJ9..."`
 }
 
 type RefreshRequest struct {
@@ -19,8 +22,73 @@ type TokenPair struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// CookieSessionResponse is returned instead of TokenPair when the tokens are set in cookies
+type CookieSessionResponse struct {
+	// CSRFToken must be sent in the X-CSRF-Token header with state-changing requests. It's also set in the csrf_token cookie
+	CSRFToken string `json:"csrf_token" example:"3q2-7wAAAAAAAAAAAAAAAA"`
+}
+
 // GetMeResponse holds a response for the /me route
 // @Description	Contains the GUID for the authenticated user
 type GetMeResponse struct {
 	Guid string `json:"guid" example:"12345678-1234-1234-1234-123456789012"`
 }
+
+type PasswordLoginRequest struct {
+	Username string `json:"username" binding:"required,max=255" example:"j.doe"`
+	Password string `json:"password" binding:"required,max=1024" example:"correct horse battery staple"`
+}
+
+type RegisterCredentialsRequest struct {
+	// Username used for password login. Must be unique
+	Username string `json:"username" binding:"required,min=3,max=255" example:"j.doe"`
+	Password string `json:"password" binding:"required,min=12,max=1024" example:"correct horse battery staple"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required,max=1024" example:"correct horse battery staple"`
+	NewPassword string `json:"new_password" binding:"required,min=12,max=1024" example:"another horse battery staple"`
+}
+
+// MFAChallengeResponse is returned instead of the token pair when the user has MFA enabled
+// @Description	The first factor is verified, complete the login with /login/mfa
+type MFAChallengeResponse struct {
+	MFARequired bool `json:"mfa_required" example:"true"`
+	// MFAToken is a short-lived token that must be sent to /login/mfa together with the second factor
+	MFAToken string `json:"mfa_token"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	// Code from the authenticator app. Either code or recovery_code is required
+	Code string `json:"code" binding:"required_without=RecoveryCode" example:"123456"`
+	// One of the recovery codes given when TOTP was enabled. Each code can be used once
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code" example:"abcde-fghij"`
+}
+
+type TOTPEnrollmentResponse struct {
+	// Secret is a base32 TOTP secret for manual entry into an authenticator app
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+	// URI is an otpauth:// URI that can be shown as a QR code
+	URI string `json:"uri" example:"otpauth://totp/MEDODS:12345678-1234-1234-1234-123456789012?secret=JBSWY3DPEHPK3PXP&issuer=MEDODS"`
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+	// RecoveryCodes are shown only once. Each can be used instead of a TOTP code a single time
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Role is a named set of scopes that can be assigned to users
+type Role struct {
+	Name   string   `json:"name" example:"clinician"`
+	Scopes []string `json:"scopes" example:"reports:read,patients:read"`
+}
+
+type SaveRoleRequest struct {
+	// Scopes granted by the role. Replace the current scopes of the role
+	Scopes []string `json:"scopes" binding:"max=100,dive,scope" example:"reports:read,patients:read"`
+}
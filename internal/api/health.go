@@ -0,0 +1,21 @@
+package api
+
+// Health statuses of the service and its components
+const (
+	HealthStatusUp   = "up"
+	HealthStatusDown = "down"
+)
+
+// HealthResponse describes the health of the service
+// @Description	Health of the service and its components
+type HealthResponse struct {
+	Status string `json:"status" example:"up"`
+	// Components are only reported by the readiness check
+	Components map[string]ComponentHealth `json:"components,omitempty"`
+}
+
+// ComponentHealth describes the health of a single dependency
+type ComponentHealth struct {
+	Status string `json:"status" example:"up"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,74 @@
+package api
+
+import "net/http"
+
+// ProblemContentType is the media type of error responses (RFC 7807)
+const ProblemContentType = "application/problem+json"
+
+// Stable error codes put into Problem.Code. Clients should rely on them instead of the status or the detail message
+const (
+	CodeInternalError            = "internal_error"
+	CodeNotFound                 = "not_found"
+	CodeMalformedRequest         = "malformed_request"
+	CodeValidationFailed         = "validation_failed"
+	CodeMissingAccessToken       = "missing_access_token"
+	CodeCSRFTokenMismatch        = "csrf_token_mismatch"
+	CodeInvalidAccessToken       = "invalid_access_token"
+	CodeSessionExpired           = "session_expired"
+	CodeSessionRevokedUAMismatch = "session_revoked_ua_mismatch"
+	CodeInvalidRefreshToken      = "invalid_refresh_token"
+	CodeIdentityNotVerified      = "identity_not_verified"
+	CodeInvalidCredentials       = "invalid_credentials"
+	CodeCredentialsExist         = "credentials_exist"
+	CodeLoginLocked              = "login_locked"
+	CodeInvalidMFAChallenge      = "invalid_mfa_challenge"
+	CodeInvalidMFACode           = "invalid_mfa_code"
+	CodeMFALocked                = "mfa_locked"
+	CodeMFANotEnrolled           = "mfa_not_enrolled"
+	CodeMFAAlreadyEnabled        = "mfa_already_enabled"
+	CodeMFARequired              = "mfa_required"
+	CodeInsufficientScope        = "insufficient_scope"
+	CodeRoleNotFound             = "role_not_found"
+)
+
+// Problem is an RFC 7807 problem details error response
+// @Description	RFC 7807 problem details with a stable error code
+type Problem struct {
+	// Always `about:blank`, the problem is identified by Code
+	Type string `json:"type" example:"about:blank"`
+	// HTTP status text
+	Title  string `json:"title" example:"Unauthorized"`
+	Status int    `json:"status" example:"401"`
+	// Human-readable explanation, it may change and must not be parsed
+	Detail string `json:"detail,omitempty" example:"The session is expired or was logged out"`
+	// Path of the request
+	Instance string `json:"instance,omitempty" example:"/v1/refresh"`
+	// Stable machine-readable error code
+	Code string `json:"code" example:"session_expired"`
+	// Invalid fields, only set for `validation_failed`
+	Errors []FieldError `json:"errors,omitempty"`
+	// Scopes that are required by the route, but not granted to the token. Only set for `insufficient_scope`
+	MissingScopes []string `json:"missing_scopes,omitempty" example:"auth:admin"`
+}
+
+// FieldError describes a single invalid field of the request
+// @Description	Invalid request field
+type FieldError struct {
+	// JSON name of the field, or the name of the route param
+	Field string `json:"field" example:"guid"`
+	// The validation rule that failed
+	Rule string `json:"rule" example:"required"`
+	// Human-readable explanation, it may change and must not be parsed
+	Message string `json:"message" example:"is required"`
+}
+
+// NewProblem creates a problem with the given status and code
+func NewProblem(status int, code, detail string) Problem {
+	return Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
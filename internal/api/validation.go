@@ -1,15 +1,50 @@
 package api
 
 import (
+	"reflect"
+	"regexp"
+	"strings"
+
 	"github.com/beevik/guid"
 	"github.com/go-playground/validator/v10"
 )
 
+var (
+	scopePattern    = regexp.MustCompile(`^[A-Za-z0-9_.:/-]{1,128}$`)
+	roleNamePattern = regexp.MustCompile(`^[a-z0-9_.:-]{1,64}$`)
+)
+
 var validGUID = func(fl validator.FieldLevel) bool {
 	_, err := guid.ParseString(fl.Field().String())
 	return err == nil
 }
 
+var validScope = func(fl validator.FieldLevel) bool {
+	return scopePattern.MatchString(fl.Field().String())
+}
+
+// IsValidGUID checks the GUID format, e.g. for GUIDs in route params
+func IsValidGUID(s string) bool {
+	_, err := guid.ParseString(s)
+	return err == nil
+}
+
+// IsValidRoleName checks that the role name is short and only consists of lowercase letters, digits and `_.:-`
+func IsValidRoleName(s string) bool {
+	return roleNamePattern.MatchString(s)
+}
+
+// jsonFieldName names the fields in validation errors by their JSON names, so they match the request body
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" || name == "" {
+		return field.Name
+	}
+	return name
+}
+
 func RegisterCustomValidators(v *validator.Validate) {
 	_ = v.RegisterValidation("guid", validGUID)
+	_ = v.RegisterValidation("scope", validScope)
+	v.RegisterTagNameFunc(jsonFieldName)
 }
@@ -1,48 +1,181 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"github.com/kwinso/medods-test-task/internal/handlers/middleware"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/kwinso/medods-test-task/docs"
 	"github.com/kwinso/medods-test-task/internal/api"
 	"github.com/kwinso/medods-test-task/internal/config"
 	"github.com/kwinso/medods-test-task/internal/db"
 	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/grpcapi"
 	"github.com/kwinso/medods-test-task/internal/handlers"
+	"github.com/kwinso/medods-test-task/internal/handlers/problems"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/metrics"
+	"github.com/kwinso/medods-test-task/internal/passwords"
 	"github.com/kwinso/medods-test-task/internal/services"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/kwinso/medods-test-task/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"google.golang.org/grpc"
 )
 
-func newRouter(cfg config.Config, db db.DBTX, logger *log.Logger) *gin.Engine {
-	router := gin.Default()
+// app serves the same services over HTTP and gRPC
+type app struct {
+	router     *gin.Engine
+	grpcServer *grpc.Server
+}
+
+// newApp builds the app. Background workers are started with ctx and stop when it's done.
+// listener may be nil, in which case revocations from other instances are only picked up on start.
+// Readiness fails once shutdown is closed. Sessions and tokens expire by the time of clock, secrets are generated from entropy.
+func newApp(ctx context.Context, settings *config.Store, db db.DBTX, listener db.Listener, m *metrics.Metrics, shutdown <-chan struct{}, clock tokens.Clock, entropy tokens.Entropy, logger *slog.Logger) (*app, error) {
+	cfg := settings.Get()
+
+	router := gin.New()
+	router.Use(
+		gin.Recovery(),
+		otelgin.Middleware(tracing.ServiceName),
+		middleware.RequestID,
+		middleware.RequestLogger(logger),
+		middleware.Metrics(m),
+	)
+
+	if len(cfg.CORSAllowedOrigins) > 0 {
+		router.Use(middleware.CORS(middleware.CORSConfig{
+			AllowedOrigins:   cfg.CORSAllowedOrigins,
+			AllowedMethods:   cfg.CORSAllowedMethods,
+			AllowedHeaders:   cfg.CORSAllowedHeaders,
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           cfg.CORSMaxAge,
+		}))
+	}
 
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
 		api.RegisterCustomValidators(v)
 	}
 
-	authRepo := repositories.NewPgxAuthRepository(db)
+	authRepo, closeAuthRepo, err := repositories.NewAuthRepositoryForStorage(settings, db, clock)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		if err := closeAuthRepo(); err != nil {
+			logger.Error("Failed to close session storage", logging.Err(err))
+		}
+	}()
+
+	// the memory and redis storages don't need a cache, and only Postgres notifies about changes made by other instances
+	if cfg.SessionStorage != config.SessionStorageMemory && cfg.SessionStorage != config.SessionStorageRedis && cfg.SessionCacheSize > 0 && cfg.SessionCacheTTL > 0 {
+		authChanges := listener
+		if cfg.SessionStorage != config.SessionStoragePostgres {
+			authChanges = nil
+		}
+		cachedAuthRepo := repositories.NewCachedAuthRepository(authRepo, authChanges, repositories.AuthCacheConfig{
+			Size:        cfg.SessionCacheSize,
+			TTL:         cfg.SessionCacheTTL,
+			NegativeTTL: cfg.SessionCacheNegativeTTL,
+		}, clock, logger)
+		go cachedAuthRepo.Run(ctx)
+		authRepo = cachedAuthRepo
+	}
+
+	webhookReportsService := services.NewWebhookReportsService(settings)
+	deadLettersRepo := repositories.NewPgxDeadLettersRepository(db)
+	webhookDispatcher := services.NewWebhookDispatcher(services.NewInstrumentedReportService(&webhookReportsService, m), deadLettersRepo, logger)
+
+	authenticator, err := services.NewAuthenticator(*cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Authenticator == config.AuthenticatorNone {
+		logger.Warn("No authenticator is configured, tokens will be issued for any GUID")
+	}
+
+	mfaRepo := repositories.NewPgxMFARepository(db)
+	mfaService := services.NewMFAService(mfaRepo, settings, clock, entropy)
+
+	rolesRepo := repositories.NewPgxRolesRepository(db)
+	rolesService := services.NewRolesService(rolesRepo)
 
-	reportsService := services.NewWebhookReportsService(cfg.WebhookURL)
+	revocationsRepo := repositories.NewPgxRevocationsRepository(db)
+	revocationService := services.NewRevocationService(revocationsRepo, listener, settings, clock, logger)
+	go revocationService.Run(ctx)
+
+	authService := services.NewAuthService(authRepo, rolesService, revocationService, webhookDispatcher, logger, settings, clock, entropy)
+	authService = services.NewInstrumentedAuthService(services.NewTracedAuthService(authService), m)
+	m.RegisterLiveSessions(authService.CountLiveSessions)
+	// the API is versioned, the probes, metrics and docs are served from the root
+	v1 := router.Group("/v1")
+	cookies := handlers.NewTokenCookies(settings, entropy, v1.BasePath())
+	authHandler := handlers.NewAuthHandler(*cfg, authService, authenticator, mfaService, cookies, logger)
+
+	authMiddleware := middleware.NewAuthMiddleware(authService, logger, cfg.CookieMode)
+	if cfg.StatelessValidation {
+		authMiddleware = middleware.NewStatelessAuthMiddleware(authService, logger, cfg.CookieMode)
+	}
+	authHandler.SetupRoutes(v1, authMiddleware)
 
-	authService := services.NewAuthService(authRepo, &reportsService, logger, cfg.JwtKey, cfg.TokenTTL, cfg.AuthTTL)
-	authHandler := handlers.NewAuthHandler(cfg, authService, logger)
+	credentialsRepo := repositories.NewPgxCredentialsRepository(db)
+	loginAttemptsRepo := repositories.NewPgxLoginAttemptsRepository(db)
+	credentialsService := services.NewCredentialsService(credentialsRepo, loginAttemptsRepo, passwords.Params{
+		Memory:      cfg.Argon2Memory,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+		SaltLength:  passwords.DefaultParams.SaltLength,
+		KeyLength:   passwords.DefaultParams.KeyLength,
+	}, clock, logger)
+	credentialsHandler := handlers.NewCredentialsHandler(authService, credentialsService, mfaService, cookies, logger)
+	credentialsHandler.SetupRoutes(v1, authMiddleware)
 
-	authMiddleware := middleware.NewAuthMiddleware(authService, logger)
-	authHandler.SetupRoutes(router, authMiddleware)
+	mfaHandler := handlers.NewMFAHandler(authService, mfaService, cookies, logger)
+	mfaHandler.SetupRoutes(v1, authMiddleware)
+
+	adminHandler := handlers.NewAdminHandler(rolesService, logger)
+	adminHandler.SetupRoutes(v1, authMiddleware)
+
+	healthHandler := handlers.NewHealthHandler(shutdown,
+		handlers.HealthCheck{Name: "database", Check: func(ctx context.Context) error {
+			_, err := db.Exec(ctx, "SELECT 1")
+			return err
+		}},
+		handlers.HealthCheck{Name: "migrations", Check: func(ctx context.Context) error {
+			return checkMigrations(ctx, db)
+		}},
+	)
+	healthHandler.SetupRoutes(router)
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
+	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})))
+	router.NoRoute(func(c *gin.Context) {
+		problems.Abort(c, api.NewProblem(http.StatusNotFound, api.CodeNotFound, "The route doesn't exist"))
+	})
+
+	authServer := grpcapi.NewAuthServer(authService, authenticator, mfaService, cfg.StatelessValidation, logger)
 
-	return router
+	return &app{
+		router:     router,
+		grpcServer: grpcapi.NewServer(authServer, m, logger),
+	}, nil
 }
 
-// ServeWithConfig bootstraps and app using the app config and db connection
+// ServeWithConfig bootstraps and app using the app config and db connection. Settings reloaded into the store apply
+// to the running app, see config.Store
 // @title           MEDODS Test task auth server API
 // @version         1.0
 // @description     Auth server for test task
@@ -55,6 +188,92 @@ func newRouter(cfg config.Config, db db.DBTX, logger *log.Logger) *gin.Engine {
 // @in							header
 // @name						Authorization
 // @description				Authorization header using the Bearer scheme. Don't forget the Bearer prefix
-func ServeWithConfig(cfg config.Config, db db.DBTX, logger *log.Logger) error {
-	return http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), newRouter(cfg, db, logger))
+//
+// When ctx is done, readiness starts failing and after cfg.ShutdownDelay the server stops accepting connections,
+// waiting up to cfg.ShutdownTimeout for the active requests to finish.
+func ServeWithConfig(ctx context.Context, settings *config.Store, pool *pgxpool.Pool, m *metrics.Metrics, logger *slog.Logger) error {
+	// background workers keep running while the server drains
+	workersCtx, stopWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWorkers()
+
+	app, err := newApp(workersCtx, settings, pool, db.NewPoolListener(pool), m, ctx.Done(),
+		tokens.NewSystemClock(), tokens.NewSystemEntropy(), logger)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", settings.Get().Port),
+		Handler: app.router,
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	// the gRPC port is only read on start, like the HTTP one
+	if grpcPort := settings.Get().GRPCPort; grpcPort != 0 {
+		grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", grpcPort))
+		if err != nil {
+			return err
+		}
+		go func() {
+			serveErr <- app.grpcServer.Serve(grpcListener)
+		}()
+		defer app.grpcServer.Stop()
+		logger.Info("Serving gRPC", "port", grpcPort)
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	cfg := settings.Get()
+	logger.Info("Shutting down", "delay", cfg.ShutdownDelay)
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	grpcStopped := make(chan struct{})
+	go func() {
+		app.grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	err = server.Shutdown(shutdownCtx)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
+
+	logger.Info("Server stopped")
+	return nil
+}
+
+// checkMigrations makes sure the database is migrated to the newest migration embedded into the binary
+func checkMigrations(ctx context.Context, conn db.DBTX) error {
+	expected, err := db.LatestMigrationVersion()
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := db.MigrationVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d failed and must be fixed manually", version)
+	}
+	if version != expected {
+		return fmt.Errorf("expected migration version %d, got %d", expected, version)
+	}
+	return nil
 }
@@ -0,0 +1,882 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/handlers"
+	"github.com/kwinso/medods-test-task/internal/handlers/middleware"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/metrics"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/kwinso/medods-test-task/pkg/authclient"
+	"github.com/kwinso/medods-test-task/pkg/authpb"
+	"github.com/kwinso/medods-test-task/pkg/grpcauth"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	testUserAgent = "integration/1.0"
+	testIP        = "192.0.2.1"
+	testTokenTTL  = 5 * time.Minute
+	testAuthTTL   = time.Hour
+)
+
+// apiBackends set up the storage for the app. With "memory" sessions are kept in memory and everything else sees
+// an empty database. Postgres is only tested if AUTH_TEST_DB_URL is set, the database is migrated.
+var apiBackends = map[string]func(t *testing.T, cfg *config.Config) (db.DBTX, db.Listener){
+	"memory": func(t *testing.T, cfg *config.Config) (db.DBTX, db.Listener) {
+		cfg.SessionStorage = config.SessionStorageMemory
+		return emptyDB{}, nil
+	},
+	"postgres": func(t *testing.T, cfg *config.Config) (db.DBTX, db.Listener) {
+		dbUrl := os.Getenv("AUTH_TEST_DB_URL")
+		if dbUrl == "" {
+			t.Skip("AUTH_TEST_DB_URL is not set")
+		}
+		if _, err := db.ApplyMigrations(dbUrl, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		pool, err := pgxpool.New(context.Background(), dbUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(pool.Close)
+
+		cfg.SessionStorage = config.SessionStoragePostgres
+		cfg.DatabaseURL = dbUrl
+		return pool, db.NewPoolListener(pool)
+	},
+}
+
+func TestAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := map[string]func(t *testing.T, backend string){
+		"login and me":                         testLoginAndMe,
+		"login validation":                     testLoginValidation,
+		"refresh rotates tokens":               testRefreshRotatesTokens,
+		"refresh token reuse":                  testRefreshTokenReuse,
+		"user agent mismatch revokes":          testUserAgentMismatchRevokes,
+		"ip change reported":                   testIPChangeReported,
+		"logout invalidates access tokens":     testLogoutInvalidatesAccessTokens,
+		"logout with stateless validation":     testLogoutStatelessValidation,
+		"access token expires":                 testAccessTokenExpires,
+		"session expires":                      testSessionExpires,
+		"other sessions survive logout":        testOtherSessionsSurviveLogout,
+		"malformed refresh token is rejected":  testMalformedRefreshToken,
+		"missing bearer token is unauthorized": testMissingBearerToken,
+		"unversioned routes are not found":     testUnversionedRoutesNotFound,
+		"cookie mode":                          testCookieMode,
+		"cookie mode disabled":                 testCookieModeDisabled,
+		"cors preflight":                       testCORSPreflight,
+		"grpc login and validate":              testGRPCLoginAndValidate,
+		"grpc refresh":                         testGRPCRefresh,
+		"grpc logout":                          testGRPCLogout,
+		"go client":                            testGoClient,
+	}
+
+	for backend := range apiBackends {
+		t.Run(backend, func(t *testing.T) {
+			for name, test := range cases {
+				t.Run(name, func(t *testing.T) {
+					test(t, backend)
+				})
+			}
+		})
+	}
+}
+
+// testApp is the app served by httptest with a controllable clock and a webhook receiver
+type testApp struct {
+	*app
+	clock   *fakeClock
+	reports chan ipChangeReport
+}
+
+type ipChangeReport struct {
+	Guid      string `json:"guid"`
+	UserAgent string `json:"user_agent"`
+	OldIP     string `json:"old_ip"`
+	NewIP     string `json:"new_ip"`
+}
+
+// newTestApp builds the app on the backend. configure may change the config before the app is built
+func newTestApp(t *testing.T, backend string, configure ...func(cfg *config.Config)) *testApp {
+	t.Helper()
+
+	app := &testApp{
+		clock:   &fakeClock{now: time.Now()},
+		reports: make(chan ipChangeReport, 16),
+	}
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report ipChangeReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		app.reports <- report
+	}))
+	t.Cleanup(receiver.Close)
+
+	webhookURL, err := url.Parse(receiver.URL + "/report")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		WebhookURL:                 *webhookURL,
+		JwtKey:                     "integration-test-key",
+		JwtKeyID:                   "test",
+		JwtIssuer:                  "medods-auth",
+		JwtAudience:                []string{"medods"},
+		RefreshTokenPepper:         "integration-test-pepper",
+		TokenTTL:                   testTokenTTL,
+		AuthTTL:                    testAuthTTL,
+		MFAChallengeTTL:            5 * time.Minute,
+		TOTPIssuer:                 "MEDODS",
+		Authenticator:              config.AuthenticatorNone,
+		AllowInsecureAuthenticator: true,
+		TraceExporter:              "none",
+	}
+	conn, listener := apiBackends[backend](t, cfg)
+	for _, change := range configure {
+		change(cfg)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	app.app, err = newApp(ctx, config.NewStore(cfg), conn, listener, metrics.New(), make(chan struct{}),
+		app.clock, tokens.NewSystemEntropy(), logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// request serves the request from the given IP with the test user agent unless headers override it.
+// body is encoded to JSON unless it's []byte
+func (a *testApp) request(t *testing.T, method, path string, body any, ip string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case []byte:
+		// sent as is, e.g. to test malformed JSON
+		reader = bytes.NewReader(body)
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.RemoteAddr = ip + ":40000"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", testUserAgent)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	return w
+}
+
+func (a *testApp) login(t *testing.T, guid string) api.TokenPair {
+	t.Helper()
+
+	w := a.request(t, http.MethodPost, "/v1/login", api.LoginRequest{GUID: guid}, testIP, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected login to succeed, got %d: %s", w.Code, w.Body)
+	}
+	return decodeTokenPair(t, w)
+}
+
+func (a *testApp) refresh(t *testing.T, refreshToken, ip, userAgent string) *httptest.ResponseRecorder {
+	t.Helper()
+	return a.request(t, http.MethodPut, "/v1/refresh", api.RefreshRequest{RefreshToken: refreshToken}, ip,
+		map[string]string{"User-Agent": userAgent})
+}
+
+func (a *testApp) me(t *testing.T, accessToken string) *httptest.ResponseRecorder {
+	t.Helper()
+	return a.request(t, http.MethodGet, "/v1/me", nil, testIP, map[string]string{"Authorization": "Bearer " + accessToken})
+}
+
+func (a *testApp) logout(t *testing.T, accessToken string) {
+	t.Helper()
+
+	w := a.request(t, http.MethodDelete, "/v1/logout", nil, testIP, map[string]string{"Authorization": "Bearer " + accessToken})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected logout to succeed, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func decodeTokenPair(t *testing.T, w *httptest.ResponseRecorder) api.TokenPair {
+	t.Helper()
+
+	var pair api.TokenPair
+	if err := json.Unmarshal(w.Body.Bytes(), &pair); err != nil {
+		t.Fatal(err)
+	}
+	if pair.AccessToken == "" || pair.RefreshToken == "" {
+		t.Fatalf("expected a token pair, got %s", w.Body)
+	}
+	return pair
+}
+
+func assertStatus(t *testing.T, w *httptest.ResponseRecorder, expected int) {
+	t.Helper()
+	if w.Code != expected {
+		t.Errorf("expected status %d, got %d: %s", expected, w.Code, w.Body)
+	}
+}
+
+// assertProblem checks that the response is a problem+json error with the status and the code
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, expectedStatus int, expectedCode string) api.Problem {
+	t.Helper()
+	assertStatus(t, w, expectedStatus)
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, api.ProblemContentType) {
+		t.Errorf("expected %s, got %q", api.ProblemContentType, contentType)
+	}
+
+	var problem api.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Code != expectedCode || problem.Status != expectedStatus {
+		t.Errorf("expected %d %s, got %d %s", expectedStatus, expectedCode, problem.Status, problem.Code)
+	}
+	return problem
+}
+
+func testLoginAndMe(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	guid := uuid.NewString()
+
+	pair := app.login(t, guid)
+
+	w := app.me(t, pair.AccessToken)
+	assertStatus(t, w, http.StatusOK)
+
+	var me api.GetMeResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &me); err != nil {
+		t.Fatal(err)
+	}
+	if me.Guid != guid {
+		t.Errorf("expected GUID %s, got %s", guid, me.Guid)
+	}
+}
+
+func testLoginValidation(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+
+	for body, rule := range map[string]string{
+		`{}`:                    "required",
+		`{"guid":"not-a-guid"}`: "guid",
+	} {
+		w := app.request(t, http.MethodPost, "/v1/login", []byte(body), testIP, nil)
+		problem := assertProblem(t, w, http.StatusBadRequest, api.CodeValidationFailed)
+
+		if len(problem.Errors) != 1 || problem.Errors[0].Field != "guid" || problem.Errors[0].Rule != rule {
+			t.Errorf("expected the guid field to fail %q for %s, got %+v", rule, body, problem.Errors)
+		}
+	}
+
+	w := app.request(t, http.MethodPost, "/v1/login", []byte(`{"guid":`), testIP, nil)
+	assertProblem(t, w, http.StatusBadRequest, api.CodeMalformedRequest)
+}
+
+func testRefreshRotatesTokens(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	guid := uuid.NewString()
+	pair := app.login(t, guid)
+
+	w := app.refresh(t, pair.RefreshToken, testIP, testUserAgent)
+	assertStatus(t, w, http.StatusOK)
+	rotated := decodeTokenPair(t, w)
+
+	if rotated.RefreshToken == pair.RefreshToken {
+		t.Error("expected a new refresh token")
+	}
+	assertStatus(t, app.me(t, rotated.AccessToken), http.StatusOK)
+
+	// the rotated token can be refreshed again
+	w = app.refresh(t, rotated.RefreshToken, testIP, testUserAgent)
+	assertStatus(t, w, http.StatusOK)
+}
+
+func testRefreshTokenReuse(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	pair := app.login(t, uuid.NewString())
+
+	w := app.refresh(t, pair.RefreshToken, testIP, testUserAgent)
+	assertStatus(t, w, http.StatusOK)
+	rotated := decodeTokenPair(t, w)
+
+	assertProblem(t, app.refresh(t, pair.RefreshToken, testIP, testUserAgent), http.StatusUnauthorized, api.CodeInvalidRefreshToken)
+
+	// the reuse attempt doesn't affect the legitimate token
+	assertStatus(t, app.refresh(t, rotated.RefreshToken, testIP, testUserAgent), http.StatusOK)
+}
+
+func testUserAgentMismatchRevokes(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	pair := app.login(t, uuid.NewString())
+
+	assertProblem(t, app.refresh(t, pair.RefreshToken, testIP, "stolen/1.0"), http.StatusUnauthorized, api.CodeSessionRevokedUAMismatch)
+
+	// the whole session is dropped, not just the refresh attempt
+	assertProblem(t, app.refresh(t, pair.RefreshToken, testIP, testUserAgent), http.StatusUnauthorized, api.CodeSessionExpired)
+	assertProblem(t, app.me(t, pair.AccessToken), http.StatusUnauthorized, api.CodeSessionExpired)
+}
+
+func testIPChangeReported(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	guid := uuid.NewString()
+	pair := app.login(t, guid)
+
+	w := app.refresh(t, pair.RefreshToken, testIP, testUserAgent)
+	assertStatus(t, w, http.StatusOK)
+	pair = decodeTokenPair(t, w)
+	select {
+	case report := <-app.reports:
+		t.Fatalf("expected no report while the IP is the same, got %+v", report)
+	default:
+	}
+
+	w = app.refresh(t, pair.RefreshToken, "198.51.100.7", testUserAgent)
+	assertStatus(t, w, http.StatusOK)
+
+	select {
+	case report := <-app.reports:
+		expected := ipChangeReport{Guid: guid, UserAgent: testUserAgent, OldIP: testIP, NewIP: "198.51.100.7"}
+		if report != expected {
+			t.Errorf("expected report %+v, got %+v", expected, report)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the IP change to be reported to the webhook")
+	}
+}
+
+func testLogoutInvalidatesAccessTokens(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	pair := app.login(t, uuid.NewString())
+
+	app.logout(t, pair.AccessToken)
+
+	assertProblem(t, app.me(t, pair.AccessToken), http.StatusUnauthorized, api.CodeSessionExpired)
+	assertProblem(t, app.refresh(t, pair.RefreshToken, testIP, testUserAgent), http.StatusUnauthorized, api.CodeSessionExpired)
+}
+
+func testLogoutStatelessValidation(t *testing.T, backend string) {
+	app := newTestApp(t, backend, func(cfg *config.Config) {
+		cfg.StatelessValidation = true
+	})
+	pair := app.login(t, uuid.NewString())
+	assertStatus(t, app.me(t, pair.AccessToken), http.StatusOK)
+
+	app.logout(t, pair.AccessToken)
+
+	// the access token is still within its lifetime, only the revocation list rejects it
+	assertProblem(t, app.me(t, pair.AccessToken), http.StatusUnauthorized, api.CodeSessionExpired)
+}
+
+func testAccessTokenExpires(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	pair := app.login(t, uuid.NewString())
+
+	app.clock.Advance(testTokenTTL - time.Second)
+	assertStatus(t, app.me(t, pair.AccessToken), http.StatusOK)
+
+	app.clock.Advance(2 * time.Second)
+	assertProblem(t, app.me(t, pair.AccessToken), http.StatusUnauthorized, api.CodeSessionExpired)
+
+	// the session outlives the access token
+	assertStatus(t, app.refresh(t, pair.RefreshToken, testIP, testUserAgent), http.StatusOK)
+}
+
+func testSessionExpires(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	pair := app.login(t, uuid.NewString())
+
+	// every refresh extends the session by AuthTTL
+	for range 2 {
+		app.clock.Advance(testAuthTTL - time.Second)
+		w := app.refresh(t, pair.RefreshToken, testIP, testUserAgent)
+		assertStatus(t, w, http.StatusOK)
+		pair = decodeTokenPair(t, w)
+	}
+
+	app.clock.Advance(testAuthTTL + time.Second)
+	assertProblem(t, app.refresh(t, pair.RefreshToken, testIP, testUserAgent), http.StatusUnauthorized, api.CodeSessionExpired)
+}
+
+func testOtherSessionsSurviveLogout(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	guid := uuid.NewString()
+	first := app.login(t, guid)
+	second := app.login(t, guid)
+
+	app.logout(t, first.AccessToken)
+
+	assertStatus(t, app.me(t, second.AccessToken), http.StatusOK)
+	assertStatus(t, app.refresh(t, second.RefreshToken, testIP, testUserAgent), http.StatusOK)
+}
+
+func testMalformedRefreshToken(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+
+	assertProblem(t, app.refresh(t, "not base64!", testIP, testUserAgent), http.StatusUnauthorized, api.CodeInvalidRefreshToken)
+	assertProblem(t, app.refresh(t, "bm90LWEtdG9rZW4=", testIP, testUserAgent), http.StatusUnauthorized, api.CodeInvalidRefreshToken)
+}
+
+func testMissingBearerToken(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+
+	assertProblem(t, app.request(t, http.MethodGet, "/v1/me", nil, testIP, nil), http.StatusUnauthorized, api.CodeMissingAccessToken)
+	assertProblem(t, app.request(t, http.MethodGet, "/v1/me", nil, testIP, map[string]string{"Authorization": "Basic abc"}),
+		http.StatusUnauthorized, api.CodeMissingAccessToken)
+	assertProblem(t, app.me(t, "not-a-jwt"), http.StatusUnauthorized, api.CodeInvalidAccessToken)
+}
+
+func testUnversionedRoutesNotFound(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+
+	w := app.request(t, http.MethodPost, "/login", api.LoginRequest{GUID: uuid.NewString()}, testIP, nil)
+	assertProblem(t, w, http.StatusNotFound, api.CodeNotFound)
+}
+
+func testCookieMode(t *testing.T, backend string) {
+	app := newTestApp(t, backend, func(cfg *config.Config) {
+		cfg.CookieMode = true
+		cfg.CookieSameSite = config.CookieSameSiteStrict
+	})
+	transport := map[string]string{handlers.TokenTransportHeader: handlers.TokenTransportCookie}
+
+	w := app.request(t, http.MethodPost, "/v1/login", api.LoginRequest{GUID: uuid.NewString()}, testIP, transport)
+	assertStatus(t, w, http.StatusOK)
+	if strings.Contains(w.Body.String(), "access_token") {
+		t.Errorf("expected the tokens not to be in the body, got %s", w.Body)
+	}
+	csrfToken := decodeCSRFToken(t, w)
+
+	cookies := responseCookies(w)
+	for name, expected := range map[string]struct {
+		path     string
+		httpOnly bool
+	}{
+		middleware.AccessTokenCookie:  {"/v1", true},
+		middleware.RefreshTokenCookie: {"/v1/refresh", true},
+		middleware.CSRFTokenCookie:    {"/", false},
+	} {
+		cookie, ok := cookies[name]
+		if !ok {
+			t.Fatalf("expected the %s cookie to be set", name)
+		}
+		if cookie.Path != expected.path || cookie.HttpOnly != expected.httpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+			t.Errorf("expected %s cookie with path %s, HttpOnly %t, Secure and SameSite=Strict, got %s",
+				name, expected.path, expected.httpOnly, cookie)
+		}
+	}
+	if cookies[middleware.CSRFTokenCookie].Value != csrfToken {
+		t.Errorf("expected the CSRF cookie to match the response, got %q and %q", cookies[middleware.CSRFTokenCookie].Value, csrfToken)
+	}
+
+	withCookies := func(csrfToken string) map[string]string {
+		headers := map[string]string{"Cookie": cookieHeader(cookies)}
+		if csrfToken != "" {
+			headers[middleware.CSRFTokenHeader] = csrfToken
+		}
+		return headers
+	}
+
+	// safe requests don't need the CSRF token
+	assertStatus(t, app.request(t, http.MethodGet, "/v1/me", nil, testIP, withCookies("")), http.StatusOK)
+
+	w = app.request(t, http.MethodPut, "/v1/refresh", nil, testIP, withCookies(""))
+	assertProblem(t, w, http.StatusForbidden, api.CodeCSRFTokenMismatch)
+	w = app.request(t, http.MethodPut, "/v1/refresh", nil, testIP, withCookies("forged"))
+	assertProblem(t, w, http.StatusForbidden, api.CodeCSRFTokenMismatch)
+
+	w = app.request(t, http.MethodPut, "/v1/refresh", nil, testIP, withCookies(csrfToken))
+	assertStatus(t, w, http.StatusOK)
+	rotated := responseCookies(w)
+	if rotated[middleware.RefreshTokenCookie].Value == cookies[middleware.RefreshTokenCookie].Value {
+		t.Error("expected the refresh token cookie to be rotated")
+	}
+	if newCSRFToken := decodeCSRFToken(t, w); newCSRFToken == csrfToken {
+		t.Error("expected a new CSRF token")
+	} else {
+		csrfToken = newCSRFToken
+	}
+	cookies = rotated
+
+	assertProblem(t, app.request(t, http.MethodDelete, "/v1/logout", nil, testIP, withCookies("")),
+		http.StatusForbidden, api.CodeCSRFTokenMismatch)
+
+	w = app.request(t, http.MethodDelete, "/v1/logout", nil, testIP, withCookies(csrfToken))
+	assertStatus(t, w, http.StatusNoContent)
+	for name, cookie := range responseCookies(w) {
+		if cookie.MaxAge >= 0 {
+			t.Errorf("expected the %s cookie to be cleared, got %s", name, cookie)
+		}
+	}
+
+	assertProblem(t, app.request(t, http.MethodGet, "/v1/me", nil, testIP, withCookies("")), http.StatusUnauthorized, api.CodeSessionExpired)
+}
+
+func testCookieModeDisabled(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+
+	w := app.request(t, http.MethodPost, "/v1/login", api.LoginRequest{GUID: uuid.NewString()}, testIP,
+		map[string]string{handlers.TokenTransportHeader: handlers.TokenTransportCookie})
+	assertStatus(t, w, http.StatusOK)
+	pair := decodeTokenPair(t, w)
+	if cookies := w.Result().Cookies(); len(cookies) > 0 {
+		t.Errorf("expected no cookies, got %v", cookies)
+	}
+
+	// the access token cookie is ignored, so it can't be used to bypass the CSRF check
+	w = app.request(t, http.MethodGet, "/v1/me", nil, testIP, map[string]string{
+		"Cookie": middleware.AccessTokenCookie + "=" + pair.AccessToken,
+	})
+	assertProblem(t, w, http.StatusUnauthorized, api.CodeMissingAccessToken)
+}
+
+func testCORSPreflight(t *testing.T, backend string) {
+	app := newTestApp(t, backend, func(cfg *config.Config) {
+		cfg.CORSAllowedOrigins = []string{"https://*.example.com"}
+		cfg.CORSAllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
+		cfg.CORSAllowedHeaders = []string{"Content-Type", "X-CSRF-Token"}
+		cfg.CORSAllowCredentials = true
+		cfg.CORSMaxAge = 10 * time.Minute
+	})
+	origin := map[string]string{"Origin": "https://portal.example.com"}
+
+	w := app.request(t, http.MethodOptions, "/v1/refresh", nil, testIP, map[string]string{
+		"Origin":                         "https://portal.example.com",
+		"Access-Control-Request-Method":  http.MethodPut,
+		"Access-Control-Request-Headers": "content-type,x-csrf-token",
+	})
+	assertStatus(t, w, http.StatusNoContent)
+	for header, expected := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://portal.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST, PUT, DELETE",
+		"Access-Control-Max-Age":           "600",
+	} {
+		if actual := w.Header().Get(header); actual != expected {
+			t.Errorf("expected %s %q, got %q", header, expected, actual)
+		}
+	}
+
+	w = app.request(t, http.MethodPost, "/v1/login", api.LoginRequest{GUID: uuid.NewString()}, testIP, origin)
+	assertStatus(t, w, http.StatusOK)
+	if actual := w.Header().Get("Access-Control-Allow-Origin"); actual != origin["Origin"] {
+		t.Errorf("expected the login response to allow %s, got %q", origin["Origin"], actual)
+	}
+}
+
+// grpcClient connects to the gRPC server of the app over an in-memory listener with the test user agent
+func (a *testApp) grpcClient(t *testing.T) authpb.AuthServiceClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	go func() {
+		_ = a.grpcServer.Serve(listener)
+	}()
+	t.Cleanup(a.grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUserAgent(testUserAgent),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return authpb.NewAuthServiceClient(conn)
+}
+
+// assertGRPCError checks that the call failed with the code and the stable error code as the reason
+func assertGRPCError(t *testing.T, err error, expectedCode codes.Code, expectedReason string) {
+	t.Helper()
+
+	st := status.Convert(err)
+	if st.Code() != expectedCode {
+		t.Errorf("expected %s, got %s: %s", expectedCode, st.Code(), st.Message())
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			if info.GetReason() != expectedReason {
+				t.Errorf("expected reason %s, got %s", expectedReason, info.GetReason())
+			}
+			return
+		}
+	}
+	t.Errorf("expected the error to have the reason %s", expectedReason)
+}
+
+func testGRPCLoginAndValidate(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	client := app.grpcClient(t)
+	guid := uuid.NewString()
+
+	res, err := client.Login(context.Background(), &authpb.LoginRequest{Guid: guid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetMfaRequired() || res.GetTokens().GetAccessToken() == "" || res.GetTokens().GetRefreshToken() == "" {
+		t.Fatalf("expected a token pair, got %v", res)
+	}
+
+	claims, err := client.ValidateAccessToken(context.Background(), &authpb.ValidateAccessTokenRequest{
+		AccessToken: res.GetTokens().GetAccessToken(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.GetGuid() != guid || claims.GetAcr() != tokens.ACRSingleFactor {
+		t.Errorf("expected the claims of %s, got %v", guid, claims)
+	}
+	if !claims.GetExpiresAt().AsTime().Equal(app.clock.Now().Add(testTokenTTL).Truncate(time.Second)) {
+		t.Errorf("expected the token to expire in %s, got %s", testTokenTTL, claims.GetExpiresAt().AsTime())
+	}
+
+	// the tokens are the same as the ones issued over HTTP
+	assertStatus(t, app.me(t, res.GetTokens().GetAccessToken()), http.StatusOK)
+
+	ctx := grpcauth.WithBearerToken(context.Background(), res.GetTokens().GetAccessToken())
+	sessions, err := client.ListSessions(ctx, &authpb.ListSessionsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions.GetSessions()) != 1 || sessions.GetSessions()[0].GetId() != claims.GetAuthId() {
+		t.Errorf("expected the session %s, got %v", claims.GetAuthId(), sessions.GetSessions())
+	}
+
+	_, err = client.Login(context.Background(), &authpb.LoginRequest{Guid: "not-a-guid"})
+	assertGRPCError(t, err, codes.InvalidArgument, api.CodeValidationFailed)
+
+	_, err = client.ValidateAccessToken(context.Background(), &authpb.ValidateAccessTokenRequest{AccessToken: "not-a-jwt"})
+	assertGRPCError(t, err, codes.Unauthenticated, api.CodeInvalidAccessToken)
+
+	// the calls are measured like the HTTP requests
+	w := app.request(t, http.MethodGet, "/metrics", nil, testIP, nil)
+	assertStatus(t, w, http.StatusOK)
+	for _, series := range []string{
+		`medods_auth_grpc_call_duration_seconds_count{code="OK",method="/medods.auth.v1.AuthService/Login"} 1`,
+		`medods_auth_grpc_call_duration_seconds_count{code="InvalidArgument",method="/medods.auth.v1.AuthService/Login"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), series) {
+			t.Errorf("expected the metrics to have %s", series)
+		}
+	}
+}
+
+func testGRPCRefresh(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	client := app.grpcClient(t)
+
+	res, err := client.Login(context.Background(), &authpb.LoginRequest{Guid: uuid.NewString()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := client.Refresh(context.Background(), &authpb.RefreshRequest{RefreshToken: res.GetTokens().GetRefreshToken()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.GetRefreshToken() == res.GetTokens().GetRefreshToken() {
+		t.Error("expected a new refresh token")
+	}
+
+	_, err = client.Refresh(context.Background(), &authpb.RefreshRequest{RefreshToken: res.GetTokens().GetRefreshToken()})
+	assertGRPCError(t, err, codes.Unauthenticated, api.CodeInvalidRefreshToken)
+
+	_, err = client.Refresh(context.Background(), &authpb.RefreshRequest{RefreshToken: "not base64!"})
+	assertGRPCError(t, err, codes.Unauthenticated, api.CodeInvalidRefreshToken)
+
+	// the session is bound to the user agent of the gRPC client, so it can't be refreshed over HTTP with another one
+	assertProblem(t, app.refresh(t, rotated.GetRefreshToken(), testIP, "stolen/1.0"), http.StatusUnauthorized, api.CodeSessionRevokedUAMismatch)
+}
+
+func testGRPCLogout(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	client := app.grpcClient(t)
+	pair := app.login(t, uuid.NewString())
+
+	_, err := client.Logout(context.Background(), &authpb.LogoutRequest{})
+	assertGRPCError(t, err, codes.Unauthenticated, api.CodeMissingAccessToken)
+
+	_, err = client.Logout(grpcauth.WithBearerToken(context.Background(), pair.AccessToken), &authpb.LogoutRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.ValidateAccessToken(context.Background(), &authpb.ValidateAccessTokenRequest{AccessToken: pair.AccessToken})
+	assertGRPCError(t, err, codes.Unauthenticated, api.CodeSessionExpired)
+	assertProblem(t, app.me(t, pair.AccessToken), http.StatusUnauthorized, api.CodeSessionExpired)
+}
+
+func testGoClient(t *testing.T, backend string) {
+	app := newTestApp(t, backend)
+	server := httptest.NewServer(app.router)
+	t.Cleanup(server.Close)
+
+	client, err := authclient.New(authclient.Config{
+		BaseURL:    server.URL,
+		HTTPClient: server.Client(),
+		UserAgent:  testUserAgent,
+		Now:        app.clock.Now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guid := uuid.NewString()
+
+	res, err := client.Login(context.Background(), guid, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the access token expires, the client refreshes it before the call
+	app.clock.Advance(testTokenTTL)
+	me, err := client.Me(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me != guid {
+		t.Errorf("expected GUID %s, got %s", guid, me)
+	}
+
+	refreshed, err := client.Tokens(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.RefreshToken == res.Tokens.RefreshToken {
+		t.Error("expected the tokens to be refreshed")
+	}
+
+	if err := client.Logout(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertProblem(t, app.me(t, refreshed.AccessToken), http.StatusUnauthorized, api.CodeSessionExpired)
+}
+
+func decodeCSRFToken(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var response api.CookieSessionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.CSRFToken == "" {
+		t.Fatalf("expected a CSRF token, got %s", w.Body)
+	}
+	return response.CSRFToken
+}
+
+func responseCookies(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+// cookieHeader joins the cookies into the Cookie request header, as a browser would send them
+func cookieHeader(cookies map[string]*http.Cookie) string {
+	pairs := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		pairs = append(pairs, cookie.Name+"="+cookie.Value)
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// fakeClock is a tokens.Clock that only moves when advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// emptyDB is a database without any rows, for the repositories that are always backed by Postgres.
+// Writes succeed and are forgotten.
+type emptyDB struct{}
+
+func (emptyDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+func (emptyDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return &emptyRows{}, nil
+}
+
+func (emptyDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	return emptyRow{}
+}
+
+type emptyRow struct{}
+
+func (emptyRow) Scan(...any) error {
+	return pgx.ErrNoRows
+}
+
+type emptyRows struct{}
+
+func (*emptyRows) Close()                                       {}
+func (*emptyRows) Err() error                                   { return nil }
+func (*emptyRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (*emptyRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (*emptyRows) Next() bool                                   { return false }
+func (*emptyRows) Scan(...any) error                            { return pgx.ErrNoRows }
+func (*emptyRows) Values() ([]any, error)                       { return nil, nil }
+func (*emptyRows) RawValues() [][]byte                          { return nil }
+func (*emptyRows) Conn() *pgx.Conn                              { return nil }
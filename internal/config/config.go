@@ -2,14 +2,19 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/kwinso/medods-test-task/internal/passwords"
 )
 
+// Config is loaded from the AUTH_* env vars, layered over the secrets provider from AUTH_SECRETS_PROVIDER and the optional
+// config file from AUTH_CONFIG_FILE.
+// See Store for the settings that can be reloaded without restart.
 type Config struct {
 	Port             int
 	WebhookURL       url.URL
@@ -18,74 +23,419 @@ type Config struct {
 	TokenTTL         time.Duration
 	AuthTTL          time.Duration
 	MigrationsSource string
+
+	// GRPCPort is the port of the gRPC API, served beside the HTTP API. 0 disables it
+	GRPCPort int
+
+	// RefreshTokenPepper is the server secret refresh tokens are hashed with
+	RefreshTokenPepper string
+
+	// JwtKeyID identifies JwtKey in the `kid` header of access tokens
+	JwtKeyID string
+	// JwtPreviousKeys are rotated out signing keys by their IDs, still accepted when validating access tokens
+	JwtPreviousKeys map[string]string
+
+	// JwtIssuer is put into the `iss` claim of access tokens
+	JwtIssuer string
+	// JwtAudience is put into the `aud` claim of access tokens
+	JwtAudience []string
+	// JwtAllowedAudiences are accepted when validating access tokens
+	JwtAllowedAudiences []string
+	// JwtLeeway is the allowed clock skew when validating access tokens
+	JwtLeeway time.Duration
+
+	// Authenticator selects how the GUID is verified before issuing tokens. See Authenticator* constants.
+	Authenticator         string
+	AllowlistFile         string
+	RegistryPublicKeyFile string
+	RegistryIssuer        string
+	RegistryAudience      string
+	UserServiceURL        url.URL
+	// AllowInsecureAuthenticator permits the none authenticator, which issues tokens for any GUID
+	AllowInsecureAuthenticator bool
+
+	// Argon2id parameters for password hashing. Memory is in KiB
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+
+	// TOTPIssuer is shown in authenticator apps next to the account
+	TOTPIssuer      string
+	MFAChallengeTTL time.Duration
+
+	// StatelessValidation trusts access tokens until they expire instead of looking up the session on every request.
+	// Revoked sessions are still rejected using the in-memory revocation list.
+	StatelessValidation bool
+
+	// CookieMode lets browser clients get the tokens in HttpOnly cookies instead of the response body
+	CookieMode bool
+	// CookieDomain is the Domain attribute of the token cookies. Empty means the host of the request
+	CookieDomain string
+	// CookieSameSite is the SameSite attribute of the token cookies. See CookieSameSite* constants.
+	CookieSameSite string
+
+	// CORSAllowedOrigins are the origins browser apps may call the API from, e.g. `https://portal.example.com`.
+	// `https://*.example.com` matches any subdomain, `*` matches any origin. Empty disables CORS
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	// CORSMaxAge is how long browsers may cache the preflight response
+	CORSMaxAge time.Duration
+
+	// SessionStorage selects where sessions are stored. See SessionStorage* constants.
+	// Everything else is always stored in Postgres
+	SessionStorage string
+	// SQLitePath is the database file for the sqlite session storage
+	SQLitePath string
+	// RedisURL is the redis:// or rediss:// URL of the redis session storage
+	RedisURL string
+
+	// SessionCacheSize is the maximum number of sessions cached in memory. 0 disables the cache
+	SessionCacheSize        int
+	SessionCacheTTL         time.Duration
+	SessionCacheNegativeTTL time.Duration
+
+	// TraceExporter selects where spans are sent: none, otlp or stdout
+	TraceExporter string
+
+	// ShutdownDelay is how long readiness fails before the server stops accepting connections
+	ShutdownDelay time.Duration
+	// ShutdownTimeout is how long the active requests are waited for on shutdown
+	ShutdownTimeout time.Duration
+
+	// ReloadInterval is how often the config and the secrets are reloaded, to pick up rotated secrets. 0 disables it,
+	// the config is still reloaded on SIGHUP
+	ReloadInterval time.Duration
 }
 
+const (
+	AuthenticatorNone      = "none"
+	AuthenticatorAllowlist = "allowlist"
+	AuthenticatorRegistry  = "registry"
+	AuthenticatorHTTP      = "http"
+)
+
+const (
+	CookieSameSiteStrict = "strict"
+	CookieSameSiteLax    = "lax"
+	CookieSameSiteNone   = "none"
+)
+
+const (
+	SessionStoragePostgres = "postgres"
+	SessionStorageMemory   = "memory"
+	SessionStorageSQLite   = "sqlite"
+	SessionStorageRedis    = "redis"
+)
+
 var (
 	ErrWebhookURLRequiredError       = errors.New("AUTH_WEBHOOK_URL env var is required")
+	ErrInvalidWebhookURLError        = errors.New("AUTH_WEBHOOK_URL must be an absolute http or https URL")
 	ErrConnectionStringRequiredError = errors.New("AUTH_DB_URL env var is required")
 	ErrJWTKeyRequiredError           = errors.New("AUTH_JWT_KEY env var is required")
+	ErrPepperRequiredError           = errors.New("AUTH_REFRESH_TOKEN_PEPPER env var is required")
+	ErrInvalidPortError              = errors.New("AUTH_PORT must be between 1 and 65535")
+	ErrInvalidGRPCPortError          = errors.New("AUTH_GRPC_PORT must be between 0 and 65535 and differ from AUTH_PORT")
+	ErrInvalidPreviousKeysError      = errors.New("AUTH_JWT_PREVIOUS_KEYS must be a comma-separated list of kid:key pairs")
+	ErrNegativeLeewayError           = errors.New("AUTH_JWT_LEEWAY must not be negative")
+	ErrTokenTTLTooLongError          = errors.New("AUTH_TOKEN_TTL must be shorter than AUTH_SESSION_TTL")
+	ErrInvalidArgon2IterationsError  = fmt.Errorf("AUTH_ARGON2_ITERATIONS must be between 1 and %d", passwords.MaxIterations)
+	ErrInvalidArgon2ParallelismError = errors.New("AUTH_ARGON2_PARALLELISM must be at least 1")
+	ErrInvalidArgon2MemoryError      = fmt.Errorf("AUTH_ARGON2_MEMORY must be at least 8 KiB per AUTH_ARGON2_PARALLELISM thread and at most %d KiB", passwords.MaxMemory)
+	ErrAuthenticatorRequiredError    = errors.New("AUTH_AUTHENTICATOR env var is required")
+	ErrInsecureAuthenticatorError    = errors.New("AUTH_AUTHENTICATOR=none issues tokens for any GUID, set AUTH_ALLOW_INSECURE_AUTHENTICATOR=true to allow it")
+	ErrUnknownAuthenticatorError     = errors.New("AUTH_AUTHENTICATOR must be one of: none, allowlist, registry, http")
+	ErrAllowlistFileRequiredError    = errors.New("AUTH_ALLOWLIST_FILE env var is required for allowlist authenticator")
+	ErrRegistryKeyRequiredError      = errors.New("AUTH_REGISTRY_PUBLIC_KEY_FILE env var is required for registry authenticator")
+	ErrRegistryIssuerRequiredError   = errors.New("AUTH_REGISTRY_ISSUER env var is required for registry authenticator")
+	ErrRegistryAudienceRequiredError = errors.New("AUTH_REGISTRY_AUDIENCE env var is required for registry authenticator")
+	ErrUserServiceURLRequiredError   = errors.New("AUTH_USER_SERVICE_URL env var is required for http authenticator")
+	ErrInvalidUserServiceURLError    = errors.New("AUTH_USER_SERVICE_URL must be an absolute http or https URL")
+	ErrUnknownCookieSameSiteError    = errors.New("AUTH_COOKIE_SAME_SITE must be one of: strict, lax, none")
+	ErrInvalidCORSOriginError        = errors.New("AUTH_CORS_ALLOWED_ORIGINS must be *, or http or https origins with an optional *. subdomain wildcard")
+	ErrCORSWildcardCredentialsError  = errors.New("AUTH_CORS_ALLOWED_ORIGINS must not be * when AUTH_CORS_ALLOW_CREDENTIALS is enabled")
+	ErrUnknownSessionStorageError    = errors.New("AUTH_SESSION_STORAGE must be one of: postgres, memory, sqlite, redis")
+	ErrRedisURLRequiredError         = errors.New("AUTH_REDIS_URL env var is required for redis session storage")
+	ErrNegativeCacheSizeError        = errors.New("AUTH_SESSION_CACHE_SIZE must not be negative")
+	ErrUnknownTraceExporterError     = errors.New("AUTH_TRACE_EXPORTER must be one of: none, otlp, stdout")
+	ErrUnknownConfigFormatError      = errors.New("AUTH_CONFIG_FILE must be a .yaml, .yml or .toml file")
+	ErrUnknownSecretsProviderError   = errors.New("AUTH_SECRETS_PROVIDER must be one of: none, file, vault")
+	ErrSecretsDirRequiredError       = errors.New("AUTH_SECRETS_DIR env var is required for file secrets provider")
+	ErrVaultAddrRequiredError        = errors.New("AUTH_VAULT_ADDR must be an absolute http or https URL for vault secrets provider")
+	ErrVaultSecretRequiredError      = errors.New("AUTH_VAULT_TOKEN and AUTH_VAULT_SECRET_PATH env vars are required for vault secrets provider")
 )
 
+// Load reads the config and validates it. All problems are reported at once, joined into the returned error.
 func Load() (*Config, error) {
-	port := 8080
-	envPort := os.Getenv("AUTH_PORT")
+	l, err := newLoader(os.Getenv("AUTH_CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
 
-	if envPort != "" {
-		parsedPort, err := strconv.Atoi(envPort)
+	provider, err := newSecretProvider(l)
+	if err != nil {
+		l.errs = append(l.errs, err)
+	} else if provider != nil {
+		l.secrets, err = loadSecrets(provider)
 		if err != nil {
-			return nil, err
+			l.errs = append(l.errs, fmt.Errorf("failed to load secrets: %w", err))
 		}
-		port = parsedPort
 	}
 
-	envUrl := os.Getenv("AUTH_WEBHOOK_URL")
-	if envUrl == "" {
-		return nil, ErrWebhookURLRequiredError
+	jwtPreviousKeys := make(map[string]string)
+	for _, pair := range l.list("AUTH_JWT_PREVIOUS_KEYS") {
+		kid, previousKey, ok := strings.Cut(pair, ":")
+		if !ok || kid == "" || previousKey == "" {
+			l.errs = append(l.errs, ErrInvalidPreviousKeysError)
+			break
+		}
+		jwtPreviousKeys[kid] = previousKey
 	}
-	webhookURL, err := url.Parse(envUrl)
-	if err != nil {
-		return nil, err
+
+	jwtAudience := l.list("AUTH_JWT_AUDIENCE")
+	if len(jwtAudience) == 0 {
+		jwtAudience = []string{"medods"}
 	}
 
-	dbConnStr := os.Getenv("AUTH_DB_URL")
-	if dbConnStr == "" {
-		return nil, ErrConnectionStringRequiredError
+	jwtAllowedAudiences := l.list("AUTH_JWT_ALLOWED_AUDIENCES")
+	if len(jwtAllowedAudiences) == 0 {
+		jwtAllowedAudiences = jwtAudience
 	}
 
-	key := os.Getenv("AUTH_JWT_KEY")
-	if key == "" {
-		return nil, ErrJWTKeyRequiredError
+	corsAllowedMethods := l.list("AUTH_CORS_ALLOWED_METHODS")
+	if len(corsAllowedMethods) == 0 {
+		corsAllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
 	}
 
-	tokenTTL := os.Getenv("AUTH_TOKEN_TTL")
-	if tokenTTL == "" {
-		tokenTTL = "5m"
+	corsAllowedHeaders := l.list("AUTH_CORS_ALLOWED_HEADERS")
+	if len(corsAllowedHeaders) == 0 {
+		corsAllowedHeaders = []string{"Authorization", "Content-Type", "X-CSRF-Token", "X-Token-Transport", "X-Request-ID"}
 	}
 
-	tokenTTLDuration, err := time.ParseDuration(tokenTTL)
-	if err != nil {
+	cfg := &Config{
+		Port:             l.int("AUTH_PORT", 8080),
+		GRPCPort:         l.int("AUTH_GRPC_PORT", 0),
+		WebhookURL:       l.url("AUTH_WEBHOOK_URL"),
+		DatabaseURL:      l.string("AUTH_DB_URL", ""),
+		JwtKey:           l.string("AUTH_JWT_KEY", ""),
+		TokenTTL:         l.duration("AUTH_TOKEN_TTL", 5*time.Minute),
+		AuthTTL:          l.duration("AUTH_SESSION_TTL", time.Hour),
+		MigrationsSource: l.string("AUTH_MIGRATIONS_SOURCE", ""),
+
+		RefreshTokenPepper: l.string("AUTH_REFRESH_TOKEN_PEPPER", ""),
+
+		JwtKeyID:        l.string("AUTH_JWT_KEY_ID", ""),
+		JwtPreviousKeys: jwtPreviousKeys,
+
+		JwtIssuer:           l.string("AUTH_JWT_ISSUER", "medods-auth"),
+		JwtAudience:         jwtAudience,
+		JwtAllowedAudiences: jwtAllowedAudiences,
+		JwtLeeway:           l.duration("AUTH_JWT_LEEWAY", 30*time.Second),
+
+		Authenticator:         l.string("AUTH_AUTHENTICATOR", ""),
+		AllowlistFile:         l.string("AUTH_ALLOWLIST_FILE", ""),
+		RegistryPublicKeyFile: l.string("AUTH_REGISTRY_PUBLIC_KEY_FILE", ""),
+		RegistryIssuer:        l.string("AUTH_REGISTRY_ISSUER", ""),
+		RegistryAudience:      l.string("AUTH_REGISTRY_AUDIENCE", ""),
+		UserServiceURL:        l.url("AUTH_USER_SERVICE_URL"),
+
+		AllowInsecureAuthenticator: l.bool("AUTH_ALLOW_INSECURE_AUTHENTICATOR", false),
+
+		Argon2Memory:      uint32(l.uint("AUTH_ARGON2_MEMORY", 64*1024, 32)),
+		Argon2Iterations:  uint32(l.uint("AUTH_ARGON2_ITERATIONS", 3, 32)),
+		Argon2Parallelism: uint8(l.uint("AUTH_ARGON2_PARALLELISM", 2, 8)),
+
+		TOTPIssuer:      l.string("AUTH_TOTP_ISSUER", "MEDODS"),
+		MFAChallengeTTL: l.duration("AUTH_MFA_CHALLENGE_TTL", 5*time.Minute),
+
+		StatelessValidation: l.bool("AUTH_STATELESS_VALIDATION", false),
+
+		CookieMode:     l.bool("AUTH_COOKIE_MODE", false),
+		CookieDomain:   l.string("AUTH_COOKIE_DOMAIN", ""),
+		CookieSameSite: l.string("AUTH_COOKIE_SAME_SITE", CookieSameSiteStrict),
+
+		CORSAllowedOrigins:   l.list("AUTH_CORS_ALLOWED_ORIGINS"),
+		CORSAllowedMethods:   corsAllowedMethods,
+		CORSAllowedHeaders:   corsAllowedHeaders,
+		CORSAllowCredentials: l.bool("AUTH_CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           l.duration("AUTH_CORS_MAX_AGE", 10*time.Minute),
+
+		SessionStorage: l.string("AUTH_SESSION_STORAGE", SessionStoragePostgres),
+		SQLitePath:     l.string("AUTH_SQLITE_PATH", "auth.db"),
+		RedisURL:       l.string("AUTH_REDIS_URL", ""),
+
+		SessionCacheSize:        l.int("AUTH_SESSION_CACHE_SIZE", 10000),
+		SessionCacheTTL:         l.duration("AUTH_SESSION_CACHE_TTL", 30*time.Second),
+		SessionCacheNegativeTTL: l.duration("AUTH_SESSION_CACHE_NEGATIVE_TTL", 5*time.Second),
+
+		TraceExporter: l.string("AUTH_TRACE_EXPORTER", "none"),
+
+		ShutdownDelay:   l.duration("AUTH_SHUTDOWN_DELAY", 5*time.Second),
+		ShutdownTimeout: l.duration("AUTH_SHUTDOWN_TIMEOUT", 15*time.Second),
+
+		ReloadInterval: l.duration("AUTH_RELOAD_INTERVAL", 0),
+	}
+
+	errs := append(l.errs, l.unknownSettings()...)
+	errs = append(errs, cfg.Validate())
+	if err := errors.Join(errs...); err != nil {
 		return nil, err
 	}
+	return cfg, nil
+}
 
-	authTTL := os.Getenv("AUTH_SESSION_TTL")
-	if authTTL == "" {
-		authTTL = "1h"
+// Validate checks the settings and how they fit together. All problems are reported at once, joined into the returned error.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, ErrInvalidPortError)
+	}
+	if c.GRPCPort < 0 || c.GRPCPort > 65535 || c.GRPCPort == c.Port {
+		errs = append(errs, ErrInvalidGRPCPortError)
 	}
 
-	authTTLDuration, err := time.ParseDuration(authTTL)
-	if err != nil {
-		return nil, err
+	if c.WebhookURL == (url.URL{}) {
+		errs = append(errs, ErrWebhookURLRequiredError)
+	} else if !isHTTPURL(c.WebhookURL) {
+		errs = append(errs, ErrInvalidWebhookURLError)
+	}
+	if c.DatabaseURL == "" {
+		errs = append(errs, ErrConnectionStringRequiredError)
+	}
+	if c.JwtKey == "" {
+		errs = append(errs, ErrJWTKeyRequiredError)
+	}
+	if c.RefreshTokenPepper == "" {
+		errs = append(errs, ErrPepperRequiredError)
+	}
+
+	for _, ttl := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"AUTH_TOKEN_TTL", c.TokenTTL},
+		{"AUTH_SESSION_TTL", c.AuthTTL},
+		{"AUTH_MFA_CHALLENGE_TTL", c.MFAChallengeTTL},
+	} {
+		if ttl.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", ttl.name))
+		}
+	}
+	if c.TokenTTL >= c.AuthTTL {
+		errs = append(errs, ErrTokenTTLTooLongError)
+	}
+	if c.JwtLeeway < 0 {
+		errs = append(errs, ErrNegativeLeewayError)
+	}
+	for _, duration := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"AUTH_CORS_MAX_AGE", c.CORSMaxAge},
+		{"AUTH_SESSION_CACHE_TTL", c.SessionCacheTTL},
+		{"AUTH_SESSION_CACHE_NEGATIVE_TTL", c.SessionCacheNegativeTTL},
+		{"AUTH_SHUTDOWN_DELAY", c.ShutdownDelay},
+		{"AUTH_SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"AUTH_RELOAD_INTERVAL", c.ReloadInterval},
+	} {
+		if duration.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", duration.name))
+		}
+	}
+
+	// argon2.IDKey panics below these, and passwords refuses hashes above them
+	if c.Argon2Iterations < 1 || c.Argon2Iterations > passwords.MaxIterations {
+		errs = append(errs, ErrInvalidArgon2IterationsError)
+	}
+	if c.Argon2Parallelism < 1 {
+		errs = append(errs, ErrInvalidArgon2ParallelismError)
+	}
+	if c.Argon2Memory < 8*max(uint32(c.Argon2Parallelism), 1) || c.Argon2Memory > passwords.MaxMemory {
+		errs = append(errs, ErrInvalidArgon2MemoryError)
+	}
+
+	switch c.Authenticator {
+	case "":
+		errs = append(errs, ErrAuthenticatorRequiredError)
+	case AuthenticatorNone:
+		if !c.AllowInsecureAuthenticator {
+			errs = append(errs, ErrInsecureAuthenticatorError)
+		}
+	case AuthenticatorAllowlist:
+		if c.AllowlistFile == "" {
+			errs = append(errs, ErrAllowlistFileRequiredError)
+		}
+	case AuthenticatorRegistry:
+		if c.RegistryPublicKeyFile == "" {
+			errs = append(errs, ErrRegistryKeyRequiredError)
+		}
+		if c.RegistryIssuer == "" {
+			errs = append(errs, ErrRegistryIssuerRequiredError)
+		}
+		if c.RegistryAudience == "" {
+			errs = append(errs, ErrRegistryAudienceRequiredError)
+		}
+	case AuthenticatorHTTP:
+		if c.UserServiceURL == (url.URL{}) {
+			errs = append(errs, ErrUserServiceURLRequiredError)
+		} else if !isHTTPURL(c.UserServiceURL) {
+			errs = append(errs, ErrInvalidUserServiceURLError)
+		}
+	default:
+		errs = append(errs, ErrUnknownAuthenticatorError)
+	}
+
+	switch c.CookieSameSite {
+	case CookieSameSiteStrict, CookieSameSiteLax, CookieSameSiteNone:
+	default:
+		errs = append(errs, ErrUnknownCookieSameSiteError)
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" {
+			if c.CORSAllowCredentials {
+				errs = append(errs, ErrCORSWildcardCredentialsError)
+			}
+		} else if !isCORSOrigin(origin) {
+			errs = append(errs, ErrInvalidCORSOriginError)
+			break
+		}
+	}
+
+	switch c.SessionStorage {
+	case SessionStoragePostgres, SessionStorageMemory, SessionStorageSQLite:
+	case SessionStorageRedis:
+		if c.RedisURL == "" {
+			errs = append(errs, ErrRedisURLRequiredError)
+		}
+	default:
+		errs = append(errs, ErrUnknownSessionStorageError)
+	}
+
+	if c.SessionCacheSize < 0 {
+		errs = append(errs, ErrNegativeCacheSizeError)
 	}
 
-	migrationsSource := os.Getenv("AUTH_MIGRATIONS_SOURCE")
+	switch c.TraceExporter {
+	case "none", "otlp", "stdout":
+	default:
+		errs = append(errs, ErrUnknownTraceExporterError)
+	}
+
+	return errors.Join(errs...)
+}
+
+func isHTTPURL(u url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
 
-	return &Config{
-		Port:             port,
-		WebhookURL:       *webhookURL,
-		DatabaseURL:      dbConnStr,
-		JwtKey:           key,
-		TokenTTL:         tokenTTLDuration,
-		AuthTTL:          authTTLDuration,
-		MigrationsSource: migrationsSource,
-	}, nil
+// isCORSOrigin checks that the origin is a scheme and a host with an optional port, like browsers send it.
+// The leftmost label of the host may be a `*` wildcard
+func isCORSOrigin(origin string) bool {
+	// the wildcard isn't a valid host label, so it's replaced before parsing
+	normalized := strings.Replace(origin, "://*.", "://wildcard.", 1)
+	u, err := url.Parse(normalized)
+	return err == nil && isHTTPURL(*u) && normalized == u.Scheme+"://"+u.Host && !strings.Contains(u.Host, "*")
 }
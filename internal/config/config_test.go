@@ -0,0 +1,152 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+// setRequiredEnv sets the env vars Load needs to succeed
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("AUTH_WEBHOOK_URL", "http://localhost/webhook")
+	t.Setenv("AUTH_DB_URL", "postgres://localhost/auth")
+	t.Setenv("AUTH_JWT_KEY", "key")
+	t.Setenv("AUTH_REFRESH_TOKEN_PEPPER", "pepper")
+	t.Setenv("AUTH_AUTHENTICATOR", AuthenticatorAllowlist)
+	t.Setenv("AUTH_ALLOWLIST_FILE", "allowlist.txt")
+}
+
+func TestLoadValidatesArgon2(t *testing.T) {
+	cases := map[string]struct {
+		env  map[string]string
+		want error
+	}{
+		"defaults": {},
+		"minimal": {
+			env: map[string]string{"AUTH_ARGON2_ITERATIONS": "1", "AUTH_ARGON2_PARALLELISM": "1", "AUTH_ARGON2_MEMORY": "8"},
+		},
+		"zero iterations": {
+			env:  map[string]string{"AUTH_ARGON2_ITERATIONS": "0"},
+			want: ErrInvalidArgon2IterationsError,
+		},
+		"zero parallelism": {
+			env:  map[string]string{"AUTH_ARGON2_PARALLELISM": "0"},
+			want: ErrInvalidArgon2ParallelismError,
+		},
+		"zero memory": {
+			env:  map[string]string{"AUTH_ARGON2_MEMORY": "0"},
+			want: ErrInvalidArgon2MemoryError,
+		},
+		"too many iterations": {
+			env:  map[string]string{"AUTH_ARGON2_ITERATIONS": "33"},
+			want: ErrInvalidArgon2IterationsError,
+		},
+		"too much memory": {
+			env:  map[string]string{"AUTH_ARGON2_MEMORY": "1048577"},
+			want: ErrInvalidArgon2MemoryError,
+		},
+		"memory below 8 KiB per thread": {
+			env:  map[string]string{"AUTH_ARGON2_PARALLELISM": "4", "AUTH_ARGON2_MEMORY": "31"},
+			want: ErrInvalidArgon2MemoryError,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			setRequiredEnv(t)
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := Load()
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("expected the config to be valid, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadRequiresAuthenticator(t *testing.T) {
+	cases := map[string]struct {
+		env  map[string]string
+		want error
+	}{
+		"not set": {
+			env:  map[string]string{"AUTH_AUTHENTICATOR": ""},
+			want: ErrAuthenticatorRequiredError,
+		},
+		"none": {
+			env:  map[string]string{"AUTH_AUTHENTICATOR": AuthenticatorNone},
+			want: ErrInsecureAuthenticatorError,
+		},
+		"none allowed": {
+			env: map[string]string{"AUTH_AUTHENTICATOR": AuthenticatorNone, "AUTH_ALLOW_INSECURE_AUTHENTICATOR": "true"},
+		},
+		"unknown": {
+			env:  map[string]string{"AUTH_AUTHENTICATOR": "ldap"},
+			want: ErrUnknownAuthenticatorError,
+		},
+		"allowlist without file": {
+			env:  map[string]string{"AUTH_ALLOWLIST_FILE": ""},
+			want: ErrAllowlistFileRequiredError,
+		},
+		"registry without key": {
+			env:  map[string]string{"AUTH_AUTHENTICATOR": AuthenticatorRegistry},
+			want: ErrRegistryKeyRequiredError,
+		},
+		"registry without issuer": {
+			env: map[string]string{
+				"AUTH_AUTHENTICATOR":            AuthenticatorRegistry,
+				"AUTH_REGISTRY_PUBLIC_KEY_FILE": "/run/secrets/registry.pem",
+				"AUTH_REGISTRY_AUDIENCE":        "medods-auth",
+			},
+			want: ErrRegistryIssuerRequiredError,
+		},
+		"registry without audience": {
+			env: map[string]string{
+				"AUTH_AUTHENTICATOR":            AuthenticatorRegistry,
+				"AUTH_REGISTRY_PUBLIC_KEY_FILE": "/run/secrets/registry.pem",
+				"AUTH_REGISTRY_ISSUER":          "registry",
+			},
+			want: ErrRegistryAudienceRequiredError,
+		},
+		"registry": {
+			env: map[string]string{
+				"AUTH_AUTHENTICATOR":            AuthenticatorRegistry,
+				"AUTH_REGISTRY_PUBLIC_KEY_FILE": "/run/secrets/registry.pem",
+				"AUTH_REGISTRY_ISSUER":          "registry",
+				"AUTH_REGISTRY_AUDIENCE":        "medods-auth",
+			},
+		},
+		"http with relative url": {
+			env:  map[string]string{"AUTH_AUTHENTICATOR": AuthenticatorHTTP, "AUTH_USER_SERVICE_URL": "/users/verify"},
+			want: ErrInvalidUserServiceURLError,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			setRequiredEnv(t)
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			_, err := Load()
+			if tc.want == nil {
+				if err != nil {
+					t.Fatalf("expected the config to be valid, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
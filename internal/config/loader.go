@@ -0,0 +1,217 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// loader reads settings from env vars, falling back to the secret provider and then to the config file.
+// Any setting can also be read from a file set by its *_FILE variant, e.g. AUTH_JWT_KEY_FILE.
+// Parsing errors are collected in errs and the default is used instead, so every problem is reported at once.
+//
+// Keys of the config file are the env var names without the AUTH_ prefix in lower case, e.g. `token_ttl` for
+// AUTH_TOKEN_TTL. Lists can be written as arrays and AUTH_JWT_PREVIOUS_KEYS as a kid to key table.
+type loader struct {
+	path    string
+	file    map[string]string
+	secrets map[string]string
+	used    map[string]bool
+	errs    []error
+}
+
+func newLoader(path string) (*loader, error) {
+	l := &loader{
+		path: path,
+		file: make(map[string]string),
+		used: make(map[string]bool),
+	}
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, ErrUnknownConfigFormatError
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	for key, value := range raw {
+		l.file["AUTH_"+strings.ToUpper(key)] = formatFileValue(value)
+	}
+	return l, nil
+}
+
+// formatFileValue converts a config file value into the env var format
+func formatFileValue(value any) string {
+	switch value := value.(type) {
+	case []any:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			items = append(items, formatFileValue(item))
+		}
+		return strings.Join(items, ",")
+	case map[string]any:
+		pairs := make([]string, 0, len(value))
+		for key, item := range value {
+			pairs = append(pairs, key+":"+formatFileValue(item))
+		}
+		slices.Sort(pairs)
+		return strings.Join(pairs, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// unknownSettings reports the config file keys that don't match any setting, most likely typos
+func (l *loader) unknownSettings() []error {
+	var errs []error
+	for name := range l.file {
+		if !l.used[name] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", l.path, fileKey(name)))
+		}
+	}
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errs
+}
+
+// fileKey returns the config file key of the setting
+func fileKey(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "AUTH_"))
+}
+
+func (l *loader) get(name string) string {
+	l.used[name] = true
+	l.used[name+"_FILE"] = true
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		path = l.file[name+"_FILE"]
+	}
+	if path != "" {
+		value, err := readSecretFile(path)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s_FILE: %w", name, err))
+		}
+		return value
+	}
+
+	if value, ok := l.secrets[name]; ok {
+		return value
+	}
+	return l.file[name]
+}
+
+func (l *loader) string(name string, def string) string {
+	if value := l.get(name); value != "" {
+		return value
+	}
+	return def
+}
+
+func (l *loader) int(name string, def int) int {
+	value := l.get(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", name, err))
+		return def
+	}
+	return parsed
+}
+
+// uint parses an unsigned integer of the given bit size
+func (l *loader) uint(name string, def uint64, bitSize int) uint64 {
+	value := l.get(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", name, err))
+		return def
+	}
+	return parsed
+}
+
+func (l *loader) bool(name string, def bool) bool {
+	value := l.get(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", name, err))
+		return def
+	}
+	return parsed
+}
+
+func (l *loader) duration(name string, def time.Duration) time.Duration {
+	value := l.get(name)
+	if value == "" {
+		return def
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", name, err))
+		return def
+	}
+	return parsed
+}
+
+// url parses a URL, returning an empty one if it's not set
+func (l *loader) url(name string) url.URL {
+	value := l.get(name)
+	if value == "" {
+		return url.URL{}
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", name, err))
+		return url.URL{}
+	}
+	return *parsed
+}
+
+// list parses a comma-separated list, skipping empty items
+func (l *loader) list(name string) []string {
+	var items []string
+	for _, item := range strings.Split(l.get(name), ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
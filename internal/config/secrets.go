@@ -0,0 +1,216 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	SecretsProviderNone  = "none"
+	SecretsProviderFile  = "file"
+	SecretsProviderVault = "vault"
+)
+
+// secretSettings are the settings looked up in the SecretProvider. Env vars and their *_FILE variants take precedence.
+var secretSettings = []string{
+	"AUTH_DB_URL",
+	"AUTH_JWT_KEY",
+	"AUTH_JWT_KEY_ID",
+	"AUTH_JWT_PREVIOUS_KEYS",
+	"AUTH_REFRESH_TOKEN_PEPPER",
+	"AUTH_REDIS_URL",
+}
+
+const secretsTimeout = 10 * time.Second
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider fetches secrets from an external store
+type SecretProvider interface {
+	// GetSecret returns the secret by the setting name in the config file format, e.g. `jwt_key`.
+	// Returns ErrSecretNotFound if the store doesn't have it.
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// secretSnapshotter is a SecretProvider that fetches all secrets at once. loadSecrets takes a single snapshot of it
+// instead of fetching the secrets one by one
+type secretSnapshotter interface {
+	SecretProvider
+	// Snapshot fetches the secrets and returns a SecretProvider serving them
+	Snapshot(ctx context.Context) (SecretProvider, error)
+}
+
+// FileSecretProvider reads secrets from files in a directory named after the settings, e.g. `/run/secrets/jwt_key`.
+// That's how Docker and Kubernetes mount secrets
+type FileSecretProvider struct {
+	dir string
+}
+
+func NewFileSecretProvider(dir string) *FileSecretProvider {
+	return &FileSecretProvider{dir: dir}
+}
+
+func (p *FileSecretProvider) GetSecret(_ context.Context, name string) (string, error) {
+	secret, err := readSecretFile(filepath.Join(p.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", ErrSecretNotFound
+	}
+	return secret, err
+}
+
+// VaultSecretProvider reads secrets from a single secret of a Vault-style KV API. Both KV v1 and v2 responses are supported,
+// for KV v2 the path must include `data/`, e.g. `secret/data/auth`.
+type VaultSecretProvider struct {
+	addr   url.URL
+	token  string
+	path   string
+	client *http.Client
+}
+
+func NewVaultSecretProvider(addr url.URL, token, path string) *VaultSecretProvider {
+	return &VaultSecretProvider{
+		addr:   addr,
+		token:  token,
+		path:   strings.Trim(path, "/"),
+		client: &http.Client{Timeout: secretsTimeout},
+	}
+}
+
+func (p *VaultSecretProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	snapshot, err := p.Snapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+	return snapshot.GetSecret(ctx, name)
+}
+
+// Snapshot fetches the secret from Vault once, the returned SecretProvider serves its keys
+func (p *VaultSecretProvider) Snapshot(ctx context.Context) (SecretProvider, error) {
+	secrets, err := p.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return vaultSnapshot(secrets), nil
+}
+
+// vaultSnapshot serves the keys of a Vault secret read by VaultSecretProvider.Snapshot
+type vaultSnapshot map[string]any
+
+func (s vaultSnapshot) GetSecret(_ context.Context, name string) (string, error) {
+	secret, ok := s[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	if s, ok := secret.(string); ok {
+		return s, nil
+	}
+	return formatFileValue(secret), nil
+}
+
+type vaultResponse struct {
+	Data map[string]any `json:"data"`
+}
+
+func (p *VaultSecretProvider) read(ctx context.Context) (map[string]any, error) {
+	endpoint := p.addr.JoinPath("v1", p.path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault responded with %s for %s", resp.Status, p.path)
+	}
+
+	var body vaultResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	// KV v2 wraps the secret into another `data` next to its `metadata`
+	if inner, ok := body.Data["data"].(map[string]any); ok {
+		if _, ok := body.Data["metadata"]; ok {
+			return inner, nil
+		}
+	}
+	return body.Data, nil
+}
+
+// newSecretProvider creates the SecretProvider selected by the settings, nil if secrets are only read from env vars
+func newSecretProvider(l *loader) (SecretProvider, error) {
+	switch provider := l.string("AUTH_SECRETS_PROVIDER", SecretsProviderNone); provider {
+	case SecretsProviderNone:
+		return nil, nil
+	case SecretsProviderFile:
+		dir := l.string("AUTH_SECRETS_DIR", "")
+		if dir == "" {
+			return nil, ErrSecretsDirRequiredError
+		}
+		return NewFileSecretProvider(dir), nil
+	case SecretsProviderVault:
+		addr := l.url("AUTH_VAULT_ADDR")
+		if !isHTTPURL(addr) {
+			return nil, ErrVaultAddrRequiredError
+		}
+		token := l.string("AUTH_VAULT_TOKEN", "")
+		path := l.string("AUTH_VAULT_SECRET_PATH", "")
+		if token == "" || path == "" {
+			return nil, ErrVaultSecretRequiredError
+		}
+		return NewVaultSecretProvider(addr, token, path), nil
+	default:
+		return nil, ErrUnknownSecretsProviderError
+	}
+}
+
+// loadSecrets fetches the secret settings from the provider
+func loadSecrets(provider SecretProvider) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+
+	if snapshotter, ok := provider.(secretSnapshotter); ok {
+		snapshot, err := snapshotter.Snapshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		provider = snapshot
+	}
+
+	secrets := make(map[string]string, len(secretSettings))
+	for _, name := range secretSettings {
+		secret, err := provider.GetSecret(ctx, fileKey(name))
+		if errors.Is(err, ErrSecretNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		secrets[name] = secret
+	}
+	return secrets, nil
+}
+
+// readSecretFile reads a secret, dropping the trailing newline most editors add
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+const stubVaultToken = "test-token"
+
+// stubVault serves a single KV v2 secret like Vault does
+type stubVault struct {
+	mu       sync.Mutex
+	secrets  map[string]any
+	requests int
+}
+
+func (v *stubVault) set(name string, value any) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.secrets[name] = value
+}
+
+func (v *stubVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != stubVaultToken {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodGet || r.URL.Path != "/v1/secret/data/auth" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.requests++
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"data": map[string]any{
+			"data":     v.secrets,
+			"metadata": map[string]any{"version": 1},
+		},
+	})
+}
+
+func startStubVault(t *testing.T, secrets map[string]any) (*stubVault, *httptest.Server) {
+	vault := &stubVault{secrets: secrets}
+	server := httptest.NewServer(vault)
+	t.Cleanup(server.Close)
+	return vault, server
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	_, server := startStubVault(t, map[string]any{
+		"jwt_key":           "vault-key",
+		"jwt_previous_keys": map[string]any{"old": "old-key"},
+	})
+	addr := mustParseURL(t, server.URL)
+	ctx := context.Background()
+
+	provider := NewVaultSecretProvider(addr, stubVaultToken, "/secret/data/auth/")
+
+	secret, err := provider.GetSecret(ctx, "jwt_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != "vault-key" {
+		t.Errorf("expected vault-key, got %q", secret)
+	}
+
+	secret, err = provider.GetSecret(ctx, "jwt_previous_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != "old:old-key" {
+		t.Errorf("expected the table in the env var format, got %q", secret)
+	}
+
+	if _, err := provider.GetSecret(ctx, "refresh_token_pepper"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+
+	wrongToken := NewVaultSecretProvider(addr, "wrong", "secret/data/auth")
+	if _, err := wrongToken.GetSecret(ctx, "jwt_key"); err == nil || errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected a request error for a wrong token, got %v", err)
+	}
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "jwt_key"), "file-key\n")
+
+	provider := NewFileSecretProvider(dir)
+
+	secret, err := provider.GetSecret(context.Background(), "jwt_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != "file-key" {
+		t.Errorf("expected file-key without the newline, got %q", secret)
+	}
+
+	if _, err := provider.GetSecret(context.Background(), "refresh_token_pepper"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestLoadReadsSecretsAndRotates(t *testing.T) {
+	vault, server := startStubVault(t, map[string]any{
+		"db_url":               "postgres://vault@localhost/auth",
+		"jwt_key":              "vault-key",
+		"jwt_key_id":           "v1",
+		"refresh_token_pepper": "vault-pepper",
+	})
+
+	pepperFile := filepath.Join(t.TempDir(), "pepper")
+	writeFile(t, pepperFile, "file-pepper\n")
+
+	t.Setenv("AUTH_WEBHOOK_URL", "http://localhost/webhook")
+	t.Setenv("AUTH_SECRETS_PROVIDER", SecretsProviderVault)
+	t.Setenv("AUTH_VAULT_ADDR", server.URL)
+	t.Setenv("AUTH_VAULT_TOKEN", stubVaultToken)
+	t.Setenv("AUTH_VAULT_SECRET_PATH", "secret/data/auth")
+	t.Setenv("AUTH_REFRESH_TOKEN_PEPPER_FILE", pepperFile)
+	t.Setenv("AUTH_AUTHENTICATOR", AuthenticatorHTTP)
+	t.Setenv("AUTH_USER_SERVICE_URL", "http://localhost/users/verify")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DatabaseURL != "postgres://vault@localhost/auth" || cfg.JwtKey != "vault-key" || cfg.JwtKeyID != "v1" {
+		t.Errorf("expected secrets from vault, got db %q, key %q, kid %q", cfg.DatabaseURL, cfg.JwtKey, cfg.JwtKeyID)
+	}
+	if cfg.RefreshTokenPepper != "file-pepper" {
+		t.Errorf("expected *_FILE to take precedence over vault, got %q", cfg.RefreshTokenPepper)
+	}
+	if vault.requests != 1 {
+		t.Errorf("expected the secrets to be fetched with a single request, got %d", vault.requests)
+	}
+
+	vault.set("jwt_key", "rotated-key")
+	vault.set("jwt_key_id", "v2")
+	vault.set("jwt_previous_keys", map[string]any{"v1": "vault-key"})
+	vault.set("db_url", "postgres://rotated@localhost/auth")
+
+	settings := NewStore(cfg)
+	applied, ignored, err := settings.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vault.requests != 2 {
+		t.Errorf("expected the reload to fetch the secrets with a single request, got %d in total", vault.requests)
+	}
+	if !slices.Equal(applied, []string{"JwtKey", "JwtKeyID", "JwtPreviousKeys"}) {
+		t.Errorf("expected the signing keys to be applied, got %v", applied)
+	}
+	if !slices.Equal(ignored, []string{"DatabaseURL"}) {
+		t.Errorf("expected the database URL to require a restart, got %v", ignored)
+	}
+
+	current := settings.Get()
+	if current.JwtKey != "rotated-key" || current.JwtPreviousKeys["v1"] != "vault-key" {
+		t.Errorf("expected the rotated keys, got key %q, previous %v", current.JwtKey, current.JwtPreviousKeys)
+	}
+	if current.DatabaseURL != cfg.DatabaseURL {
+		t.Errorf("expected the database URL to be kept, got %q", current.DatabaseURL)
+	}
+}
+
+func TestLoadReportsSecretsProviderErrors(t *testing.T) {
+	t.Setenv("AUTH_WEBHOOK_URL", "http://localhost/webhook")
+	t.Setenv("AUTH_SECRETS_PROVIDER", SecretsProviderVault)
+
+	_, err := Load()
+	for _, expected := range []error{ErrVaultAddrRequiredError, ErrConnectionStringRequiredError, ErrJWTKeyRequiredError} {
+		if !errors.Is(err, expected) {
+			t.Errorf("expected %v to be reported, got %v", expected, err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustParseURL(t *testing.T, raw string) url.URL {
+	t.Helper()
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *parsed
+}
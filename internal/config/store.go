@@ -0,0 +1,90 @@
+package config
+
+import (
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// reloadableSettings are the Config fields that take effect without restart. Changes to the other fields are ignored
+// on reload.
+var reloadableSettings = []string{
+	"WebhookURL",
+	"JwtKey",
+	"JwtKeyID",
+	"JwtPreviousKeys",
+	"TokenTTL",
+	"AuthTTL",
+	"JwtLeeway",
+	"MFAChallengeTTL",
+	"ShutdownDelay",
+	"ShutdownTimeout",
+}
+
+// Store holds the current config. Services read it on every use, so reloaded settings apply to the next request.
+type Store struct {
+	current          atomic.Pointer[Config]
+	maxTokenLifetime atomic.Int64
+	mu               sync.Mutex
+}
+
+func NewStore(cfg *Config) *Store {
+	s := &Store{}
+	s.store(cfg)
+	return s
+}
+
+// Get returns the current config. It must not be modified
+func (s *Store) Get() *Config {
+	return s.current.Load()
+}
+
+// Reload loads and validates the config again and applies the reloadable settings. If the new config is invalid,
+// the current one is kept. Returns the names of the applied settings and of the changed settings that need a restart.
+func (s *Store) Reload() ([]string, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loaded, err := Load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	next := *s.Get()
+	nextValue := reflect.ValueOf(&next).Elem()
+	loadedValue := reflect.ValueOf(loaded).Elem()
+
+	var applied, ignored []string
+	for i := range loadedValue.NumField() {
+		name := loadedValue.Type().Field(i).Name
+		if reflect.DeepEqual(nextValue.Field(i).Interface(), loadedValue.Field(i).Interface()) {
+			continue
+		}
+
+		if slices.Contains(reloadableSettings, name) {
+			nextValue.Field(i).Set(loadedValue.Field(i))
+			applied = append(applied, name)
+		} else {
+			ignored = append(ignored, name)
+		}
+	}
+
+	s.store(&next)
+	return applied, ignored, nil
+}
+
+// MaxTokenLifetime returns the largest TokenTTL plus JwtLeeway of all the configs the store has held. Access tokens
+// issued before a reload that lowered the TTL stay valid for that long.
+func (s *Store) MaxTokenLifetime() time.Duration {
+	return time.Duration(s.maxTokenLifetime.Load())
+}
+
+// store replaces the current config. It's only called by NewStore and under mu
+func (s *Store) store(cfg *Config) {
+	s.current.Store(cfg)
+	if lifetime := int64(cfg.TokenTTL + cfg.JwtLeeway); lifetime > s.maxTokenLifetime.Load() {
+		s.maxTokenLifetime.Store(lifetime)
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReloadableSettingsAreConfigFields(t *testing.T) {
+	configType := reflect.TypeFor[Config]()
+	for _, name := range reloadableSettings {
+		if _, ok := configType.FieldByName(name); !ok {
+			t.Errorf("reloadable setting %s isn't a Config field", name)
+		}
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	cases := map[string]struct {
+		env             map[string]string
+		expectedApplied []string
+		expectedIgnored []string
+		expectedErr     error
+		// check inspects the config after the reload
+		check func(t *testing.T, cfg *Config)
+	}{
+		"nothing changed": {},
+		"reloadable settings are applied": {
+			env:             map[string]string{"AUTH_TOKEN_TTL": "10m", "AUTH_WEBHOOK_URL": "https://example.com/webhook"},
+			expectedApplied: []string{"WebhookURL", "TokenTTL"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.TokenTTL != 10*time.Minute || cfg.WebhookURL.String() != "https://example.com/webhook" {
+					t.Errorf("expected the new settings, got %s and %s", cfg.TokenTTL, cfg.WebhookURL.String())
+				}
+			},
+		},
+		"other settings are ignored": {
+			env:             map[string]string{"AUTH_PORT": "9000", "AUTH_DB_URL": "postgres://other/auth"},
+			expectedIgnored: []string{"Port", "DatabaseURL"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Port != 8080 || cfg.DatabaseURL != "postgres://localhost/auth" {
+					t.Errorf("expected the settings to need a restart, got %d and %s", cfg.Port, cfg.DatabaseURL)
+				}
+			},
+		},
+		"mixed": {
+			env:             map[string]string{"AUTH_PORT": "9000", "AUTH_JWT_LEEWAY": "1m"},
+			expectedApplied: []string{"JwtLeeway"},
+			expectedIgnored: []string{"Port"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.JwtLeeway != time.Minute || cfg.Port != 8080 {
+					t.Errorf("expected only the leeway to change, got %s and %d", cfg.JwtLeeway, cfg.Port)
+				}
+			},
+		},
+		"invalid config is rejected": {
+			env:         map[string]string{"AUTH_TOKEN_TTL": "2h", "AUTH_JWT_LEEWAY": "1m"},
+			expectedErr: ErrTokenTTLTooLongError,
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.TokenTTL != 5*time.Minute || cfg.JwtLeeway == time.Minute {
+					t.Errorf("expected the current config to be kept, got %s and %s", cfg.TokenTTL, cfg.JwtLeeway)
+				}
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			setRequiredEnv(t)
+			cfg, err := Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			store := NewStore(cfg)
+
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			applied, ignored, err := store.Reload()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if !slices.Equal(applied, tc.expectedApplied) {
+				t.Errorf("expected applied %v, got %v", tc.expectedApplied, applied)
+			}
+			if !slices.Equal(ignored, tc.expectedIgnored) {
+				t.Errorf("expected ignored %v, got %v", tc.expectedIgnored, ignored)
+			}
+			if tc.check != nil {
+				tc.check(t, store.Get())
+			}
+		})
+	}
+}
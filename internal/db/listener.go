@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Listener subscribes to Postgres notifications (LISTEN/NOTIFY)
+type Listener interface {
+	// Subscribe starts listening to the channel. Notifications sent after Subscribe returns are never missed.
+	Subscribe(ctx context.Context, channel string) (Subscription, error)
+}
+
+type Subscription interface {
+	// Next blocks until the next notification and returns its payload
+	Next(ctx context.Context) (string, error)
+	Close()
+}
+
+type poolListener struct {
+	pool *pgxpool.Pool
+}
+
+// NewPoolListener creates a Listener that holds a dedicated pool connection for every subscription
+func NewPoolListener(pool *pgxpool.Pool) Listener {
+	return &poolListener{pool: pool}
+}
+
+func (l *poolListener) Subscribe(ctx context.Context, channel string) (Subscription, error) {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+
+	return &poolSubscription{conn: conn}, nil
+}
+
+type poolSubscription struct {
+	conn *pgxpool.Conn
+}
+
+func (s *poolSubscription) Next(ctx context.Context) (string, error) {
+	notification, err := s.conn.Conn().WaitForNotification(ctx)
+	if err != nil {
+		return "", err
+	}
+	return notification.Payload, nil
+}
+
+func (s *poolSubscription) Close() {
+	// the connection goes back to the pool, so it must not keep listening
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := s.conn.Exec(ctx, "UNLISTEN *")
+	if err != nil {
+		_ = s.conn.Conn().Close(ctx)
+	}
+	s.conn.Release()
+}
@@ -1,22 +1,41 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"io/fs"
+	"os"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jackc/pgx/v5"
+	"github.com/kwinso/medods-test-task/sql/migrations"
 )
 
+var ErrNoMigrationsApplied = errors.New("no migrations applied")
+
+// newMigrate creates a migrator for migrationsSource, or for the migrations embedded into the binary if it's empty
+func newMigrate(dbUrl string, migrationsSource string) (*migrate.Migrate, error) {
+	if migrationsSource == "" {
+		source, err := iofs.New(migrations.FS, ".")
+		if err != nil {
+			return nil, err
+		}
+		return migrate.NewWithSourceInstance("iofs", source, dbUrl)
+	}
+	return migrate.New(migrationsSource, dbUrl)
+}
+
 // ApplyMigrations runs all unapplied migrations. Returns true if migrations were applied, false if no change is done.
+// Empty migrationsSource means the migrations embedded into the binary.
 func ApplyMigrations(dbUrl string, migrationsSource string) (bool, error) {
-	m, err := migrate.New(
-		migrationsSource,
-		dbUrl)
-
+	m, err := newMigrate(dbUrl, migrationsSource)
 	if err != nil {
 		return false, err
 	}
+	defer m.Close()
 
 	err = m.Up()
 	if err != nil {
@@ -27,3 +46,57 @@ func ApplyMigrations(dbUrl string, migrationsSource string) (bool, error) {
 	}
 	return true, err
 }
+
+// RollbackMigrations rolls back the last steps migrations. Empty migrationsSource means the migrations embedded into the binary.
+func RollbackMigrations(dbUrl string, migrationsSource string, steps int) error {
+	m, err := newMigrate(dbUrl, migrationsSource)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	err = m.Steps(-steps)
+	if errors.Is(err, migrate.ErrNoChange) {
+		return nil
+	}
+	return err
+}
+
+// MigrationVersion returns the applied migration version and whether the last migration failed halfway.
+// Returns ErrNoMigrationsApplied if the database has never been migrated.
+func MigrationVersion(ctx context.Context, conn DBTX) (uint, bool, error) {
+	var version int64
+	var dirty bool
+	err := conn.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, ErrNoMigrationsApplied
+		}
+		return 0, false, err
+	}
+	return uint(version), dirty, nil
+}
+
+// LatestMigrationVersion returns the version of the newest migration embedded into the binary
+func LatestMigrationVersion() (uint, error) {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		next, err := source.Next(version)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kwinso/medods-test-task/sql/migrations"
+)
+
+func TestLatestMigrationVersion(t *testing.T) {
+	names, err := fs.Glob(migrations.FS, "*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected uint
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			t.Fatalf("migration %s doesn't start with a version: %v", name, err)
+		}
+		expected = max(expected, uint(version))
+	}
+
+	version, err := LatestMigrationVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != expected {
+		t.Errorf("expected version %d of the newest migration, got %d", expected, version)
+	}
+}
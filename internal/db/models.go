@@ -19,4 +19,71 @@ type Auth struct {
 	UserAgent        string     `json:"user_agent"`
 	RefreshedAt      time.Time  `json:"refreshed_at"`
 	CreatedAt        time.Time  `json:"created_at"`
+	Amr              []string   `json:"amr"`
+	Acr              string     `json:"acr"`
+}
+
+type AuthRevocation struct {
+	AuthID    uuid.UUID `json:"auth_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type Credential struct {
+	Guid         string    `json:"guid"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type LoginAttempt struct {
+	Subject     string     `json:"subject"`
+	Attempts    int32      `json:"attempts"`
+	LockedUntil *time.Time `json:"locked_until"`
+}
+
+type MfaChallenge struct {
+	ID         uuid.UUID  `json:"id"`
+	Guid       string     `json:"guid"`
+	Attempts   int32      `json:"attempts"`
+	ConsumedAt *time.Time `json:"consumed_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+type RecoveryCode struct {
+	Guid     string     `json:"guid"`
+	CodeHash string     `json:"code_hash"`
+	UsedAt   *time.Time `json:"used_at"`
+}
+
+type Role struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TotpSecret struct {
+	Guid         string     `json:"guid"`
+	Secret       string     `json:"secret"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	LastUsedStep int64      `json:"last_used_step"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Attempts     int32      `json:"attempts"`
+	LockedUntil  *time.Time `json:"locked_until"`
+}
+
+type UserRole struct {
+	Guid      string    `json:"guid"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDeadLetter struct {
+	ID        int64     `json:"id"`
+	Guid      string    `json:"guid"`
+	AuthID    uuid.UUID `json:"auth_id"`
+	Payload   []byte    `json:"payload"`
+	Error     string    `json:"error"`
+	Attempts  int32     `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
 }
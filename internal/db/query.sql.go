@@ -13,13 +13,59 @@ import (
 	"github.com/google/uuid"
 )
 
+const assignRole = `-- name: AssignRole :exec
+INSERT INTO user_roles (guid, role) VALUES ($1, $2) ON CONFLICT DO NOTHING
+`
+
+type AssignRoleParams struct {
+	Guid string `json:"guid"`
+	Role string `json:"role"`
+}
+
+func (q *Queries) AssignRole(ctx context.Context, arg AssignRoleParams) error {
+	_, err := q.db.Exec(ctx, assignRole, arg.Guid, arg.Role)
+	return err
+}
+
+const confirmTotpSecret = `-- name: ConfirmTotpSecret :exec
+UPDATE totp_secrets SET confirmed_at = NOW() WHERE guid = $1
+`
+
+func (q *Queries) ConfirmTotpSecret(ctx context.Context, guid string) error {
+	_, err := q.db.Exec(ctx, confirmTotpSecret, guid)
+	return err
+}
+
+const consumeMfaChallenge = `-- name: ConsumeMfaChallenge :execrows
+UPDATE mfa_challenges SET consumed_at = NOW() WHERE id = $1 AND consumed_at IS NULL
+`
+
+func (q *Queries) ConsumeMfaChallenge(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, consumeMfaChallenge, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countAuthsRefreshedSince = `-- name: CountAuthsRefreshedSince :one
+SELECT COUNT(*) FROM auths WHERE refreshed_at > $1
+`
+
+func (q *Queries) CountAuthsRefreshedSince(ctx context.Context, refreshedAt time.Time) (int64, error) {
+	row := q.db.QueryRow(ctx, countAuthsRefreshedSince, refreshedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createAuth = `-- name: CreateAuth :one
 
 INSERT INTO auths 
-  (id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at)
+  (id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at, amr, acr)
 VALUES 
-  ($1, $2, $3, $4, $5, $6)
-RETURNING id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at, created_at
+  ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at, created_at, amr, acr
 `
 
 type CreateAuthParams struct {
@@ -29,6 +75,8 @@ type CreateAuthParams struct {
 	IpAddress        netip.Addr `json:"ip_address"`
 	UserAgent        string     `json:"user_agent"`
 	RefreshedAt      time.Time  `json:"refreshed_at"`
+	Amr              []string   `json:"amr"`
+	Acr              string     `json:"acr"`
 }
 
 // noinspection SqlResolveForFile
@@ -40,6 +88,8 @@ func (q *Queries) CreateAuth(ctx context.Context, arg CreateAuthParams) (Auth, e
 		arg.IpAddress,
 		arg.UserAgent,
 		arg.RefreshedAt,
+		arg.Amr,
+		arg.Acr,
 	)
 	var i Auth
 	err := row.Scan(
@@ -50,10 +100,97 @@ func (q *Queries) CreateAuth(ctx context.Context, arg CreateAuthParams) (Auth, e
 		&i.UserAgent,
 		&i.RefreshedAt,
 		&i.CreatedAt,
+		&i.Amr,
+		&i.Acr,
 	)
 	return i, err
 }
 
+const createAuthRevocation = `-- name: CreateAuthRevocation :exec
+INSERT INTO auth_revocations
+  (auth_id, expires_at)
+VALUES
+  ($1, $2)
+ON CONFLICT (auth_id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+`
+
+type CreateAuthRevocationParams struct {
+	AuthID    uuid.UUID `json:"auth_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queries) CreateAuthRevocation(ctx context.Context, arg CreateAuthRevocationParams) error {
+	_, err := q.db.Exec(ctx, createAuthRevocation, arg.AuthID, arg.ExpiresAt)
+	return err
+}
+
+const createCredentials = `-- name: CreateCredentials :one
+INSERT INTO credentials
+  (guid, username, password_hash)
+VALUES
+  ($1, $2, $3)
+RETURNING guid, username, password_hash, created_at, updated_at
+`
+
+type CreateCredentialsParams struct {
+	Guid         string `json:"guid"`
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash"`
+}
+
+func (q *Queries) CreateCredentials(ctx context.Context, arg CreateCredentialsParams) (Credential, error) {
+	row := q.db.QueryRow(ctx, createCredentials, arg.Guid, arg.Username, arg.PasswordHash)
+	var i Credential
+	err := row.Scan(
+		&i.Guid,
+		&i.Username,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (guid, code_hash) VALUES ($1, $2)
+`
+
+type CreateRecoveryCodeParams struct {
+	Guid     string `json:"guid"`
+	CodeHash string `json:"code_hash"`
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.Exec(ctx, createRecoveryCode, arg.Guid, arg.CodeHash)
+	return err
+}
+
+const createWebhookDeadLetter = `-- name: CreateWebhookDeadLetter :exec
+INSERT INTO webhook_dead_letters
+  (guid, auth_id, payload, error, attempts)
+VALUES
+  ($1, $2, $3, $4, $5)
+`
+
+type CreateWebhookDeadLetterParams struct {
+	Guid     string    `json:"guid"`
+	AuthID   uuid.UUID `json:"auth_id"`
+	Payload  []byte    `json:"payload"`
+	Error    string    `json:"error"`
+	Attempts int32     `json:"attempts"`
+}
+
+func (q *Queries) CreateWebhookDeadLetter(ctx context.Context, arg CreateWebhookDeadLetterParams) error {
+	_, err := q.db.Exec(ctx, createWebhookDeadLetter,
+		arg.Guid,
+		arg.AuthID,
+		arg.Payload,
+		arg.Error,
+		arg.Attempts,
+	)
+	return err
+}
+
 const deleteAuthById = `-- name: DeleteAuthById :exec
 DELETE FROM auths WHERE id = $1
 `
@@ -63,8 +200,98 @@ func (q *Queries) DeleteAuthById(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteAuthsByGuid = `-- name: DeleteAuthsByGuid :many
+DELETE FROM auths WHERE guid = $1 RETURNING id
+`
+
+func (q *Queries) DeleteAuthsByGuid(ctx context.Context, guid string) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, deleteAuthsByGuid, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const deleteExpiredAuthRevocations = `-- name: DeleteExpiredAuthRevocations :exec
+DELETE FROM auth_revocations WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredAuthRevocations(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredAuthRevocations)
+	return err
+}
+
+const deleteExpiredMfaChallenges = `-- name: DeleteExpiredMfaChallenges :exec
+DELETE FROM mfa_challenges WHERE expires_at <= NOW()
+`
+
+func (q *Queries) DeleteExpiredMfaChallenges(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteExpiredMfaChallenges)
+	return err
+}
+
+const deleteLoginAttempts = `-- name: DeleteLoginAttempts :exec
+DELETE FROM login_attempts WHERE subject = $1
+`
+
+func (q *Queries) DeleteLoginAttempts(ctx context.Context, subject string) error {
+	_, err := q.db.Exec(ctx, deleteLoginAttempts, subject)
+	return err
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE guid = $1
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, guid string) error {
+	_, err := q.db.Exec(ctx, deleteRecoveryCodes, guid)
+	return err
+}
+
+const deleteRole = `-- name: DeleteRole :execrows
+DELETE FROM roles WHERE name = $1
+`
+
+func (q *Queries) DeleteRole(ctx context.Context, name string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteRole, name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteTotpSecret = `-- name: DeleteTotpSecret :exec
+DELETE FROM totp_secrets WHERE guid = $1
+`
+
+func (q *Queries) DeleteTotpSecret(ctx context.Context, guid string) error {
+	_, err := q.db.Exec(ctx, deleteTotpSecret, guid)
+	return err
+}
+
+const deleteWebhookDeadLetter = `-- name: DeleteWebhookDeadLetter :exec
+DELETE FROM webhook_dead_letters WHERE id = $1
+`
+
+func (q *Queries) DeleteWebhookDeadLetter(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteWebhookDeadLetter, id)
+	return err
+}
+
 const getAuthById = `-- name: GetAuthById :one
-SELECT id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at, created_at FROM auths WHERE id = $1
+SELECT id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at, created_at, amr, acr FROM auths WHERE id = $1
 `
 
 func (q *Queries) GetAuthById(ctx context.Context, id uuid.UUID) (Auth, error) {
@@ -78,20 +305,434 @@ func (q *Queries) GetAuthById(ctx context.Context, id uuid.UUID) (Auth, error) {
 		&i.UserAgent,
 		&i.RefreshedAt,
 		&i.CreatedAt,
+		&i.Amr,
+		&i.Acr,
 	)
 	return i, err
 }
 
-const updateAuthRefreshToken = `-- name: UpdateAuthRefreshToken :exec
-UPDATE auths SET refresh_token_hash = $1, refreshed_at = NOW() WHERE id = $2
+const getCredentialsByGuid = `-- name: GetCredentialsByGuid :one
+SELECT guid, username, password_hash, created_at, updated_at FROM credentials WHERE guid = $1
+`
+
+func (q *Queries) GetCredentialsByGuid(ctx context.Context, guid string) (Credential, error) {
+	row := q.db.QueryRow(ctx, getCredentialsByGuid, guid)
+	var i Credential
+	err := row.Scan(
+		&i.Guid,
+		&i.Username,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getCredentialsByUsername = `-- name: GetCredentialsByUsername :one
+SELECT guid, username, password_hash, created_at, updated_at FROM credentials WHERE username = $1
+`
+
+func (q *Queries) GetCredentialsByUsername(ctx context.Context, username string) (Credential, error) {
+	row := q.db.QueryRow(ctx, getCredentialsByUsername, username)
+	var i Credential
+	err := row.Scan(
+		&i.Guid,
+		&i.Username,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getTotpSecret = `-- name: GetTotpSecret :one
+SELECT guid, secret, confirmed_at, last_used_step, created_at, attempts, locked_until FROM totp_secrets WHERE guid = $1
+`
+
+func (q *Queries) GetTotpSecret(ctx context.Context, guid string) (TotpSecret, error) {
+	row := q.db.QueryRow(ctx, getTotpSecret, guid)
+	var i TotpSecret
+	err := row.Scan(
+		&i.Guid,
+		&i.Secret,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+		&i.CreatedAt,
+		&i.Attempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const listActiveAuthRevocations = `-- name: ListActiveAuthRevocations :many
+SELECT auth_id, expires_at FROM auth_revocations WHERE expires_at > NOW()
+`
+
+func (q *Queries) ListActiveAuthRevocations(ctx context.Context) ([]AuthRevocation, error) {
+	rows, err := q.db.Query(ctx, listActiveAuthRevocations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuthRevocation
+	for rows.Next() {
+		var i AuthRevocation
+		if err := rows.Scan(&i.AuthID, &i.ExpiresAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuthsByGuid = `-- name: ListAuthsByGuid :many
+SELECT id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at, created_at, amr, acr FROM auths WHERE guid = $1 ORDER BY created_at
+`
+
+func (q *Queries) ListAuthsByGuid(ctx context.Context, guid string) ([]Auth, error) {
+	rows, err := q.db.Query(ctx, listAuthsByGuid, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Auth
+	for rows.Next() {
+		var i Auth
+		if err := rows.Scan(
+			&i.ID,
+			&i.Guid,
+			&i.RefreshTokenHash,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.RefreshedAt,
+			&i.CreatedAt,
+			&i.Amr,
+			&i.Acr,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRoles = `-- name: ListRoles :many
+SELECT name, scopes, created_at FROM roles ORDER BY name
+`
+
+func (q *Queries) ListRoles(ctx context.Context) ([]Role, error) {
+	rows, err := q.db.Query(ctx, listRoles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Role
+	for rows.Next() {
+		var i Role
+		if err := rows.Scan(&i.Name, &i.Scopes, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRolesByGuid = `-- name: ListRolesByGuid :many
+SELECT roles.name, roles.scopes, roles.created_at FROM roles
+  JOIN user_roles ON user_roles.role = roles.name
+WHERE user_roles.guid = $1
+ORDER BY roles.name
+`
+
+func (q *Queries) ListRolesByGuid(ctx context.Context, guid string) ([]Role, error) {
+	rows, err := q.db.Query(ctx, listRolesByGuid, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Role
+	for rows.Next() {
+		var i Role
+		if err := rows.Scan(&i.Name, &i.Scopes, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookDeadLetters = `-- name: ListWebhookDeadLetters :many
+SELECT id, guid, auth_id, payload, error, attempts, created_at FROM webhook_dead_letters ORDER BY id LIMIT $1
+`
+
+func (q *Queries) ListWebhookDeadLetters(ctx context.Context, limit int32) ([]WebhookDeadLetter, error) {
+	rows, err := q.db.Query(ctx, listWebhookDeadLetters, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDeadLetter
+	for rows.Next() {
+		var i WebhookDeadLetter
+		if err := rows.Scan(
+			&i.ID,
+			&i.Guid,
+			&i.AuthID,
+			&i.Payload,
+			&i.Error,
+			&i.Attempts,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const resetTotpAttempts = `-- name: ResetTotpAttempts :exec
+UPDATE totp_secrets SET attempts = 0, locked_until = NULL WHERE guid = $1
+`
+
+func (q *Queries) ResetTotpAttempts(ctx context.Context, guid string) error {
+	_, err := q.db.Exec(ctx, resetTotpAttempts, guid)
+	return err
+}
+
+const startLoginAttempt = `-- name: StartLoginAttempt :execrows
+INSERT INTO login_attempts
+  (subject, attempts, locked_until)
+VALUES
+  ($1, 1, CASE WHEN $2::INT <= 1 THEN $3::TIMESTAMPTZ END)
+ON CONFLICT (subject) DO UPDATE
+  SET
+    attempts = login_attempts.attempts + 1,
+    locked_until = CASE WHEN login_attempts.attempts + 1 >= $2::INT THEN $3::TIMESTAMPTZ END
+  WHERE login_attempts.locked_until IS NULL OR login_attempts.locked_until <= $4::TIMESTAMPTZ
+`
+
+type StartLoginAttemptParams struct {
+	Subject     string    `json:"subject"`
+	MaxAttempts int32     `json:"max_attempts"`
+	LockedUntil time.Time `json:"locked_until"`
+	Now         time.Time `json:"now"`
+}
+
+func (q *Queries) StartLoginAttempt(ctx context.Context, arg StartLoginAttemptParams) (int64, error) {
+	result, err := q.db.Exec(ctx, startLoginAttempt,
+		arg.Subject,
+		arg.MaxAttempts,
+		arg.LockedUntil,
+		arg.Now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const startMfaChallengeAttempt = `-- name: StartMfaChallengeAttempt :execrows
+INSERT INTO mfa_challenges
+  (id, guid, attempts, expires_at)
+VALUES
+  ($1, $2, 1, $3)
+ON CONFLICT (id) DO UPDATE
+  SET attempts = mfa_challenges.attempts + 1
+  WHERE mfa_challenges.consumed_at IS NULL AND mfa_challenges.attempts < $4::INT
+`
+
+type StartMfaChallengeAttemptParams struct {
+	ID          uuid.UUID `json:"id"`
+	Guid        string    `json:"guid"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	MaxAttempts int32     `json:"max_attempts"`
+}
+
+func (q *Queries) StartMfaChallengeAttempt(ctx context.Context, arg StartMfaChallengeAttemptParams) (int64, error) {
+	result, err := q.db.Exec(ctx, startMfaChallengeAttempt,
+		arg.ID,
+		arg.Guid,
+		arg.ExpiresAt,
+		arg.MaxAttempts,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const startTotpAttempt = `-- name: StartTotpAttempt :execrows
+UPDATE totp_secrets SET
+  attempts = attempts + 1,
+  locked_until = CASE WHEN attempts + 1 >= $1::INT THEN $2::TIMESTAMPTZ ELSE NULL END
+WHERE guid = $3 AND (locked_until IS NULL OR locked_until <= $4::TIMESTAMPTZ)
+`
+
+type StartTotpAttemptParams struct {
+	MaxAttempts int32     `json:"max_attempts"`
+	LockedUntil time.Time `json:"locked_until"`
+	Guid        string    `json:"guid"`
+	Now         time.Time `json:"now"`
+}
+
+func (q *Queries) StartTotpAttempt(ctx context.Context, arg StartTotpAttemptParams) (int64, error) {
+	result, err := q.db.Exec(ctx, startTotpAttempt,
+		arg.MaxAttempts,
+		arg.LockedUntil,
+		arg.Guid,
+		arg.Now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const unassignRole = `-- name: UnassignRole :execrows
+DELETE FROM user_roles WHERE guid = $1 AND role = $2
+`
+
+type UnassignRoleParams struct {
+	Guid string `json:"guid"`
+	Role string `json:"role"`
+}
+
+func (q *Queries) UnassignRole(ctx context.Context, arg UnassignRoleParams) (int64, error) {
+	result, err := q.db.Exec(ctx, unassignRole, arg.Guid, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateAuthRefreshToken = `-- name: UpdateAuthRefreshToken :execrows
+UPDATE auths SET refresh_token_hash = $1, refreshed_at = $2
+WHERE id = $3 AND refresh_token_hash = $4
 `
 
 type UpdateAuthRefreshTokenParams struct {
-	RefreshTokenHash string    `json:"refresh_token_hash"`
-	ID               uuid.UUID `json:"id"`
+	RefreshTokenHash    string    `json:"refresh_token_hash"`
+	RefreshedAt         time.Time `json:"refreshed_at"`
+	ID                  uuid.UUID `json:"id"`
+	OldRefreshTokenHash string    `json:"old_refresh_token_hash"`
+}
+
+func (q *Queries) UpdateAuthRefreshToken(ctx context.Context, arg UpdateAuthRefreshTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateAuthRefreshToken,
+		arg.RefreshTokenHash,
+		arg.RefreshedAt,
+		arg.ID,
+		arg.OldRefreshTokenHash,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateCredentialsPasswordHash = `-- name: UpdateCredentialsPasswordHash :exec
+UPDATE credentials SET password_hash = $1, updated_at = NOW() WHERE guid = $2
+`
+
+type UpdateCredentialsPasswordHashParams struct {
+	PasswordHash string `json:"password_hash"`
+	Guid         string `json:"guid"`
 }
 
-func (q *Queries) UpdateAuthRefreshToken(ctx context.Context, arg UpdateAuthRefreshTokenParams) error {
-	_, err := q.db.Exec(ctx, updateAuthRefreshToken, arg.RefreshTokenHash, arg.ID)
+func (q *Queries) UpdateCredentialsPasswordHash(ctx context.Context, arg UpdateCredentialsPasswordHashParams) error {
+	_, err := q.db.Exec(ctx, updateCredentialsPasswordHash, arg.PasswordHash, arg.Guid)
 	return err
 }
+
+const updateTotpLastUsedStep = `-- name: UpdateTotpLastUsedStep :execrows
+UPDATE totp_secrets SET last_used_step = $2 WHERE guid = $1 AND last_used_step < $2
+`
+
+type UpdateTotpLastUsedStepParams struct {
+	Guid         string `json:"guid"`
+	LastUsedStep int64  `json:"last_used_step"`
+}
+
+func (q *Queries) UpdateTotpLastUsedStep(ctx context.Context, arg UpdateTotpLastUsedStepParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateTotpLastUsedStep, arg.Guid, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const upsertRole = `-- name: UpsertRole :one
+INSERT INTO roles
+  (name, scopes)
+VALUES
+  ($1, $2)
+ON CONFLICT (name) DO UPDATE SET scopes = EXCLUDED.scopes
+RETURNING name, scopes, created_at
+`
+
+type UpsertRoleParams struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func (q *Queries) UpsertRole(ctx context.Context, arg UpsertRoleParams) (Role, error) {
+	row := q.db.QueryRow(ctx, upsertRole, arg.Name, arg.Scopes)
+	var i Role
+	err := row.Scan(&i.Name, &i.Scopes, &i.CreatedAt)
+	return i, err
+}
+
+const upsertUnconfirmedTotpSecret = `-- name: UpsertUnconfirmedTotpSecret :execrows
+INSERT INTO totp_secrets
+  (guid, secret)
+VALUES
+  ($1, $2)
+ON CONFLICT (guid) DO UPDATE
+  SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+  WHERE totp_secrets.confirmed_at IS NULL
+`
+
+type UpsertUnconfirmedTotpSecretParams struct {
+	Guid   string `json:"guid"`
+	Secret string `json:"secret"`
+}
+
+func (q *Queries) UpsertUnconfirmedTotpSecret(ctx context.Context, arg UpsertUnconfirmedTotpSecretParams) (int64, error) {
+	result, err := q.db.Exec(ctx, upsertUnconfirmedTotpSecret, arg.Guid, arg.Secret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = NOW() WHERE guid = $1 AND code_hash = $2 AND used_at IS NULL
+`
+
+type UseRecoveryCodeParams struct {
+	Guid     string `json:"guid"`
+	CodeHash string `json:"code_hash"`
+}
+
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, useRecoveryCode, arg.Guid, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"github.com/google/uuid"
+	"time"
 
 	"github.com/kwinso/medods-test-task/internal/db"
 )
@@ -11,7 +12,15 @@ type AuthRepository interface {
 	CreateAuth(ctx context.Context, auth db.CreateAuthParams) (db.Auth, error)
 	GetAuthById(ctx context.Context, id uuid.UUID) (db.Auth, error)
 	DeleteAuthById(ctx context.Context, id uuid.UUID) error
-	UpdateAuthRefreshToken(ctx context.Context, id uuid.UUID, refreshToken string) error
+	// UpdateAuthRefreshToken replaces the refresh token hash of the session and sets the time it was refreshed at.
+	// The hash is only replaced if it's still oldRefreshToken, so a refresh token can't be used twice, even if it was
+	// read from a stale cache or by a concurrent refresh. Otherwise, or if the session is gone, returns ErrAuthChanged.
+	UpdateAuthRefreshToken(ctx context.Context, id uuid.UUID, oldRefreshToken, refreshToken string, refreshedAt time.Time) error
+	ListAuthsByGuid(ctx context.Context, guid string) ([]db.Auth, error)
+	// DeleteAuthsByGuid deletes all sessions of the GUID and returns their IDs
+	DeleteAuthsByGuid(ctx context.Context, guid string) ([]uuid.UUID, error)
+	// CountAuthsRefreshedSince counts the sessions refreshed after the given time
+	CountAuthsRefreshedSince(ctx context.Context, since time.Time) (int64, error)
 }
 
 type pgxAuthRepository struct {
@@ -36,9 +45,30 @@ func (r *pgxAuthRepository) DeleteAuthById(ctx context.Context, id uuid.UUID) er
 	return r.queries.DeleteAuthById(ctx, id)
 }
 
-func (r *pgxAuthRepository) UpdateAuthRefreshToken(ctx context.Context, id uuid.UUID, refreshToken string) error {
-	return r.queries.UpdateAuthRefreshToken(ctx, db.UpdateAuthRefreshTokenParams{
-		ID:               id,
-		RefreshTokenHash: refreshToken,
+func (r *pgxAuthRepository) UpdateAuthRefreshToken(ctx context.Context, id uuid.UUID, oldRefreshToken, refreshToken string, refreshedAt time.Time) error {
+	updated, err := r.queries.UpdateAuthRefreshToken(ctx, db.UpdateAuthRefreshTokenParams{
+		ID:                  id,
+		OldRefreshTokenHash: oldRefreshToken,
+		RefreshTokenHash:    refreshToken,
+		RefreshedAt:         refreshedAt,
 	})
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrAuthChanged
+	}
+	return nil
+}
+
+func (r *pgxAuthRepository) ListAuthsByGuid(ctx context.Context, guid string) ([]db.Auth, error) {
+	return r.queries.ListAuthsByGuid(ctx, guid)
+}
+
+func (r *pgxAuthRepository) DeleteAuthsByGuid(ctx context.Context, guid string) ([]uuid.UUID, error) {
+	return r.queries.DeleteAuthsByGuid(ctx, guid)
+}
+
+func (r *pgxAuthRepository) CountAuthsRefreshedSince(ctx context.Context, since time.Time) (int64, error) {
+	return r.queries.CountAuthsRefreshedSince(ctx, since)
 }
@@ -0,0 +1,434 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/redis/go-redis/v9"
+)
+
+// authRepositoryBackends create an empty repository of every backend. Postgres is only tested if AUTH_TEST_DB_URL is set,
+// the database is migrated and its sessions are deleted.
+var authRepositoryBackends = map[string]func(t *testing.T) AuthRepository{
+	"memory": func(t *testing.T) AuthRepository {
+		return NewMemoryAuthRepository(tokens.NewSystemClock())
+	},
+	"sqlite": func(t *testing.T) AuthRepository {
+		conn, err := db.OpenSQLite(filepath.Join(t.TempDir(), "auth.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return NewSQLiteAuthRepository(conn, tokens.NewSystemClock())
+	},
+	"sqlite in memory": func(t *testing.T) AuthRepository {
+		conn, err := db.OpenSQLite(":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return NewSQLiteAuthRepository(conn, tokens.NewSystemClock())
+	},
+	"cached": func(t *testing.T) AuthRepository {
+		return NewCachedAuthRepository(NewMemoryAuthRepository(tokens.NewSystemClock()), nil, AuthCacheConfig{
+			Size:        100,
+			TTL:         time.Minute,
+			NegativeTTL: time.Minute,
+		}, tokens.NewSystemClock(), logging.Discard())
+	},
+	"redis": func(t *testing.T) AuthRepository {
+		repo, _ := newTestRedisAuthRepository(t, 24*time.Hour)
+		return repo
+	},
+	"postgres": func(t *testing.T) AuthRepository {
+		dbUrl := os.Getenv("AUTH_TEST_DB_URL")
+		if dbUrl == "" {
+			t.Skip("AUTH_TEST_DB_URL is not set")
+		}
+		if _, err := db.ApplyMigrations(dbUrl, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		pool, err := pgxpool.New(context.Background(), dbUrl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(pool.Close)
+		if _, err := pool.Exec(context.Background(), "DELETE FROM auths"); err != nil {
+			t.Fatal(err)
+		}
+		return NewPgxAuthRepository(pool)
+	},
+}
+
+func TestAuthRepositoryConformance(t *testing.T) {
+	cases := map[string]func(t *testing.T, repo AuthRepository){
+		"create and get":                 testCreateAndGetAuth,
+		"get missing":                    testGetMissingAuth,
+		"create duplicate":               testCreateDuplicateAuth,
+		"update refresh token":           testUpdateAuthRefreshToken,
+		"delete by id":                   testDeleteAuthById,
+		"list by guid":                   testListAuthsByGuid,
+		"delete by guid":                 testDeleteAuthsByGuid,
+		"count refreshed since":          testCountAuthsRefreshedSince,
+		"returned auths are independent": testReturnedAuthsAreIndependent,
+	}
+
+	for backend, newRepo := range authRepositoryBackends {
+		t.Run(backend, func(t *testing.T) {
+			for name, test := range cases {
+				t.Run(name, func(t *testing.T) {
+					test(t, newRepo(t))
+				})
+			}
+		})
+	}
+}
+
+func newAuthParams(guid string) db.CreateAuthParams {
+	id := uuid.New()
+	return db.CreateAuthParams{
+		ID:               id,
+		Guid:             guid,
+		RefreshTokenHash: "hash-" + id.String(),
+		IpAddress:        netip.MustParseAddr("203.0.113.7"),
+		UserAgent:        "conformance/1.0",
+		RefreshedAt:      time.Now().Add(-time.Minute).Round(time.Microsecond),
+		Amr:              []string{"pwd", "otp"},
+		Acr:              "aal2",
+	}
+}
+
+func mustCreateAuth(t *testing.T, repo AuthRepository, params db.CreateAuthParams) db.Auth {
+	t.Helper()
+	auth, err := repo.CreateAuth(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func assertAuthMatches(t *testing.T, auth db.Auth, params db.CreateAuthParams) {
+	t.Helper()
+	if auth.ID != params.ID || auth.Guid != params.Guid || auth.RefreshTokenHash != params.RefreshTokenHash ||
+		auth.IpAddress != params.IpAddress || auth.UserAgent != params.UserAgent || auth.Acr != params.Acr {
+		t.Errorf("expected auth to match %+v, got %+v", params, auth)
+	}
+	if !slices.Equal(auth.Amr, params.Amr) {
+		t.Errorf("expected AMR %v, got %v", params.Amr, auth.Amr)
+	}
+	if !auth.RefreshedAt.Equal(params.RefreshedAt) {
+		t.Errorf("expected refreshed at %v, got %v", params.RefreshedAt, auth.RefreshedAt)
+	}
+	if time.Since(auth.CreatedAt).Abs() > time.Minute {
+		t.Errorf("expected created at to be about now, got %v", auth.CreatedAt)
+	}
+}
+
+func testCreateAndGetAuth(t *testing.T, repo AuthRepository) {
+	ctx := context.Background()
+
+	params := newAuthParams(uuid.NewString())
+	created := mustCreateAuth(t, repo, params)
+	assertAuthMatches(t, created, params)
+
+	got, err := repo.GetAuthById(ctx, params.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertAuthMatches(t, got, params)
+	if !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("expected created at %v, got %v", created.CreatedAt, got.CreatedAt)
+	}
+
+	ipv6 := newAuthParams(uuid.NewString())
+	ipv6.IpAddress = netip.MustParseAddr("2001:db8::1")
+	ipv6.Amr = []string{}
+	mustCreateAuth(t, repo, ipv6)
+
+	got, err = repo.GetAuthById(ctx, ipv6.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IpAddress != ipv6.IpAddress {
+		t.Errorf("expected IP %v, got %v", ipv6.IpAddress, got.IpAddress)
+	}
+	if len(got.Amr) != 0 {
+		t.Errorf("expected empty AMR, got %v", got.Amr)
+	}
+}
+
+func testGetMissingAuth(t *testing.T, repo AuthRepository) {
+	_, err := repo.GetAuthById(context.Background(), uuid.New())
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testCreateDuplicateAuth(t *testing.T, repo AuthRepository) {
+	params := newAuthParams(uuid.NewString())
+	mustCreateAuth(t, repo, params)
+
+	sameId := newAuthParams(params.Guid)
+	sameId.ID = params.ID
+	if _, err := repo.CreateAuth(context.Background(), sameId); err == nil {
+		t.Error("expected an error for a duplicate ID")
+	}
+
+	sameHash := newAuthParams(params.Guid)
+	sameHash.RefreshTokenHash = params.RefreshTokenHash
+	if _, err := repo.CreateAuth(context.Background(), sameHash); err == nil {
+		t.Error("expected an error for a duplicate refresh token hash")
+	}
+}
+
+func testUpdateAuthRefreshToken(t *testing.T, repo AuthRepository) {
+	ctx := context.Background()
+
+	params := newAuthParams(uuid.NewString())
+	mustCreateAuth(t, repo, params)
+
+	refreshedAt := time.Now().Round(time.Microsecond)
+	if err := repo.UpdateAuthRefreshToken(ctx, params.ID, params.RefreshTokenHash, "new-hash-"+params.ID.String(), refreshedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := repo.GetAuthById(ctx, params.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RefreshTokenHash != "new-hash-"+params.ID.String() {
+		t.Errorf("expected the new hash, got %q", got.RefreshTokenHash)
+	}
+	if !got.RefreshedAt.Equal(refreshedAt) {
+		t.Errorf("expected refreshed at %v, got %v", refreshedAt, got.RefreshedAt)
+	}
+
+	// the old hash was replaced, so the same refresh can't happen twice
+	err = repo.UpdateAuthRefreshToken(ctx, params.ID, params.RefreshTokenHash, "reused-hash-"+params.ID.String(), time.Now())
+	if !errors.Is(err, ErrAuthChanged) {
+		t.Errorf("expected %v for a replaced hash, got %v", ErrAuthChanged, err)
+	}
+	got, err = repo.GetAuthById(ctx, params.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RefreshTokenHash != "new-hash-"+params.ID.String() || !got.RefreshedAt.Equal(refreshedAt) {
+		t.Errorf("expected the failed update to keep the session, got %+v", got)
+	}
+
+	err = repo.UpdateAuthRefreshToken(ctx, uuid.New(), "hash", "missing-"+params.ID.String(), refreshedAt)
+	if !errors.Is(err, ErrAuthChanged) {
+		t.Errorf("expected %v for a missing auth, got %v", ErrAuthChanged, err)
+	}
+}
+
+func testDeleteAuthById(t *testing.T, repo AuthRepository) {
+	ctx := context.Background()
+
+	deleted := newAuthParams(uuid.NewString())
+	kept := newAuthParams(deleted.Guid)
+	mustCreateAuth(t, repo, deleted)
+	mustCreateAuth(t, repo, kept)
+
+	// read it first, so a cache would have it
+	if _, err := repo.GetAuthById(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.DeleteAuthById(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.GetAuthById(ctx, deleted.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the deleted auth to be gone, got %v", err)
+	}
+	if _, err := repo.GetAuthById(ctx, kept.ID); err != nil {
+		t.Errorf("expected the other auth to be kept, got %v", err)
+	}
+	if err := repo.DeleteAuthById(ctx, deleted.ID); err != nil {
+		t.Errorf("expected deleting a missing auth to be a no-op, got %v", err)
+	}
+}
+
+func testListAuthsByGuid(t *testing.T, repo AuthRepository) {
+	ctx := context.Background()
+	guid := uuid.NewString()
+
+	var expected []uuid.UUID
+	for range 3 {
+		params := newAuthParams(guid)
+		mustCreateAuth(t, repo, params)
+		expected = append(expected, params.ID)
+		// created_at has microsecond precision
+		time.Sleep(time.Millisecond)
+	}
+	mustCreateAuth(t, repo, newAuthParams(uuid.NewString()))
+
+	auths, err := repo.ListAuthsByGuid(ctx, guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []uuid.UUID
+	for _, auth := range auths {
+		ids = append(ids, auth.ID)
+	}
+	if !slices.Equal(ids, expected) {
+		t.Errorf("expected sessions %v in creation order, got %v", expected, ids)
+	}
+
+	auths, err = repo.ListAuthsByGuid(ctx, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(auths) != 0 {
+		t.Errorf("expected no sessions for an unknown GUID, got %v", auths)
+	}
+}
+
+func testDeleteAuthsByGuid(t *testing.T, repo AuthRepository) {
+	ctx := context.Background()
+	guid := uuid.NewString()
+
+	var expected []uuid.UUID
+	for range 2 {
+		params := newAuthParams(guid)
+		mustCreateAuth(t, repo, params)
+		expected = append(expected, params.ID)
+		if _, err := repo.GetAuthById(ctx, params.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other := newAuthParams(uuid.NewString())
+	mustCreateAuth(t, repo, other)
+
+	ids, err := repo.DeleteAuthsByGuid(ctx, guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(ids, compareUUIDs)
+	slices.SortFunc(expected, compareUUIDs)
+	if !slices.Equal(ids, expected) {
+		t.Errorf("expected deleted sessions %v, got %v", expected, ids)
+	}
+
+	for _, id := range expected {
+		if _, err := repo.GetAuthById(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("expected session %s to be gone, got %v", id, err)
+		}
+	}
+	if _, err := repo.GetAuthById(ctx, other.ID); err != nil {
+		t.Errorf("expected the session of another GUID to be kept, got %v", err)
+	}
+
+	ids, err = repo.DeleteAuthsByGuid(ctx, guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("expected nothing to delete, got %v", ids)
+	}
+}
+
+func testCountAuthsRefreshedSince(t *testing.T, repo AuthRepository) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, age := range []time.Duration{2 * time.Hour, 30 * time.Minute, time.Minute} {
+		params := newAuthParams(uuid.NewString())
+		params.RefreshedAt = now.Add(-age).Round(time.Microsecond)
+		mustCreateAuth(t, repo, params)
+	}
+
+	for since, expected := range map[time.Duration]int64{
+		3 * time.Hour:    3,
+		time.Hour:        2,
+		10 * time.Minute: 1,
+		0:                0,
+	} {
+		count, err := repo.CountAuthsRefreshedSince(ctx, now.Add(-since))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Errorf("expected %d sessions refreshed in the last %s, got %d", expected, since, count)
+		}
+	}
+}
+
+func testReturnedAuthsAreIndependent(t *testing.T, repo AuthRepository) {
+	ctx := context.Background()
+
+	params := newAuthParams(uuid.NewString())
+	created := mustCreateAuth(t, repo, params)
+	created.Amr[0] = "modified"
+
+	got, err := repo.GetAuthById(ctx, params.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Amr[0] = "modified"
+
+	got, err = repo.GetAuthById(ctx, params.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.Amr, params.Amr) {
+		t.Errorf("expected the stored AMR %v to be unaffected, got %v", params.Amr, got.Amr)
+	}
+}
+
+func compareUUIDs(a, b uuid.UUID) int {
+	return slices.Compare(a[:], b[:])
+}
+
+func TestAuthRepositoryCreatedAtUsesClock(t *testing.T) {
+	clock := &testClock{now: time.Date(2030, 1, 2, 3, 4, 5, 6000, time.UTC)}
+	backends := map[string]func(t *testing.T) AuthRepository{
+		"memory": func(t *testing.T) AuthRepository {
+			return NewMemoryAuthRepository(clock)
+		},
+		"sqlite": func(t *testing.T) AuthRepository {
+			conn, err := db.OpenSQLite(":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { conn.Close() })
+			return NewSQLiteAuthRepository(conn, clock)
+		},
+		"redis": func(t *testing.T) AuthRepository {
+			client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+			t.Cleanup(func() { client.Close() })
+			return NewRedisAuthRepository(client, config.NewStore(&config.Config{AuthTTL: time.Hour}), clock)
+		},
+	}
+
+	for backend, newRepo := range backends {
+		t.Run(backend, func(t *testing.T) {
+			repo := newRepo(t)
+			params := newAuthParams(uuid.NewString())
+			mustCreateAuth(t, repo, params)
+
+			auth, err := repo.GetAuthById(context.Background(), params.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !auth.CreatedAt.Equal(clock.Now()) {
+				t.Errorf("expected created at %v, got %v", clock.Now(), auth.CreatedAt)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package repositories
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+// AuthChangesChannel is the Postgres channel that gets the ID of every updated or deleted auth
+const AuthChangesChannel = "auth_changes"
+
+const authCacheRetryInterval = 5 * time.Second
+
+// CachedAuthRepository is an AuthRepository that keeps recently read sessions in memory
+type CachedAuthRepository interface {
+	AuthRepository
+	// Run evicts sessions changed by other instances until ctx is done
+	Run(ctx context.Context)
+}
+
+// AuthCacheConfig configures CachedAuthRepository
+type AuthCacheConfig struct {
+	// Size is the maximum number of cached sessions. The least recently used ones are evicted first
+	Size int
+	// TTL bounds how long a session is served from the cache, in case an eviction notification is lost
+	TTL time.Duration
+	// NegativeTTL is how long a missing session is remembered
+	NegativeTTL time.Duration
+}
+
+type authCacheEntry struct {
+	id        uuid.UUID
+	auth      db.Auth
+	err       error
+	expiresAt time.Time
+}
+
+type cachedAuthRepository struct {
+	repo     AuthRepository
+	listener db.Listener
+	cfg      AuthCacheConfig
+	clock    tokens.Clock
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	entries map[uuid.UUID]*list.Element
+	lru     *list.List
+	// generation changes on every eviction, so a read that raced with a write doesn't cache the old session
+	generation uint64
+}
+
+// NewCachedAuthRepository wraps the repo with a bounded LRU cache for GetAuthById.
+// If listener is nil, sessions changed by other instances are served from the cache until the TTL passes.
+// Entries expire by the time of clock.
+func NewCachedAuthRepository(repo AuthRepository, listener db.Listener, cfg AuthCacheConfig, clock tokens.Clock, logger *slog.Logger) CachedAuthRepository {
+	return &cachedAuthRepository{
+		repo:     repo,
+		listener: listener,
+		cfg:      cfg,
+		clock:    clock,
+		logger:   logger,
+		entries:  make(map[uuid.UUID]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (r *cachedAuthRepository) CreateAuth(ctx context.Context, auth db.CreateAuthParams) (db.Auth, error) {
+	created, err := r.repo.CreateAuth(ctx, auth)
+	if err != nil {
+		return created, err
+	}
+
+	r.evict(created.ID)
+	return created, nil
+}
+
+func (r *cachedAuthRepository) GetAuthById(ctx context.Context, id uuid.UUID) (db.Auth, error) {
+	if auth, err, ok := r.get(id); ok {
+		return cloneAuth(auth), err
+	}
+
+	generation := r.currentGeneration()
+	auth, err := r.repo.GetAuthById(ctx, id)
+	switch {
+	case err == nil:
+		r.put(generation, id, cloneAuth(auth), nil, r.cfg.TTL)
+	case errors.Is(err, sql.ErrNoRows):
+		r.put(generation, id, auth, err, r.cfg.NegativeTTL)
+	}
+
+	return auth, err
+}
+
+func (r *cachedAuthRepository) DeleteAuthById(ctx context.Context, id uuid.UUID) error {
+	err := r.repo.DeleteAuthById(ctx, id)
+	r.evict(id)
+	return err
+}
+
+func (r *cachedAuthRepository) UpdateAuthRefreshToken(ctx context.Context, id uuid.UUID, oldRefreshToken, refreshToken string, refreshedAt time.Time) error {
+	err := r.repo.UpdateAuthRefreshToken(ctx, id, oldRefreshToken, refreshToken, refreshedAt)
+	r.evict(id)
+	return err
+}
+
+func (r *cachedAuthRepository) ListAuthsByGuid(ctx context.Context, guid string) ([]db.Auth, error) {
+	return r.repo.ListAuthsByGuid(ctx, guid)
+}
+
+func (r *cachedAuthRepository) DeleteAuthsByGuid(ctx context.Context, guid string) ([]uuid.UUID, error) {
+	ids, err := r.repo.DeleteAuthsByGuid(ctx, guid)
+	for _, id := range ids {
+		r.evict(id)
+	}
+	return ids, err
+}
+
+func (r *cachedAuthRepository) CountAuthsRefreshedSince(ctx context.Context, since time.Time) (int64, error) {
+	return r.repo.CountAuthsRefreshedSince(ctx, since)
+}
+
+func (r *cachedAuthRepository) Run(ctx context.Context) {
+	if r.listener == nil {
+		return
+	}
+
+	for {
+		err := r.sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.WarnContext(ctx, "Session cache sync failed, retrying", "retry_in", authCacheRetryInterval, logging.Err(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(authCacheRetryInterval):
+		}
+	}
+}
+
+// sync subscribes to the changes channel and then drops the whole cache, since notifications may have been missed
+func (r *cachedAuthRepository) sync(ctx context.Context) error {
+	sub, err := r.listener.Subscribe(ctx, AuthChangesChannel)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	r.purge()
+
+	for {
+		payload, err := sub.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		id, err := uuid.Parse(payload)
+		if err != nil {
+			r.logger.WarnContext(ctx, "Ignoring malformed auth change notification", "payload", payload)
+			continue
+		}
+		r.evict(id)
+	}
+}
+
+func (r *cachedAuthRepository) get(id uuid.UUID) (db.Auth, error, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	element, ok := r.entries[id]
+	if !ok {
+		return db.Auth{}, nil, false
+	}
+
+	entry := element.Value.(*authCacheEntry)
+	if r.clock.Now().After(entry.expiresAt) {
+		r.lru.Remove(element)
+		delete(r.entries, id)
+		return db.Auth{}, nil, false
+	}
+
+	r.lru.MoveToFront(element)
+	return entry.auth, entry.err, true
+}
+
+func (r *cachedAuthRepository) currentGeneration() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.generation
+}
+
+func (r *cachedAuthRepository) put(generation uint64, id uuid.UUID, auth db.Auth, err error, ttl time.Duration) {
+	if r.cfg.Size <= 0 || ttl <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if generation != r.generation {
+		return
+	}
+
+	entry := &authCacheEntry{
+		id:        id,
+		auth:      auth,
+		err:       err,
+		expiresAt: r.clock.Now().Add(ttl),
+	}
+
+	if element, ok := r.entries[id]; ok {
+		element.Value = entry
+		r.lru.MoveToFront(element)
+		return
+	}
+
+	r.entries[id] = r.lru.PushFront(entry)
+	for r.lru.Len() > r.cfg.Size {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.entries, oldest.Value.(*authCacheEntry).id)
+	}
+}
+
+func (r *cachedAuthRepository) evict(id uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+	if element, ok := r.entries[id]; ok {
+		r.lru.Remove(element)
+		delete(r.entries, id)
+	}
+}
+
+func (r *cachedAuthRepository) purge() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.generation++
+	r.entries = make(map[uuid.UUID]*list.Element)
+	r.lru.Init()
+}
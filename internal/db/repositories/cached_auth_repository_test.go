@@ -0,0 +1,205 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+// testClock is a Clock that only moves when advanced
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// countingAuthRepository counts the reads that reach the underlying repository
+type countingAuthRepository struct {
+	AuthRepository
+	reads atomic.Int32
+}
+
+func (r *countingAuthRepository) GetAuthById(ctx context.Context, id uuid.UUID) (db.Auth, error) {
+	r.reads.Add(1)
+	return r.AuthRepository.GetAuthById(ctx, id)
+}
+
+// channelListener delivers the payloads sent to notifications to every subscription
+type channelListener struct {
+	notifications chan string
+	subscribed    chan struct{}
+}
+
+func (l *channelListener) Subscribe(context.Context, string) (db.Subscription, error) {
+	l.subscribed <- struct{}{}
+	return l, nil
+}
+
+func (l *channelListener) Next(ctx context.Context) (string, error) {
+	select {
+	case payload := <-l.notifications:
+		return payload, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (l *channelListener) Close() {}
+
+func TestCachedAuthRepository(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  AuthCacheConfig
+		// run reads and changes the sessions and returns the number of reads expected to reach the repository
+		run func(t *testing.T, cache, other AuthRepository, clock *testClock, params []db.CreateAuthParams) int32
+	}{
+		{"repeated reads are cached", AuthCacheConfig{Size: 10, TTL: time.Minute}, func(t *testing.T, cache, _ AuthRepository, clock *testClock, params []db.CreateAuthParams) int32 {
+			mustGetAuth(t, cache, params[0].ID)
+			mustGetAuth(t, cache, params[0].ID)
+			return 1
+		}},
+		{"least recently used is evicted", AuthCacheConfig{Size: 2, TTL: time.Minute}, func(t *testing.T, cache, _ AuthRepository, clock *testClock, params []db.CreateAuthParams) int32 {
+			mustGetAuth(t, cache, params[0].ID)
+			mustGetAuth(t, cache, params[1].ID)
+			mustGetAuth(t, cache, params[0].ID)
+			mustGetAuth(t, cache, params[2].ID)
+			// the second session was used least recently, the first one is still cached
+			mustGetAuth(t, cache, params[0].ID)
+			mustGetAuth(t, cache, params[1].ID)
+			return 4
+		}},
+		{"entries expire", AuthCacheConfig{Size: 10, TTL: 20 * time.Millisecond}, func(t *testing.T, cache, _ AuthRepository, clock *testClock, params []db.CreateAuthParams) int32 {
+			mustGetAuth(t, cache, params[0].ID)
+			clock.Advance(30 * time.Millisecond)
+			mustGetAuth(t, cache, params[0].ID)
+			return 2
+		}},
+		{"missing session is remembered", AuthCacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: time.Minute}, func(t *testing.T, cache, _ AuthRepository, clock *testClock, _ []db.CreateAuthParams) int32 {
+			id := uuid.New()
+			assertAuthMissing(t, cache, id)
+			assertAuthMissing(t, cache, id)
+			return 1
+		}},
+		{"missing session expires", AuthCacheConfig{Size: 10, TTL: time.Minute, NegativeTTL: 20 * time.Millisecond}, func(t *testing.T, cache, other AuthRepository, clock *testClock, _ []db.CreateAuthParams) int32 {
+			params := newAuthParams(uuid.NewString())
+			assertAuthMissing(t, cache, params.ID)
+			// created by another instance, so this cache isn't told about it
+			mustCreateAuth(t, other, params)
+			assertAuthMissing(t, cache, params.ID)
+
+			clock.Advance(30 * time.Millisecond)
+			mustGetAuth(t, cache, params.ID)
+			return 2
+		}},
+		{"negative ttl 0 disables negative caching", AuthCacheConfig{Size: 10, TTL: time.Minute}, func(t *testing.T, cache, _ AuthRepository, clock *testClock, _ []db.CreateAuthParams) int32 {
+			id := uuid.New()
+			assertAuthMissing(t, cache, id)
+			assertAuthMissing(t, cache, id)
+			return 2
+		}},
+		{"own writes evict", AuthCacheConfig{Size: 10, TTL: time.Minute}, func(t *testing.T, cache, _ AuthRepository, clock *testClock, params []db.CreateAuthParams) int32 {
+			ctx := context.Background()
+			mustGetAuth(t, cache, params[0].ID)
+			if err := cache.UpdateAuthRefreshToken(ctx, params[0].ID, params[0].RefreshTokenHash, "rotated", time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if auth := mustGetAuth(t, cache, params[0].ID); auth.RefreshTokenHash != "rotated" {
+				t.Errorf("expected the rotated hash, got %q", auth.RefreshTokenHash)
+			}
+
+			if err := cache.DeleteAuthById(ctx, params[0].ID); err != nil {
+				t.Fatal(err)
+			}
+			assertAuthMissing(t, cache, params[0].ID)
+			return 3
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			clock := &testClock{now: time.Now()}
+			underlying := NewMemoryAuthRepository(clock)
+			counting := &countingAuthRepository{AuthRepository: underlying}
+			cache := NewCachedAuthRepository(counting, nil, c.cfg, clock, logging.Discard())
+
+			params := make([]db.CreateAuthParams, 3)
+			for i := range params {
+				params[i] = newAuthParams(uuid.NewString())
+				mustCreateAuth(t, underlying, params[i])
+			}
+
+			expected := c.run(t, cache, underlying, clock, params)
+			if reads := counting.reads.Load(); reads != expected {
+				t.Errorf("expected %d reads to reach the repository, got %d", expected, reads)
+			}
+		})
+	}
+}
+
+func TestCachedAuthRepositoryEvictsOnNotify(t *testing.T) {
+	underlying := NewMemoryAuthRepository(tokens.NewSystemClock())
+	listener := &channelListener{notifications: make(chan string), subscribed: make(chan struct{}, 1)}
+	cache := NewCachedAuthRepository(underlying, listener, AuthCacheConfig{Size: 10, TTL: time.Minute}, tokens.NewSystemClock(), logging.Discard())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go cache.Run(ctx)
+	<-listener.subscribed
+
+	params := newAuthParams(uuid.NewString())
+	mustCreateAuth(t, underlying, params)
+	mustGetAuth(t, cache, params.ID)
+
+	// another instance rotates the token, the stale session is served until the notification arrives
+	if err := underlying.UpdateAuthRefreshToken(ctx, params.ID, params.RefreshTokenHash, "rotated", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if auth := mustGetAuth(t, cache, params.ID); auth.RefreshTokenHash != params.RefreshTokenHash {
+		t.Fatalf("expected the cached hash, got %q", auth.RefreshTokenHash)
+	}
+
+	listener.notifications <- "not-a-uuid"
+	listener.notifications <- params.ID.String()
+	// the unbuffered channel only accepts the next payload once the previous one is handled
+	listener.notifications <- uuid.NewString()
+
+	if auth := mustGetAuth(t, cache, params.ID); auth.RefreshTokenHash != "rotated" {
+		t.Errorf("expected the notification to evict the session, got %q", auth.RefreshTokenHash)
+	}
+}
+
+func mustGetAuth(t *testing.T, repo AuthRepository, id uuid.UUID) db.Auth {
+	t.Helper()
+	auth, err := repo.GetAuthById(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth
+}
+
+func assertAuthMissing(t *testing.T, repo AuthRepository, id uuid.UUID) {
+	t.Helper()
+	if _, err := repo.GetAuthById(context.Background(), id); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected %v, got %v", sql.ErrNoRows, err)
+	}
+}
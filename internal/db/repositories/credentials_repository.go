@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kwinso/medods-test-task/internal/db"
+)
+
+type CredentialsRepository interface {
+	// CreateCredentials stores the credentials. Returns ErrAlreadyExists if the GUID or username is taken.
+	CreateCredentials(ctx context.Context, guid, username, passwordHash string) (db.Credential, error)
+	GetCredentialsByUsername(ctx context.Context, username string) (db.Credential, error)
+	GetCredentialsByGuid(ctx context.Context, guid string) (db.Credential, error)
+	UpdatePasswordHash(ctx context.Context, guid, passwordHash string) error
+}
+
+type pgxCredentialsRepository struct {
+	queries db.Queries
+}
+
+func NewPgxCredentialsRepository(conn db.DBTX) CredentialsRepository {
+	return &pgxCredentialsRepository{
+		queries: *db.New(conn),
+	}
+}
+
+func (r *pgxCredentialsRepository) CreateCredentials(ctx context.Context, guid, username, passwordHash string) (db.Credential, error) {
+	credentials, err := r.queries.CreateCredentials(ctx, db.CreateCredentialsParams{
+		Guid:         guid,
+		Username:     username,
+		PasswordHash: passwordHash,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			return credentials, ErrAlreadyExists
+		}
+	}
+	return credentials, err
+}
+
+func (r *pgxCredentialsRepository) GetCredentialsByUsername(ctx context.Context, username string) (db.Credential, error) {
+	return r.queries.GetCredentialsByUsername(ctx, username)
+}
+
+func (r *pgxCredentialsRepository) GetCredentialsByGuid(ctx context.Context, guid string) (db.Credential, error) {
+	return r.queries.GetCredentialsByGuid(ctx, guid)
+}
+
+func (r *pgxCredentialsRepository) UpdatePasswordHash(ctx context.Context, guid, passwordHash string) error {
+	return r.queries.UpdateCredentialsPasswordHash(ctx, db.UpdateCredentialsPasswordHashParams{
+		Guid:         guid,
+		PasswordHash: passwordHash,
+	})
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/kwinso/medods-test-task/internal/db"
+)
+
+// DeadLettersRepository stores webhook reports that couldn't be delivered, so they can be replayed later
+type DeadLettersRepository interface {
+	CreateDeadLetter(ctx context.Context, deadLetter db.CreateWebhookDeadLetterParams) error
+	// ListDeadLetters returns the oldest dead letters first
+	ListDeadLetters(ctx context.Context, limit int32) ([]db.WebhookDeadLetter, error)
+	DeleteDeadLetter(ctx context.Context, id int64) error
+}
+
+type pgxDeadLettersRepository struct {
+	queries db.Queries
+}
+
+func NewPgxDeadLettersRepository(conn db.DBTX) DeadLettersRepository {
+	return &pgxDeadLettersRepository{
+		queries: *db.New(conn),
+	}
+}
+
+func (r *pgxDeadLettersRepository) CreateDeadLetter(ctx context.Context, deadLetter db.CreateWebhookDeadLetterParams) error {
+	return r.queries.CreateWebhookDeadLetter(ctx, deadLetter)
+}
+
+func (r *pgxDeadLettersRepository) ListDeadLetters(ctx context.Context, limit int32) ([]db.WebhookDeadLetter, error) {
+	return r.queries.ListWebhookDeadLetters(ctx, limit)
+}
+
+func (r *pgxDeadLettersRepository) DeleteDeadLetter(ctx context.Context, id int64) error {
+	return r.queries.DeleteWebhookDeadLetter(ctx, id)
+}
@@ -0,0 +1,14 @@
+package repositories
+
+import "errors"
+
+var (
+	ErrAlreadyExists = errors.New("record already exists")
+	ErrNotFound      = errors.New("record not found")
+)
+
+// Postgres error codes the repositories translate into the errors above
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+)
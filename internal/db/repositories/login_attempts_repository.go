@@ -0,0 +1,41 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/kwinso/medods-test-task/internal/db"
+)
+
+type LoginAttemptsRepository interface {
+	// StartAttempt counts a login attempt of the subject, e.g. a username or an IP. The attempt that reaches maxAttempts
+	// since the last reset locks the subject until lockedUntil, and so does every attempt after the lock is over.
+	// Returns false if the subject is locked at now.
+	StartAttempt(ctx context.Context, subject string, maxAttempts int32, now, lockedUntil time.Time) (bool, error)
+	// ResetAttempts forgets the attempts of the subject and lifts the lock
+	ResetAttempts(ctx context.Context, subject string) error
+}
+
+type pgxLoginAttemptsRepository struct {
+	queries db.Queries
+}
+
+func NewPgxLoginAttemptsRepository(conn db.DBTX) LoginAttemptsRepository {
+	return &pgxLoginAttemptsRepository{
+		queries: *db.New(conn),
+	}
+}
+
+func (r *pgxLoginAttemptsRepository) StartAttempt(ctx context.Context, subject string, maxAttempts int32, now, lockedUntil time.Time) (bool, error) {
+	rows, err := r.queries.StartLoginAttempt(ctx, db.StartLoginAttemptParams{
+		Subject:     subject,
+		MaxAttempts: maxAttempts,
+		LockedUntil: lockedUntil,
+		Now:         now,
+	})
+	return rows > 0, err
+}
+
+func (r *pgxLoginAttemptsRepository) ResetAttempts(ctx context.Context, subject string) error {
+	return r.queries.DeleteLoginAttempts(ctx, subject)
+}
@@ -0,0 +1,160 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+// ErrAuthExists is returned when creating a session with an ID or a refresh token hash that's already used
+var ErrAuthExists = errors.New("auth already exists")
+
+// ErrAuthChanged is returned when updating a session that was deleted or refreshed since it was read
+var ErrAuthChanged = errors.New("auth was changed concurrently")
+
+type memoryAuthRepository struct {
+	mu    sync.RWMutex
+	auths map[uuid.UUID]db.Auth
+	clock tokens.Clock
+}
+
+// NewMemoryAuthRepository creates an AuthRepository that keeps the sessions in memory, for tests and single instance demos.
+// Sessions are lost on restart. The creation time is taken from clock.
+func NewMemoryAuthRepository(clock tokens.Clock) AuthRepository {
+	return &memoryAuthRepository{
+		auths: make(map[uuid.UUID]db.Auth),
+		clock: clock,
+	}
+}
+
+func (r *memoryAuthRepository) CreateAuth(_ context.Context, params db.CreateAuthParams) (db.Auth, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.auths[params.ID]; ok {
+		return db.Auth{}, ErrAuthExists
+	}
+	for _, auth := range r.auths {
+		if auth.RefreshTokenHash == params.RefreshTokenHash {
+			return db.Auth{}, ErrAuthExists
+		}
+	}
+
+	auth := db.Auth{
+		ID:               params.ID,
+		Guid:             params.Guid,
+		RefreshTokenHash: params.RefreshTokenHash,
+		IpAddress:        params.IpAddress,
+		UserAgent:        params.UserAgent,
+		RefreshedAt:      storedTime(params.RefreshedAt),
+		CreatedAt:        storedTime(r.clock.Now()),
+		Amr:              slices.Clone(params.Amr),
+		Acr:              params.Acr,
+	}
+	if auth.Amr == nil {
+		auth.Amr = []string{}
+	}
+	r.auths[auth.ID] = auth
+
+	return cloneAuth(auth), nil
+}
+
+func (r *memoryAuthRepository) GetAuthById(_ context.Context, id uuid.UUID) (db.Auth, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	auth, ok := r.auths[id]
+	if !ok {
+		return db.Auth{}, sql.ErrNoRows
+	}
+	return cloneAuth(auth), nil
+}
+
+func (r *memoryAuthRepository) DeleteAuthById(_ context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.auths, id)
+	return nil
+}
+
+func (r *memoryAuthRepository) UpdateAuthRefreshToken(_ context.Context, id uuid.UUID, oldRefreshToken, refreshToken string, refreshedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	auth, ok := r.auths[id]
+	if !ok || auth.RefreshTokenHash != oldRefreshToken {
+		return ErrAuthChanged
+	}
+	for otherId, other := range r.auths {
+		if otherId != id && other.RefreshTokenHash == refreshToken {
+			return ErrAuthExists
+		}
+	}
+
+	auth.RefreshTokenHash = refreshToken
+	auth.RefreshedAt = storedTime(refreshedAt)
+	r.auths[id] = auth
+	return nil
+}
+
+func (r *memoryAuthRepository) ListAuthsByGuid(_ context.Context, guid string) ([]db.Auth, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var auths []db.Auth
+	for _, auth := range r.auths {
+		if auth.Guid == guid {
+			auths = append(auths, cloneAuth(auth))
+		}
+	}
+	slices.SortFunc(auths, func(a, b db.Auth) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return auths, nil
+}
+
+func (r *memoryAuthRepository) DeleteAuthsByGuid(_ context.Context, guid string) ([]uuid.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []uuid.UUID
+	for id, auth := range r.auths {
+		if auth.Guid == guid {
+			ids = append(ids, id)
+			delete(r.auths, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memoryAuthRepository) CountAuthsRefreshedSince(_ context.Context, since time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, auth := range r.auths {
+		if auth.RefreshedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// cloneAuth copies the auth, so callers can't modify the stored one through the AMR slice
+func cloneAuth(auth db.Auth) db.Auth {
+	auth.Amr = slices.Clone(auth.Amr)
+	return auth
+}
+
+// storedTime rounds the time to microseconds like Postgres does
+func storedTime(t time.Time) time.Time {
+	return t.Round(time.Microsecond)
+}
@@ -0,0 +1,141 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/db"
+)
+
+type MFARepository interface {
+	// SaveUnconfirmedTOTPSecret stores a new TOTP secret for the GUID.
+	// Returns false if the GUID already has a confirmed secret, which is left untouched.
+	SaveUnconfirmedTOTPSecret(ctx context.Context, guid, secret string) (bool, error)
+	GetTOTPSecret(ctx context.Context, guid string) (db.TotpSecret, error)
+	ConfirmTOTPSecret(ctx context.Context, guid string) error
+	// UseTOTPStep marks the time step as used. Returns false if the same or a later step was already used.
+	UseTOTPStep(ctx context.Context, guid string, step int64) (bool, error)
+	DeleteTOTPSecret(ctx context.Context, guid string) error
+	// StartTOTPAttempt counts an attempt to pass the second factor of the GUID. The attempt that reaches maxAttempts
+	// since the last reset locks the GUID until lockedUntil, and so does every attempt after the lock is over.
+	// Returns false if the GUID is locked at now or has no TOTP.
+	StartTOTPAttempt(ctx context.Context, guid string, maxAttempts int32, now, lockedUntil time.Time) (bool, error)
+	// ResetTOTPAttempts forgets the attempts of the GUID and lifts the lock
+	ResetTOTPAttempts(ctx context.Context, guid string) error
+
+	// StartChallengeAttempt counts an attempt to complete the MFA challenge, the challenge is stored on the first one.
+	// Returns false if the challenge was consumed or already had maxAttempts attempts.
+	StartChallengeAttempt(ctx context.Context, id uuid.UUID, guid string, expiresAt time.Time, maxAttempts int32) (bool, error)
+	// ConsumeChallenge marks the challenge as completed. Returns false if it already was.
+	ConsumeChallenge(ctx context.Context, id uuid.UUID) (bool, error)
+	DeleteExpiredChallenges(ctx context.Context) error
+
+	// ReplaceRecoveryCodes drops all recovery codes of the GUID and stores the new ones
+	ReplaceRecoveryCodes(ctx context.Context, guid string, codeHashes []string) error
+	// UseRecoveryCode marks an unused recovery code as used. Returns false if there's no such unused code.
+	UseRecoveryCode(ctx context.Context, guid, codeHash string) (bool, error)
+	DeleteRecoveryCodes(ctx context.Context, guid string) error
+}
+
+type pgxMFARepository struct {
+	queries db.Queries
+}
+
+func NewPgxMFARepository(conn db.DBTX) MFARepository {
+	return &pgxMFARepository{
+		queries: *db.New(conn),
+	}
+}
+
+func (r *pgxMFARepository) SaveUnconfirmedTOTPSecret(ctx context.Context, guid, secret string) (bool, error) {
+	rows, err := r.queries.UpsertUnconfirmedTotpSecret(ctx, db.UpsertUnconfirmedTotpSecretParams{
+		Guid:   guid,
+		Secret: secret,
+	})
+	return rows > 0, err
+}
+
+func (r *pgxMFARepository) GetTOTPSecret(ctx context.Context, guid string) (db.TotpSecret, error) {
+	return r.queries.GetTotpSecret(ctx, guid)
+}
+
+func (r *pgxMFARepository) ConfirmTOTPSecret(ctx context.Context, guid string) error {
+	return r.queries.ConfirmTotpSecret(ctx, guid)
+}
+
+func (r *pgxMFARepository) UseTOTPStep(ctx context.Context, guid string, step int64) (bool, error) {
+	rows, err := r.queries.UpdateTotpLastUsedStep(ctx, db.UpdateTotpLastUsedStepParams{
+		Guid:         guid,
+		LastUsedStep: step,
+	})
+	return rows > 0, err
+}
+
+func (r *pgxMFARepository) DeleteTOTPSecret(ctx context.Context, guid string) error {
+	return r.queries.DeleteTotpSecret(ctx, guid)
+}
+
+func (r *pgxMFARepository) StartTOTPAttempt(ctx context.Context, guid string, maxAttempts int32, now, lockedUntil time.Time) (bool, error) {
+	rows, err := r.queries.StartTotpAttempt(ctx, db.StartTotpAttemptParams{
+		MaxAttempts: maxAttempts,
+		LockedUntil: lockedUntil,
+		Guid:        guid,
+		Now:         now,
+	})
+	return rows > 0, err
+}
+
+func (r *pgxMFARepository) ResetTOTPAttempts(ctx context.Context, guid string) error {
+	return r.queries.ResetTotpAttempts(ctx, guid)
+}
+
+func (r *pgxMFARepository) StartChallengeAttempt(ctx context.Context, id uuid.UUID, guid string, expiresAt time.Time, maxAttempts int32) (bool, error) {
+	rows, err := r.queries.StartMfaChallengeAttempt(ctx, db.StartMfaChallengeAttemptParams{
+		ID:          id,
+		Guid:        guid,
+		ExpiresAt:   expiresAt,
+		MaxAttempts: maxAttempts,
+	})
+	return rows > 0, err
+}
+
+func (r *pgxMFARepository) ConsumeChallenge(ctx context.Context, id uuid.UUID) (bool, error) {
+	rows, err := r.queries.ConsumeMfaChallenge(ctx, id)
+	return rows > 0, err
+}
+
+func (r *pgxMFARepository) DeleteExpiredChallenges(ctx context.Context) error {
+	return r.queries.DeleteExpiredMfaChallenges(ctx)
+}
+
+func (r *pgxMFARepository) ReplaceRecoveryCodes(ctx context.Context, guid string, codeHashes []string) error {
+	err := r.queries.DeleteRecoveryCodes(ctx, guid)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		err := r.queries.CreateRecoveryCode(ctx, db.CreateRecoveryCodeParams{
+			Guid:     guid,
+			CodeHash: hash,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *pgxMFARepository) UseRecoveryCode(ctx context.Context, guid, codeHash string) (bool, error) {
+	rows, err := r.queries.UseRecoveryCode(ctx, db.UseRecoveryCodeParams{
+		Guid:     guid,
+		CodeHash: codeHash,
+	})
+	return rows > 0, err
+}
+
+func (r *pgxMFARepository) DeleteRecoveryCodes(ctx context.Context, guid string) error {
+	return r.queries.DeleteRecoveryCodes(ctx, guid)
+}
@@ -0,0 +1,313 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keys of the sessions. Every key expires AuthTTL after the last refresh, like the session itself
+const (
+	// redisAuthKey stores the session as JSON
+	redisAuthKey = "auth:"
+	// redisAuthHashKey maps the refresh token hash to the session ID, to keep the hashes unique
+	redisAuthHashKey = "auth:hash:"
+	// redisAuthGuidKey is the set of the session IDs of the GUID
+	redisAuthGuidKey = "auth:guid:"
+	// redisAuthRefreshedKey is the sorted set of all session IDs by the refresh time in microseconds
+	redisAuthRefreshedKey = "auth:refreshed"
+)
+
+// redisMaxTxAttempts is how many times a transaction is retried when the watched keys change
+const redisMaxTxAttempts = 10
+
+type redisAuthRepository struct {
+	client   redis.UniversalClient
+	settings *config.Store
+	clock    tokens.Clock
+}
+
+// NewRedisAuthRepository creates an AuthRepository that stores the sessions in Redis. Sessions expire on their own
+// AuthTTL from settings after the last refresh. The creation time is taken from clock.
+func NewRedisAuthRepository(client redis.UniversalClient, settings *config.Store, clock tokens.Clock) AuthRepository {
+	return &redisAuthRepository{
+		client:   client,
+		settings: settings,
+		clock:    clock,
+	}
+}
+
+func (r *redisAuthRepository) CreateAuth(ctx context.Context, params db.CreateAuthParams) (db.Auth, error) {
+	now := r.clock.Now()
+	auth := db.Auth{
+		ID:               params.ID,
+		Guid:             params.Guid,
+		RefreshTokenHash: params.RefreshTokenHash,
+		IpAddress:        params.IpAddress,
+		UserAgent:        params.UserAgent,
+		RefreshedAt:      storedTime(params.RefreshedAt),
+		CreatedAt:        storedTime(now),
+		Amr:              slices.Clone(params.Amr),
+		Acr:              params.Acr,
+	}
+	if auth.Amr == nil {
+		auth.Amr = []string{}
+	}
+	encoded, err := json.Marshal(auth)
+	if err != nil {
+		return db.Auth{}, err
+	}
+
+	ttl := r.ttl()
+	id := auth.ID.String()
+
+	created, err := r.client.SetNX(ctx, redisAuthKey+id, encoded, ttl).Result()
+	if err != nil {
+		return db.Auth{}, err
+	}
+	if !created {
+		return db.Auth{}, ErrAuthExists
+	}
+
+	claimed, err := r.client.SetNX(ctx, redisAuthHashKey+auth.RefreshTokenHash, id, ttl).Result()
+	if err != nil || !claimed {
+		r.client.Del(ctx, redisAuthKey+id)
+		if err != nil {
+			return db.Auth{}, err
+		}
+		return db.Auth{}, ErrAuthExists
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, redisAuthGuidKey+auth.Guid, id)
+		pipe.Expire(ctx, redisAuthGuidKey+auth.Guid, ttl)
+		pipe.ZAdd(ctx, redisAuthRefreshedKey, redis.Z{Score: float64(auth.RefreshedAt.UnixMicro()), Member: id})
+		// sessions that expired on their own stay in the refresh index until they're too old to be counted
+		pipe.ZRemRangeByScore(ctx, redisAuthRefreshedKey, "-inf", "("+strconv.FormatInt(now.Add(-ttl).UnixMicro(), 10))
+		return nil
+	})
+	if err != nil {
+		return db.Auth{}, err
+	}
+
+	return auth, nil
+}
+
+func (r *redisAuthRepository) GetAuthById(ctx context.Context, id uuid.UUID) (db.Auth, error) {
+	return r.getAuth(ctx, r.client, id)
+}
+
+func (r *redisAuthRepository) DeleteAuthById(ctx context.Context, id uuid.UUID) error {
+	auth, err := r.GetAuthById(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		r.deleteAuth(ctx, pipe, auth)
+		return nil
+	})
+	return err
+}
+
+func (r *redisAuthRepository) UpdateAuthRefreshToken(ctx context.Context, id uuid.UUID, oldRefreshToken, refreshToken string, refreshedAt time.Time) error {
+	key := redisAuthKey + id.String()
+
+	// the session is watched, so a concurrent refresh or delete fails the transaction instead of being overwritten
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		auth, err := r.getAuth(ctx, tx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrAuthChanged
+		}
+		if err != nil {
+			return err
+		}
+		if auth.RefreshTokenHash != oldRefreshToken {
+			return ErrAuthChanged
+		}
+
+		ttl := r.ttl()
+		claimed, err := tx.SetNX(ctx, redisAuthHashKey+refreshToken, id.String(), ttl).Result()
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return ErrAuthExists
+		}
+
+		oldHash := auth.RefreshTokenHash
+		auth.RefreshTokenHash = refreshToken
+		auth.RefreshedAt = storedTime(refreshedAt)
+		encoded, err := json.Marshal(auth)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, encoded, ttl)
+			pipe.Del(ctx, redisAuthHashKey+oldHash)
+			pipe.Expire(ctx, redisAuthGuidKey+auth.Guid, ttl)
+			pipe.ZAdd(ctx, redisAuthRefreshedKey, redis.Z{Score: float64(auth.RefreshedAt.UnixMicro()), Member: id.String()})
+			return nil
+		})
+		if err != nil {
+			tx.Del(ctx, redisAuthHashKey+refreshToken)
+		}
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return ErrAuthChanged
+	}
+	return err
+}
+
+func (r *redisAuthRepository) ListAuthsByGuid(ctx context.Context, guid string) ([]db.Auth, error) {
+	auths, err := r.listAuths(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(auths, func(a, b db.Auth) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return auths, nil
+}
+
+func (r *redisAuthRepository) DeleteAuthsByGuid(ctx context.Context, guid string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	var err error
+	// the index and the sessions are watched, so a session created or refreshed concurrently restarts the deletion
+	for range redisMaxTxAttempts {
+		ids, err = r.deleteAuthsByGuid(ctx, guid)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *redisAuthRepository) deleteAuthsByGuid(ctx context.Context, guid string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		members, err := tx.SMembers(ctx, redisAuthGuidKey+guid).Result()
+		if err != nil || len(members) == 0 {
+			return err
+		}
+		err = tx.Watch(ctx, authKeys(members)...).Err()
+		if err != nil {
+			return err
+		}
+		auths, expired, err := r.readAuths(ctx, tx, members)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, auth := range auths {
+				r.deleteAuth(ctx, pipe, auth)
+				ids = append(ids, auth.ID)
+			}
+			if len(expired) > 0 {
+				pipe.SRem(ctx, redisAuthGuidKey+guid, expired...)
+			}
+			return nil
+		})
+		return err
+	}, redisAuthGuidKey+guid)
+	return ids, err
+}
+
+func (r *redisAuthRepository) CountAuthsRefreshedSince(ctx context.Context, since time.Time) (int64, error) {
+	return r.client.ZCount(ctx, redisAuthRefreshedKey, "("+strconv.FormatInt(since.UnixMicro(), 10), "+inf").Result()
+}
+
+func (r *redisAuthRepository) ttl() time.Duration {
+	return r.settings.Get().AuthTTL
+}
+
+func (r *redisAuthRepository) getAuth(ctx context.Context, client redis.Cmdable, id uuid.UUID) (db.Auth, error) {
+	encoded, err := client.Get(ctx, redisAuthKey+id.String()).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return db.Auth{}, sql.ErrNoRows
+	}
+	if err != nil {
+		return db.Auth{}, err
+	}
+
+	var auth db.Auth
+	err = json.Unmarshal(encoded, &auth)
+	return auth, err
+}
+
+// listAuths returns the live sessions of the GUID, dropping the expired ones from its index
+func (r *redisAuthRepository) listAuths(ctx context.Context, guid string) ([]db.Auth, error) {
+	ids, err := r.client.SMembers(ctx, redisAuthGuidKey+guid).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	auths, expired, err := r.readAuths(ctx, r.client, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(expired) > 0 {
+		r.client.SRem(ctx, redisAuthGuidKey+guid, expired...)
+	}
+	return auths, nil
+}
+
+// readAuths returns the sessions with the IDs that are still stored and the IDs of the expired ones
+func (r *redisAuthRepository) readAuths(ctx context.Context, client redis.Cmdable, ids []string) ([]db.Auth, []any, error) {
+	values, err := client.MGet(ctx, authKeys(ids)...).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var auths []db.Auth
+	var expired []any
+	for i, value := range values {
+		encoded, ok := value.(string)
+		if !ok {
+			expired = append(expired, ids[i])
+			continue
+		}
+
+		var auth db.Auth
+		if err := json.Unmarshal([]byte(encoded), &auth); err != nil {
+			return nil, nil, err
+		}
+		auths = append(auths, auth)
+	}
+	return auths, expired, nil
+}
+
+func authKeys(ids []string) []string {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = redisAuthKey + id
+	}
+	return keys
+}
+
+func (r *redisAuthRepository) deleteAuth(ctx context.Context, pipe redis.Pipeliner, auth db.Auth) {
+	id := auth.ID.String()
+	pipe.Del(ctx, redisAuthKey+id, redisAuthHashKey+auth.RefreshTokenHash)
+	pipe.SRem(ctx, redisAuthGuidKey+auth.Guid, id)
+	pipe.ZRem(ctx, redisAuthRefreshedKey, id)
+}
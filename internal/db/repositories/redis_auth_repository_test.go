@@ -0,0 +1,142 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisAuthRepository creates a repository on top of an in-process Redis with the given session TTL
+func newTestRedisAuthRepository(t *testing.T, ttl time.Duration) (AuthRepository, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	settings := config.NewStore(&config.Config{AuthTTL: ttl})
+	return NewRedisAuthRepository(client, settings, tokens.NewSystemClock()), server
+}
+
+func TestRedisAuthRepositoryExpiresSessions(t *testing.T) {
+	ctx := context.Background()
+	repo, server := newTestRedisAuthRepository(t, time.Hour)
+
+	expiring := newAuthParams(uuid.NewString())
+	refreshed := newAuthParams(expiring.Guid)
+	mustCreateAuth(t, repo, expiring)
+	mustCreateAuth(t, repo, refreshed)
+
+	if ttl := server.TTL(redisAuthKey + expiring.ID.String()); ttl != time.Hour {
+		t.Errorf("expected the session to expire in an hour, got %v", ttl)
+	}
+
+	server.FastForward(45 * time.Minute)
+	if err := repo.UpdateAuthRefreshToken(ctx, refreshed.ID, refreshed.RefreshTokenHash, "new-hash-"+refreshed.ID.String(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{
+		redisAuthKey + refreshed.ID.String(),
+		redisAuthHashKey + "new-hash-" + refreshed.ID.String(),
+		redisAuthGuidKey + refreshed.Guid,
+	} {
+		if ttl := server.TTL(key); ttl != time.Hour {
+			t.Errorf("expected the TTL of %s to be refreshed, got %v", key, ttl)
+		}
+	}
+	if server.Exists(redisAuthHashKey + refreshed.RefreshTokenHash) {
+		t.Error("expected the old refresh token hash to be removed")
+	}
+
+	server.FastForward(30 * time.Minute)
+	if _, err := repo.GetAuthById(ctx, expiring.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the session to expire, got %v", err)
+	}
+	if _, err := repo.GetAuthById(ctx, refreshed.ID); err != nil {
+		t.Errorf("expected the refreshed session to be kept, got %v", err)
+	}
+
+	auths, err := repo.ListAuthsByGuid(ctx, expiring.Guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(auths) != 1 || auths[0].ID != refreshed.ID {
+		t.Errorf("expected only the refreshed session to be listed, got %v", auths)
+	}
+	if member, _ := server.IsMember(redisAuthGuidKey+expiring.Guid, expiring.ID.String()); member {
+		t.Error("expected the expired session to be removed from the GUID index")
+	}
+
+	ids, err := repo.DeleteAuthsByGuid(ctx, expiring.Guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != refreshed.ID {
+		t.Errorf("expected only the live session to be deleted, got %v", ids)
+	}
+}
+
+// onCommand runs fn once, before the first command with the name is sent
+type onCommand struct {
+	name string
+	fn   func()
+	once sync.Once
+}
+
+func (h *onCommand) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *onCommand) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == h.name {
+			h.once.Do(h.fn)
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *onCommand) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestRedisDeleteAuthsByGuidRetriesOnConcurrentChanges(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	repo := NewRedisAuthRepository(client, config.NewStore(&config.Config{AuthTTL: time.Hour}), tokens.NewSystemClock())
+
+	existing := newAuthParams(uuid.NewString())
+	mustCreateAuth(t, repo, existing)
+
+	// a session is created after the index is read, but before the sessions are deleted
+	concurrent := newAuthParams(existing.Guid)
+	other := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { other.Close() })
+	client.AddHook(&onCommand{name: "mget", fn: func() {
+		mustCreateAuth(t, NewRedisAuthRepository(other, config.NewStore(&config.Config{AuthTTL: time.Hour}), tokens.NewSystemClock()), concurrent)
+	}})
+
+	ids, err := repo.DeleteAuthsByGuid(ctx, existing.Guid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(ids, compareUUIDs)
+	expected := []uuid.UUID{existing.ID, concurrent.ID}
+	slices.SortFunc(expected, compareUUIDs)
+	if !slices.Equal(ids, expected) {
+		t.Errorf("expected %v to be deleted, got %v", expected, ids)
+	}
+	if _, err := repo.GetAuthById(ctx, concurrent.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the concurrent session to be deleted, got %v", err)
+	}
+}
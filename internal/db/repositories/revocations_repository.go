@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/db"
+)
+
+// RevocationsChannel is the Postgres channel that gets the auth ID of every stored revocation
+const RevocationsChannel = "auth_revocations"
+
+type RevocationsRepository interface {
+	// CreateRevocation stores the revocation, which notifies RevocationsChannel listeners
+	CreateRevocation(ctx context.Context, authId uuid.UUID, expiresAt time.Time) error
+	ListActiveRevocations(ctx context.Context) ([]db.AuthRevocation, error)
+	DeleteExpiredRevocations(ctx context.Context) error
+}
+
+type pgxRevocationsRepository struct {
+	queries db.Queries
+}
+
+func NewPgxRevocationsRepository(conn db.DBTX) RevocationsRepository {
+	return &pgxRevocationsRepository{
+		queries: *db.New(conn),
+	}
+}
+
+func (r *pgxRevocationsRepository) CreateRevocation(ctx context.Context, authId uuid.UUID, expiresAt time.Time) error {
+	return r.queries.CreateAuthRevocation(ctx, db.CreateAuthRevocationParams{
+		AuthID:    authId,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (r *pgxRevocationsRepository) ListActiveRevocations(ctx context.Context) ([]db.AuthRevocation, error) {
+	return r.queries.ListActiveAuthRevocations(ctx)
+}
+
+func (r *pgxRevocationsRepository) DeleteExpiredRevocations(ctx context.Context) error {
+	return r.queries.DeleteExpiredAuthRevocations(ctx)
+}
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kwinso/medods-test-task/internal/db"
+)
+
+type RolesRepository interface {
+	// UpsertRole creates the role or replaces its scopes
+	UpsertRole(ctx context.Context, name string, scopes []string) (db.Role, error)
+	ListRoles(ctx context.Context) ([]db.Role, error)
+	// DeleteRole deletes the role and unassigns it from everyone. Returns ErrNotFound if there's no such role.
+	DeleteRole(ctx context.Context, name string) error
+	// AssignRole assigns the role to the GUID. Returns ErrNotFound if there's no such role.
+	AssignRole(ctx context.Context, guid, role string) error
+	// UnassignRole removes the role from the GUID. Returns ErrNotFound if the GUID doesn't have the role.
+	UnassignRole(ctx context.Context, guid, role string) error
+	ListRolesByGuid(ctx context.Context, guid string) ([]db.Role, error)
+}
+
+type pgxRolesRepository struct {
+	queries db.Queries
+}
+
+func NewPgxRolesRepository(conn db.DBTX) RolesRepository {
+	return &pgxRolesRepository{
+		queries: *db.New(conn),
+	}
+}
+
+func (r *pgxRolesRepository) UpsertRole(ctx context.Context, name string, scopes []string) (db.Role, error) {
+	return r.queries.UpsertRole(ctx, db.UpsertRoleParams{
+		Name:   name,
+		Scopes: scopes,
+	})
+}
+
+func (r *pgxRolesRepository) ListRoles(ctx context.Context) ([]db.Role, error) {
+	return r.queries.ListRoles(ctx)
+}
+
+func (r *pgxRolesRepository) DeleteRole(ctx context.Context, name string) error {
+	rows, err := r.queries.DeleteRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgxRolesRepository) AssignRole(ctx context.Context, guid, role string) error {
+	err := r.queries.AssignRole(ctx, db.AssignRoleParams{
+		Guid: guid,
+		Role: role,
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+			return ErrNotFound
+		}
+	}
+	return err
+}
+
+func (r *pgxRolesRepository) UnassignRole(ctx context.Context, guid, role string) error {
+	rows, err := r.queries.UnassignRole(ctx, db.UnassignRoleParams{
+		Guid: guid,
+		Role: role,
+	})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgxRolesRepository) ListRolesByGuid(ctx context.Context, guid string) ([]db.Role, error) {
+	return r.queries.ListRolesByGuid(ctx, guid)
+}
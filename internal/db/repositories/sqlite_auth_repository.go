@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/netip"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+const sqliteAuthColumns = "id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at, created_at, amr, acr"
+
+type sqliteAuthRepository struct {
+	conn  *sql.DB
+	clock tokens.Clock
+}
+
+// NewSQLiteAuthRepository creates an AuthRepository on top of a SQLite database opened with db.OpenSQLite,
+// for single instance edge deployments. The creation time is taken from clock.
+func NewSQLiteAuthRepository(conn *sql.DB, clock tokens.Clock) AuthRepository {
+	return &sqliteAuthRepository{
+		conn:  conn,
+		clock: clock,
+	}
+}
+
+func (r *sqliteAuthRepository) CreateAuth(ctx context.Context, params db.CreateAuthParams) (db.Auth, error) {
+	amr := params.Amr
+	if amr == nil {
+		amr = []string{}
+	}
+	encodedAmr, err := json.Marshal(amr)
+	if err != nil {
+		return db.Auth{}, err
+	}
+
+	row := r.conn.QueryRowContext(ctx, `INSERT INTO auths (`+sqliteAuthColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING `+sqliteAuthColumns,
+		params.ID.String(), params.Guid, params.RefreshTokenHash, params.IpAddress.String(), params.UserAgent,
+		params.RefreshedAt.UnixMicro(), r.clock.Now().UnixMicro(), string(encodedAmr), params.Acr)
+	return scanSQLiteAuth(row)
+}
+
+func (r *sqliteAuthRepository) GetAuthById(ctx context.Context, id uuid.UUID) (db.Auth, error) {
+	row := r.conn.QueryRowContext(ctx, `SELECT `+sqliteAuthColumns+` FROM auths WHERE id = ?`, id.String())
+	return scanSQLiteAuth(row)
+}
+
+func (r *sqliteAuthRepository) DeleteAuthById(ctx context.Context, id uuid.UUID) error {
+	_, err := r.conn.ExecContext(ctx, `DELETE FROM auths WHERE id = ?`, id.String())
+	return err
+}
+
+func (r *sqliteAuthRepository) UpdateAuthRefreshToken(ctx context.Context, id uuid.UUID, oldRefreshToken, refreshToken string, refreshedAt time.Time) error {
+	result, err := r.conn.ExecContext(ctx, `UPDATE auths SET refresh_token_hash = ?, refreshed_at = ? WHERE id = ? AND refresh_token_hash = ?`,
+		refreshToken, refreshedAt.UnixMicro(), id.String(), oldRefreshToken)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrAuthChanged
+	}
+	return nil
+}
+
+func (r *sqliteAuthRepository) ListAuthsByGuid(ctx context.Context, guid string) ([]db.Auth, error) {
+	rows, err := r.conn.QueryContext(ctx, `SELECT `+sqliteAuthColumns+` FROM auths WHERE guid = ? ORDER BY created_at, rowid`, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var auths []db.Auth
+	for rows.Next() {
+		auth, err := scanSQLiteAuth(rows)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, auth)
+	}
+	return auths, rows.Err()
+}
+
+func (r *sqliteAuthRepository) DeleteAuthsByGuid(ctx context.Context, guid string) ([]uuid.UUID, error) {
+	rows, err := r.conn.QueryContext(ctx, `DELETE FROM auths WHERE guid = ? RETURNING id`, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, parsed)
+	}
+	return ids, rows.Err()
+}
+
+func (r *sqliteAuthRepository) CountAuthsRefreshedSince(ctx context.Context, since time.Time) (int64, error) {
+	var count int64
+	err := r.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM auths WHERE refreshed_at > ?`, since.UnixMicro()).Scan(&count)
+	return count, err
+}
+
+type sqliteScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSQLiteAuth(row sqliteScanner) (db.Auth, error) {
+	var (
+		auth        db.Auth
+		id, ip, amr string
+		refreshedAt int64
+		createdAt   int64
+	)
+	err := row.Scan(&id, &auth.Guid, &auth.RefreshTokenHash, &ip, &auth.UserAgent, &refreshedAt, &createdAt, &amr, &auth.Acr)
+	if err != nil {
+		return db.Auth{}, err
+	}
+
+	if auth.ID, err = uuid.Parse(id); err != nil {
+		return db.Auth{}, err
+	}
+	if auth.IpAddress, err = netip.ParseAddr(ip); err != nil {
+		return db.Auth{}, err
+	}
+	if err = json.Unmarshal([]byte(amr), &auth.Amr); err != nil {
+		return db.Auth{}, err
+	}
+	auth.RefreshedAt = time.UnixMicro(refreshedAt)
+	auth.CreatedAt = time.UnixMicro(createdAt)
+	return auth, nil
+}
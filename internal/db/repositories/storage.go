@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"fmt"
+
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/redis/go-redis/v9"
+)
+
+// NewAuthRepositoryForStorage creates the AuthRepository for the session storage selected in settings, conn is used for Postgres.
+// The returned function closes the storage. Sessions are created by the time of clock.
+func NewAuthRepositoryForStorage(settings *config.Store, conn db.DBTX, clock tokens.Clock) (AuthRepository, func() error, error) {
+	cfg := settings.Get()
+
+	switch cfg.SessionStorage {
+	case config.SessionStoragePostgres:
+		return NewPgxAuthRepository(conn), func() error { return nil }, nil
+	case config.SessionStorageMemory:
+		return NewMemoryAuthRepository(clock), func() error { return nil }, nil
+	case config.SessionStorageSQLite:
+		sqliteConn, err := db.OpenSQLite(cfg.SQLitePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewSQLiteAuthRepository(sqliteConn, clock), sqliteConn.Close, nil
+	case config.SessionStorageRedis:
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid redis URL: %w", err)
+		}
+		client := redis.NewClient(opts)
+		return NewRedisAuthRepository(client, settings, clock), client.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown session storage %q", cfg.SessionStorage)
+	}
+}
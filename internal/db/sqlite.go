@@ -0,0 +1,42 @@
+package db
+
+import (
+	"database/sql"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema is the SQLite version of the auths table. Times are stored as unix microseconds and AMR as a JSON array
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS auths (
+	id TEXT PRIMARY KEY,
+	guid TEXT NOT NULL,
+	refresh_token_hash TEXT NOT NULL UNIQUE,
+	ip_address TEXT NOT NULL,
+	user_agent TEXT NOT NULL,
+	refreshed_at INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	amr TEXT NOT NULL DEFAULT '[]',
+	acr TEXT NOT NULL DEFAULT 'aal1'
+);
+
+CREATE INDEX IF NOT EXISTS auths_guid_idx ON auths (guid);
+CREATE INDEX IF NOT EXISTS auths_refreshed_at_idx ON auths (refreshed_at);
+`
+
+// OpenSQLite opens the SQLite database at path, creating it and the sessions schema if needed.
+// ":memory:" opens a database that lives as long as the returned handle.
+func OpenSQLite(path string) (*sql.DB, error) {
+	conn, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer anyway, and an in-memory database exists only within its connection
+	conn.SetMaxOpenConns(1)
+
+	if _, err := conn.Exec(sqliteSchema); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,65 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/handlers/problems"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the errdetails.ErrorInfo attached to the errors
+const ErrorDomain = "medods-auth"
+
+// codesByStatus translates the HTTP status of a problem to the gRPC code
+var codesByStatus = map[int]codes.Code{
+	http.StatusBadRequest:   codes.InvalidArgument,
+	http.StatusUnauthorized: codes.Unauthenticated,
+	http.StatusForbidden:    codes.PermissionDenied,
+	http.StatusNotFound:     codes.NotFound,
+	http.StatusConflict:     codes.AlreadyExists,
+}
+
+// errorFromProblem builds the status for the problem. The stable error code of the HTTP API is sent
+// as the reason of the errdetails.ErrorInfo, so clients of both APIs handle failures the same way.
+func errorFromProblem(problem api.Problem) error {
+	code, ok := codesByStatus[problem.Status]
+	if !ok {
+		code = codes.Internal
+	}
+
+	message := problem.Detail
+	if message == "" {
+		message = problem.Title
+	}
+
+	st, err := status.New(code, message).WithDetails(&errdetails.ErrorInfo{
+		Reason: problem.Code,
+		Domain: ErrorDomain,
+	})
+	if err != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
+
+// statusFromError maps a service error the same way the HTTP API does, see problems.FromError.
+// Unknown errors are logged with msg and args and answered with codes.Internal, so the details don't leak to the client.
+func statusFromError(ctx context.Context, logger *slog.Logger, err error, msg string, args ...any) error {
+	if problem, ok := problems.FromError(err); ok {
+		return errorFromProblem(problem)
+	}
+
+	logger.ErrorContext(ctx, msg, append(args, logging.Err(err))...)
+	return internalError()
+}
+
+// internalError is the status for failures that must be logged by the caller
+func internalError() error {
+	return errorFromProblem(api.NewProblem(http.StatusInternalServerError, api.CodeInternalError, ""))
+}
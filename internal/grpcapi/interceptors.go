@@ -0,0 +1,95 @@
+package grpcapi
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/handlers/middleware"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/metrics"
+	"github.com/kwinso/medods-test-task/pkg/authpb"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDMetadata carries the correlation ID of a call, like the X-Request-ID header of the HTTP API
+const RequestIDMetadata = "x-request-id"
+
+// NewServer creates the gRPC server with the AuthServer registered. Calls are traced and measured like the HTTP requests
+func NewServer(authServer *AuthServer, m *metrics.Metrics, logger *slog.Logger) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			recoverPanics(logger),
+			requestID,
+			observeCalls(m),
+			logCalls(logger),
+		),
+	)
+	authpb.RegisterAuthServiceServer(server, authServer)
+	return server
+}
+
+// recoverPanics turns panics in the handlers into codes.Internal, like gin.Recovery does for the HTTP API
+func recoverPanics(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.ErrorContext(ctx, "Call panicked", "method", info.FullMethod, "panic", r)
+				err = internalError()
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// requestID takes the correlation ID from the x-request-id metadata or generates a new one, returns it in the header
+// and stores it in the context, so it's added to every log line of the call
+func requestID(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	id := uuid.NewString()
+	if values := metadata.ValueFromIncomingContext(ctx, RequestIDMetadata); len(values) > 0 && middleware.IsValidRequestID(values[0]) {
+		id = values[0]
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadata, id))
+	return handler(logging.WithRequestID(ctx, id), req)
+}
+
+// observeCalls observes the duration of every call, like middleware.Metrics does for the HTTP requests
+func observeCalls(m *metrics.Metrics) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+
+		m.GRPCCallDuration.
+			WithLabelValues(info.FullMethod, status.Code(err).String()).
+			Observe(time.Since(start).Seconds())
+		return res, err
+	}
+}
+
+// logCalls logs every call after it's handled
+func logCalls(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+
+		code := status.Code(err)
+		level := slog.LevelInfo
+		if code == codes.Internal || code == codes.Unknown {
+			level = slog.LevelError
+		}
+		logger.Log(ctx, level, "Call handled",
+			logging.KeyEvent, "grpc_call",
+			"method", info.FullMethod,
+			"code", code.String(),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+		return res, err
+	}
+}
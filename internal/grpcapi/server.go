@@ -0,0 +1,219 @@
+// Package grpcapi serves the auth API over gRPC for internal services, see proto/auth/v1/auth.proto.
+// It calls the same services as the HTTP handlers and reports failures with the same stable error codes.
+package grpcapi
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/services"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/kwinso/medods-test-task/pkg/authpb"
+	"github.com/kwinso/medods-test-task/pkg/grpcauth"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AuthServer implements authpb.AuthServiceServer
+type AuthServer struct {
+	authpb.UnimplementedAuthServiceServer
+
+	authService   services.AuthService
+	authenticator services.Authenticator
+	mfaService    services.MFAService
+	stateless     bool
+	logger        *slog.Logger
+}
+
+// NewAuthServer creates an AuthServer. With stateless set, access tokens are validated without looking up the session,
+// see services.AuthService.ValidateAccessTokenStateless
+func NewAuthServer(authService services.AuthService, authenticator services.Authenticator, mfaService services.MFAService, stateless bool, logger *slog.Logger) *AuthServer {
+	return &AuthServer{
+		authService:   authService,
+		authenticator: authenticator,
+		mfaService:    mfaService,
+		stateless:     stateless,
+		logger:        logger,
+	}
+}
+
+func (s *AuthServer) Login(ctx context.Context, req *authpb.LoginRequest) (*authpb.LoginResponse, error) {
+	if !api.IsValidGUID(req.GetGuid()) {
+		problem := api.NewProblem(http.StatusBadRequest, api.CodeValidationFailed, "guid must be a valid GUID")
+		return nil, errorFromProblem(problem)
+	}
+
+	err := s.authenticator.Authenticate(ctx, req.GetGuid(), req.GetAssertion())
+	if err != nil {
+		if errors.Is(err, services.ErrIdentityNotVerified) {
+			s.logger.InfoContext(ctx, "Identity verification failed",
+				logging.KeyEvent, "login_rejected", logging.KeyGUID, req.GetGuid(), logging.Err(err))
+		}
+		return nil, statusFromError(ctx, s.logger, err, "Failed to verify identity", logging.KeyGUID, req.GetGuid())
+	}
+
+	amr := []string{tokens.AMRExternal}
+	enabled, err := s.mfaService.IsEnabled(ctx, req.GetGuid())
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to check MFA", logging.KeyGUID, req.GetGuid(), logging.Err(err))
+		return nil, internalError()
+	}
+
+	// the second step of the login is only served over HTTP
+	if enabled {
+		challenge, err := s.mfaService.IssueChallenge(req.GetGuid(), amr)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to issue MFA challenge", logging.KeyGUID, req.GetGuid(), logging.Err(err))
+			return nil, internalError()
+		}
+		return &authpb.LoginResponse{MfaRequired: true, MfaToken: challenge}, nil
+	}
+
+	tokenPair, err := s.authService.AuthorizeByGUID(ctx, req.GetGuid(), amr, userAgent(ctx), clientIP(ctx))
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to authorize user", logging.KeyGUID, req.GetGuid(), logging.Err(err))
+		return nil, internalError()
+	}
+
+	return &authpb.LoginResponse{Tokens: toTokenPair(tokenPair)}, nil
+}
+
+func (s *AuthServer) Refresh(ctx context.Context, req *authpb.RefreshRequest) (*authpb.TokenPair, error) {
+	token, err := base64.StdEncoding.DecodeString(req.GetRefreshToken())
+	if err != nil {
+		problem := api.NewProblem(http.StatusUnauthorized, api.CodeInvalidRefreshToken, "The refresh token is not valid base64")
+		return nil, errorFromProblem(problem)
+	}
+
+	tokenPair, err := s.authService.RefreshAuth(ctx, string(token), userAgent(ctx), clientIP(ctx))
+	if err != nil {
+		return nil, statusFromError(ctx, s.logger, err, "Failed to refresh auth")
+	}
+
+	return toTokenPair(tokenPair), nil
+}
+
+func (s *AuthServer) ValidateAccessToken(ctx context.Context, req *authpb.ValidateAccessTokenRequest) (*authpb.ValidateAccessTokenResponse, error) {
+	claims, err := s.validate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	res := &authpb.ValidateAccessTokenResponse{
+		Guid:   claims.Guid,
+		AuthId: claims.AuthId.String(),
+		Amr:    claims.AMR,
+		Acr:    claims.ACR,
+		Roles:  claims.Roles,
+		Scopes: claims.Scopes(),
+	}
+	if claims.ExpiresAt != nil {
+		res.ExpiresAt = timestamppb.New(claims.ExpiresAt.Time)
+	}
+	return res, nil
+}
+
+func (s *AuthServer) Logout(ctx context.Context, _ *authpb.LogoutRequest) (*authpb.LogoutResponse, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.authService.DeleteAuthById(ctx, claims.AuthId)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to delete auth", logging.KeyAuthID, claims.AuthId, logging.Err(err))
+		return nil, internalError()
+	}
+
+	return &authpb.LogoutResponse{}, nil
+}
+
+func (s *AuthServer) ListSessions(ctx context.Context, _ *authpb.ListSessionsRequest) (*authpb.ListSessionsResponse, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.authService.ListSessions(ctx, claims.Guid)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to list sessions", logging.KeyGUID, claims.Guid, logging.Err(err))
+		return nil, internalError()
+	}
+
+	res := &authpb.ListSessionsResponse{Sessions: make([]*authpb.Session, 0, len(sessions))}
+	for _, session := range sessions {
+		res.Sessions = append(res.Sessions, &authpb.Session{
+			Id:          session.ID.String(),
+			UserAgent:   session.UserAgent,
+			IpAddress:   session.IpAddress.String(),
+			Amr:         session.Amr,
+			Acr:         session.Acr,
+			CreatedAt:   timestamppb.New(session.CreatedAt),
+			RefreshedAt: timestamppb.New(session.RefreshedAt),
+		})
+	}
+	return res, nil
+}
+
+// authenticate validates the bearer token from the `authorization` metadata
+func (s *AuthServer) authenticate(ctx context.Context) (*tokens.TokenClaims, error) {
+	token, ok := grpcauth.BearerToken(ctx)
+	if !ok {
+		problem := api.NewProblem(http.StatusUnauthorized, api.CodeMissingAccessToken,
+			"The call must have a bearer token in the authorization metadata")
+		return nil, errorFromProblem(problem)
+	}
+	return s.validate(ctx, token)
+}
+
+func (s *AuthServer) validate(ctx context.Context, token string) (*tokens.TokenClaims, error) {
+	validate := s.authService.ValidateAccessToken
+	if s.stateless {
+		validate = s.authService.ValidateAccessTokenStateless
+	}
+
+	claims, err := validate(ctx, token)
+	if err != nil {
+		return nil, statusFromError(ctx, s.logger, err, "Failed to authorize user")
+	}
+	return claims, nil
+}
+
+func toTokenPair(tokenPair *services.TokenPair) *authpb.TokenPair {
+	return &authpb.TokenPair{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokens.EncodeRefreshTokenToBase64(tokenPair.RefreshToken),
+	}
+}
+
+// userAgent returns the user agent the client sent in the metadata
+func userAgent(ctx context.Context) string {
+	values := metadata.ValueFromIncomingContext(ctx, "user-agent")
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// clientIP returns the address of the peer. Calls over non-IP transports, e.g. unix sockets, get the unspecified address
+func clientIP(ctx context.Context) netip.Addr {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return netip.IPv6Unspecified()
+	}
+
+	if addr, ok := p.Addr.(*net.TCPAddr); ok {
+		if ip, ok := netip.AddrFromSlice(addr.IP); ok {
+			return ip.Unmap()
+		}
+	}
+	return netip.IPv6Unspecified()
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/handlers/middleware"
+	"github.com/kwinso/medods-test-task/internal/handlers/problems"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/services"
+)
+
+// AdminHandler handles the admin API for managing roles. All routes require the services.ScopeAdmin scope.
+type AdminHandler struct {
+	rolesService services.RolesService
+	logger       *slog.Logger
+}
+
+func NewAdminHandler(rolesService services.RolesService, logger *slog.Logger) AdminHandler {
+	return AdminHandler{
+		rolesService: rolesService,
+		logger:       logger,
+	}
+}
+
+func (h *AdminHandler) SetupRoutes(router gin.IRouter, auth middleware.Middleware) {
+	admin := router.Group("/admin")
+	admin.Use(auth.Handle, middleware.RequireScopes(services.ScopeAdmin))
+	{
+		admin.GET("/roles", h.ListRoles)
+		admin.PUT("/roles/:name", h.SaveRole)
+		admin.DELETE("/roles/:name", h.DeleteRole)
+
+		admin.GET("/users/:guid/roles", h.ListUserRoles)
+		admin.PUT("/users/:guid/roles/:name", h.AssignRole)
+		admin.DELETE("/users/:guid/roles/:name", h.UnassignRole)
+	}
+}
+
+// ListRoles handles listing all roles
+// @Summary			List roles
+// @Security		BearerAuth
+// @Produce			json
+// @Success			200	{array}		api.Role
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			403	{object}	api.Problem	"Forbidden"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/admin/roles [get]
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	roles, err := h.rolesService.ListRoles(c.Request.Context())
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to list roles", logging.Err(err))
+		problems.AbortInternal(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, toAPIRoles(roles))
+}
+
+// SaveRole handles creating or updating a role
+// @Summary			Create or update a role
+// @Description	Creates the role or replaces its scopes. Users get the new scopes with their next access token
+// @Security		BearerAuth
+// @Param			name	path	string	true	"role name"
+// @Param			request	body	api.SaveRoleRequest	true	"role scopes"
+// @Accept			json
+// @Produce			json
+// @Success			200	{object}	api.Role
+// @Failure			400	{object}	api.Problem	"Bad Request"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			403	{object}	api.Problem	"Forbidden"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/admin/roles/{name} [put]
+func (h *AdminHandler) SaveRole(c *gin.Context) {
+	name := c.Param("name")
+	if !api.IsValidRoleName(name) {
+		problems.AbortWithInvalidFields(c, api.FieldError{Field: "name", Rule: "role_name", Message: "must be a valid role name"})
+		return
+	}
+
+	var req api.SaveRoleRequest
+	if err := c.ShouldBind(&req); err != nil {
+		problems.AbortWithBindingError(c, err)
+		return
+	}
+
+	role, err := h.rolesService.SaveRole(c.Request.Context(), name, req.Scopes)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to save role", "role", name, logging.Err(err))
+		problems.AbortInternal(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.Role{
+		Name:   role.Name,
+		Scopes: role.Scopes,
+	})
+}
+
+// DeleteRole handles deleting a role
+// @Summary			Delete a role
+// @Description	Deletes the role and unassigns it from all users
+// @Security		BearerAuth
+// @Param			name	path	string	true	"role name"
+// @Success			204 "Role deleted"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			403	{object}	api.Problem	"Forbidden"
+// @Failure			404	{object}	api.Problem	"Not Found"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/admin/roles/{name} [delete]
+func (h *AdminHandler) DeleteRole(c *gin.Context) {
+	name := c.Param("name")
+
+	err := h.rolesService.DeleteRole(c.Request.Context(), name)
+	if err != nil {
+		h.handleRoleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListUserRoles handles listing the roles of a user
+// @Summary			List roles of a user
+// @Security		BearerAuth
+// @Param			guid	path	string	true	"user GUID"
+// @Produce			json
+// @Success			200	{array}		api.Role
+// @Failure			400	{object}	api.Problem	"Bad Request"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			403	{object}	api.Problem	"Forbidden"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/admin/users/{guid}/roles [get]
+func (h *AdminHandler) ListUserRoles(c *gin.Context) {
+	guid := c.Param("guid")
+	if !api.IsValidGUID(guid) {
+		problems.AbortWithInvalidFields(c, api.FieldError{Field: "guid", Rule: "guid", Message: "must be a GUID"})
+		return
+	}
+
+	roles, err := h.rolesService.ListUserRoles(c.Request.Context(), guid)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to list roles", logging.KeyGUID, guid, logging.Err(err))
+		problems.AbortInternal(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, toAPIRoles(roles))
+}
+
+// AssignRole handles assigning a role to a user
+// @Summary			Assign a role to a user
+// @Security		BearerAuth
+// @Param			guid	path	string	true	"user GUID"
+// @Param			name	path	string	true	"role name"
+// @Success			204 "Role assigned"
+// @Failure			400	{object}	api.Problem	"Bad Request"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			403	{object}	api.Problem	"Forbidden"
+// @Failure			404	{object}	api.Problem	"Not Found"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/admin/users/{guid}/roles/{name} [put]
+func (h *AdminHandler) AssignRole(c *gin.Context) {
+	guid := c.Param("guid")
+	if !api.IsValidGUID(guid) {
+		problems.AbortWithInvalidFields(c, api.FieldError{Field: "guid", Rule: "guid", Message: "must be a GUID"})
+		return
+	}
+
+	err := h.rolesService.AssignRole(c.Request.Context(), guid, c.Param("name"))
+	if err != nil {
+		h.handleRoleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UnassignRole handles removing a role from a user
+// @Summary			Remove a role from a user
+// @Security		BearerAuth
+// @Param			guid	path	string	true	"user GUID"
+// @Param			name	path	string	true	"role name"
+// @Success			204 "Role removed"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			403	{object}	api.Problem	"Forbidden"
+// @Failure			404	{object}	api.Problem	"Not Found"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/admin/users/{guid}/roles/{name} [delete]
+func (h *AdminHandler) UnassignRole(c *gin.Context) {
+	err := h.rolesService.UnassignRole(c.Request.Context(), c.Param("guid"), c.Param("name"))
+	if err != nil {
+		h.handleRoleError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AdminHandler) handleRoleError(c *gin.Context, err error) {
+	problems.AbortWithError(c, h.logger, err, "Failed to update roles")
+}
+
+func toAPIRoles(roles []db.Role) []api.Role {
+	result := make([]api.Role, 0, len(roles))
+	for _, role := range roles {
+		result = append(result, api.Role{
+			Name:   role.Name,
+			Scopes: role.Scopes,
+		})
+	}
+	return result
+}
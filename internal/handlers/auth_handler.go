@@ -8,28 +8,41 @@ import (
 	"github.com/kwinso/medods-test-task/internal/api"
 	"github.com/kwinso/medods-test-task/internal/config"
 	"github.com/kwinso/medods-test-task/internal/handlers/middleware"
+	"github.com/kwinso/medods-test-task/internal/handlers/problems"
+	"github.com/kwinso/medods-test-task/internal/logging"
 	"github.com/kwinso/medods-test-task/internal/services"
 	"github.com/kwinso/medods-test-task/internal/tokens"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/netip"
 )
 
 type AuthHandler struct {
-	Config      config.Config
-	authService services.AuthService
-	logger      *log.Logger
+	Config        config.Config
+	authService   services.AuthService
+	authenticator services.Authenticator
+	issuer        sessionIssuer
+	cookies       *TokenCookies
+	logger        *slog.Logger
 }
 
-func NewAuthHandler(cfg config.Config, authService services.AuthService, logger *log.Logger) AuthHandler {
+func NewAuthHandler(cfg config.Config, authService services.AuthService, authenticator services.Authenticator, mfaService services.MFAService, cookies *TokenCookies, logger *slog.Logger) AuthHandler {
 	return AuthHandler{
-		Config:      cfg,
-		authService: authService,
-		logger:      logger,
+		Config:        cfg,
+		authService:   authService,
+		authenticator: authenticator,
+		issuer: sessionIssuer{
+			authService: authService,
+			mfaService:  mfaService,
+			cookies:     cookies,
+			logger:      logger,
+		},
+		cookies: cookies,
+		logger:  logger,
 	}
 }
 
-func (h *AuthHandler) SetupRoutes(router *gin.Engine, auth middleware.Middleware) {
+func (h *AuthHandler) SetupRoutes(router gin.IRouter, auth middleware.Middleware) {
 	router.POST("/login", h.Login)
 	router.PUT("/refresh", h.RefreshTokens)
 
@@ -41,43 +54,38 @@ func (h *AuthHandler) SetupRoutes(router *gin.Engine, auth middleware.Middleware
 	}
 }
 
-// Login handles generating a pair of tokens for a requested GUID
+// Login handles generating a pair of tokens for a requested GUID.
+// The GUID is verified by the configured authenticator before the session is created.
+// If the user has MFA enabled, an MFA challenge is returned instead of the tokens.
 // @Summary	Generate a token pair from guid
 // @Param		request	body	api.LoginRequest	true	"login request"
+// @Param		X-Token-Transport	header	string	false	"set to `cookie` to get the tokens in HttpOnly cookies instead, see api.CookieSessionResponse"
 // @Accept		json
 // @Produce	json
 // @Success	200	{object}	api.TokenPair
-// @Failure	400	{object}	api.ErrorResponse	"Bad Request"
-// @Failure	500 {object}	api.ErrorResponse	"Internal Server Error"
-// @Router		/login [post]
+// @Success	202	{object}	api.MFAChallengeResponse	"MFA required"
+// @Failure	400	{object}	api.Problem	"Bad Request"
+// @Failure	401	{object}	api.Problem	"Unauthorized"
+// @Failure	500 {object}	api.Problem	"Internal Server Error"
+// @Router		/v1/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req api.LoginRequest
 	if err := c.ShouldBind(&req); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
+		problems.AbortWithBindingError(c, err)
 		return
 	}
 
-	ua := c.Request.UserAgent()
-	ipString := c.ClientIP()
-	inet, err := netip.ParseAddr(ipString)
+	err := h.authenticator.Authenticate(c.Request.Context(), req.GUID, req.Assertion)
 	if err != nil {
-		h.logger.Printf("Failed to parse IP address: %v\n", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.InternalServerErrorResponse)
-		return
-	}
-
-	tokenPair, err := h.authService.AuthorizeByGUID(c.Request.Context(), req.GUID, ua, inet)
-
-	if err != nil {
-		h.logger.Printf("Failed to authorize user: %v\n", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.InternalServerErrorResponse)
+		if errors.Is(err, services.ErrIdentityNotVerified) {
+			h.logger.InfoContext(c.Request.Context(), "Identity verification failed",
+				logging.KeyEvent, "login_rejected", logging.KeyGUID, req.GUID, logging.Err(err))
+		}
+		problems.AbortWithError(c, h.logger, err, "Failed to verify identity", logging.KeyGUID, req.GUID)
 		return
 	}
 
-	c.JSON(http.StatusOK, api.TokenPair{
-		AccessToken:  tokenPair.AccessToken,
-		RefreshToken: tokens.EncodeRefreshTokenToBase64(tokenPair.RefreshToken),
-	})
+	h.issuer.completeLogin(c, req.GUID, []string{tokens.AMRExternal})
 }
 
 // GetMe handles getting authorized user GUID
@@ -86,9 +94,9 @@ func (h *AuthHandler) Login(c *gin.Context) {
 // @Security		BearerAuth
 // @Produce			json
 // @Success			200	{object}	api.GetMeResponse
-// @Failure			401	{object}	api.ErrorResponse	"Unauthorized"
-// @Failure			500 {object}	api.ErrorResponse	"Internal Server Error"
-// @Router			/me [get]
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/me [get]
 func (h *AuthHandler) GetMe(c *gin.Context) {
 	guid := c.GetString("user_guid")
 
@@ -99,48 +107,56 @@ func (h *AuthHandler) GetMe(c *gin.Context) {
 
 // RefreshTokens is a route for handling tokens refresh
 // @Summary			Refresh the access token for the authenticated user
-// @Description	Refresh the access token for the authenticated user
-// @Param			request	body	api.RefreshRequest	true	"refresh request"
+// @Description	Refresh the access token for the authenticated user.
+// @Description	In cookie mode the refresh token cookie is used instead of the body, and the new tokens are set in cookies
+// @Param			request	body	api.RefreshRequest	false	"refresh request, not needed with the refresh token cookie"
+// @Param			X-CSRF-Token	header	string	false	"CSRF token, required with the refresh token cookie"
 // @Accept			json
 // @Produce			json
 // @Success			200	{object}	api.TokenPair
-// @Failure			400	{object}	api.ErrorResponse	"Bad Request"
-// @Failure			401	{object}	api.ErrorResponse	"Unauthorized"
-// @Failure			500 {object}	api.ErrorResponse	"Internal Server Error"
-// @Router			/refresh [put]
+// @Failure			400	{object}	api.Problem	"Bad Request"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			403	{object}	api.Problem	"CSRF token mismatch"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/refresh [put]
 func (h *AuthHandler) RefreshTokens(c *gin.Context) {
-	var req api.RefreshRequest
-	if err := c.ShouldBind(&req); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.ErrorResponse{Error: err.Error()})
-		return
+	refreshToken, fromCookie := h.cookies.refreshToken(c)
+	if fromCookie {
+		if !middleware.CheckCSRF(c) {
+			return
+		}
+	} else {
+		var req api.RefreshRequest
+		if err := c.ShouldBind(&req); err != nil {
+			problems.AbortWithBindingError(c, err)
+			return
+		}
+
+		// decode token from base64
+		token, err := base64.StdEncoding.DecodeString(req.RefreshToken)
+		if err != nil {
+			problems.Abort(c, api.NewProblem(http.StatusUnauthorized, api.CodeInvalidRefreshToken, "The refresh token is not valid base64"))
+			return
+		}
+		refreshToken = string(token)
 	}
 
 	ipString := c.ClientIP()
 	inet, err := netip.ParseAddr(ipString)
 	if err != nil {
-		h.logger.Printf("Failed to parse IP address: %v\n", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.InternalServerErrorResponse)
+		h.logger.ErrorContext(c.Request.Context(), "Failed to parse IP address", logging.Err(err))
+		problems.AbortInternal(c)
 		return
 	}
 
-	// decode token from base64
-	token, err := base64.StdEncoding.DecodeString(req.RefreshToken)
+	tokenPair, err := h.authService.RefreshAuth(c.Request.Context(), refreshToken, c.GetHeader("User-Agent"), inet)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, api.BadRequestResponse)
+		problems.AbortWithError(c, h.logger, err, "Failed to refresh auth")
 		return
 	}
 
-	tokenPair, err := h.authService.RefreshAuth(c.Request.Context(), string(token), c.GetHeader("User-Agent"), inet)
-	if err != nil {
-		if errors.Is(err, services.ErrUserAgentMismatch) ||
-			errors.Is(err, services.ErrInvalidTokenFormat) ||
-			errors.Is(err, services.ErrAuthExpired) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, api.UnauthorizedResponse)
-		} else {
-			h.logger.Printf("Failed to refresh auth: %v\n", err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, api.InternalServerErrorResponse)
-		}
-
+	if fromCookie {
+		respondWithCookies(c, h.cookies, tokenPair, h.logger)
 		return
 	}
 
@@ -152,21 +168,24 @@ func (h *AuthHandler) RefreshTokens(c *gin.Context) {
 
 // Logout handles logout logic
 // @Summary			Logout the authenticated user
-// @Description	Deletes the auth for the authenticated user
+// @Description	Deletes the auth for the authenticated user and clears the token cookies
 // @Security		BearerAuth
+// @Param			X-CSRF-Token	header	string	false	"CSRF token, required with the access token cookie"
 // @Success			204 "Successfully logged out"
-// @Failure			401	{object}	api.ErrorResponse	"Unauthorized"
-// @Failure			500 {object}	api.ErrorResponse	"Internal Server Error"
-// @Router			/logout [delete]
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			403	{object}	api.Problem	"CSRF token mismatch"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/logout [delete]
 func (h *AuthHandler) Logout(c *gin.Context) {
 	authId := c.MustGet("auth_id").(uuid.UUID)
 
 	err := h.authService.DeleteAuthById(c.Request.Context(), authId)
 	if err != nil {
-		h.logger.Printf("Failed to delete auth id %d: %v\n", authId, err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.InternalServerErrorResponse)
+		h.logger.ErrorContext(c.Request.Context(), "Failed to delete auth", logging.KeyAuthID, authId, logging.Err(err))
+		problems.AbortInternal(c)
 		return
 	}
 
+	h.cookies.clear(c)
 	c.JSON(http.StatusNoContent, nil)
 }
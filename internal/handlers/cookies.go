@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/handlers/middleware"
+	"github.com/kwinso/medods-test-task/internal/services"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+const (
+	// TokenTransportHeader set to TokenTransportCookie asks the login routes to set the tokens in cookies
+	TokenTransportHeader = "X-Token-Transport"
+	TokenTransportCookie = "cookie"
+)
+
+var sameSiteModes = map[string]http.SameSite{
+	config.CookieSameSiteStrict: http.SameSiteStrictMode,
+	config.CookieSameSiteLax:    http.SameSiteLaxMode,
+	config.CookieSameSiteNone:   http.SameSiteNoneMode,
+}
+
+// TokenCookies hands the tokens to browser clients in Secure HttpOnly cookies, so they are never exposed to JS.
+// Clients opt in with TokenTransportHeader on login, after that refresh and logout use the cookies.
+// Each time the tokens are set, a new CSRF token is issued for middleware.CheckCSRF.
+type TokenCookies struct {
+	settings *config.Store
+	entropy  tokens.Entropy
+	// basePath is where the API routes are mounted. The access token cookie is scoped to it,
+	// the refresh token cookie only to the refresh route
+	basePath string
+}
+
+// NewTokenCookies creates TokenCookies for the API routes mounted at basePath. CSRF tokens are generated from entropy
+func NewTokenCookies(settings *config.Store, entropy tokens.Entropy, basePath string) *TokenCookies {
+	return &TokenCookies{
+		settings: settings,
+		entropy:  entropy,
+		basePath: basePath,
+	}
+}
+
+// requested checks if cookie mode is enabled and the client asked for cookies
+func (t *TokenCookies) requested(c *gin.Context) bool {
+	return t.settings.Get().CookieMode && c.GetHeader(TokenTransportHeader) == TokenTransportCookie
+}
+
+// refreshToken returns the refresh token from the cookie. Returns false if there's none or cookie mode is disabled
+func (t *TokenCookies) refreshToken(c *gin.Context) (string, bool) {
+	if !t.settings.Get().CookieMode {
+		return "", false
+	}
+	token, err := c.Cookie(middleware.RefreshTokenCookie)
+	return token, err == nil && token != ""
+}
+
+// set sets the token cookies along with a new CSRF token. Returns the CSRF token
+func (t *TokenCookies) set(c *gin.Context, pair *services.TokenPair) (string, error) {
+	csrfToken, err := tokens.GenerateCSRFToken(t.entropy)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := t.settings.Get()
+	tokenMaxAge := int(cfg.TokenTTL.Seconds())
+	sessionMaxAge := int(cfg.AuthTTL.Seconds())
+	t.setCookie(c, middleware.AccessTokenCookie, pair.AccessToken, t.basePath, tokenMaxAge, true)
+	t.setCookie(c, middleware.RefreshTokenCookie, pair.RefreshToken, t.refreshPath(), sessionMaxAge, true)
+	t.setCookie(c, middleware.CSRFTokenCookie, csrfToken, "/", sessionMaxAge, false)
+	return csrfToken, nil
+}
+
+// clear removes the token cookies if cookie mode is enabled
+func (t *TokenCookies) clear(c *gin.Context) {
+	if !t.settings.Get().CookieMode {
+		return
+	}
+	t.setCookie(c, middleware.AccessTokenCookie, "", t.basePath, -1, true)
+	t.setCookie(c, middleware.RefreshTokenCookie, "", t.refreshPath(), -1, true)
+	t.setCookie(c, middleware.CSRFTokenCookie, "", "/", -1, false)
+}
+
+func (t *TokenCookies) setCookie(c *gin.Context, name, value, cookiePath string, maxAge int, httpOnly bool) {
+	cfg := t.settings.Get()
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cookiePath,
+		Domain:   cfg.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: sameSiteModes[cfg.CookieSameSite],
+	})
+}
+
+func (t *TokenCookies) refreshPath() string {
+	return path.Join(t.basePath, "refresh")
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/handlers/middleware"
+	"github.com/kwinso/medods-test-task/internal/handlers/problems"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/services"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+// CredentialsHandler handles username/password credentials for staff accounts
+type CredentialsHandler struct {
+	credentialsService services.CredentialsService
+	issuer             sessionIssuer
+	logger             *slog.Logger
+}
+
+func NewCredentialsHandler(authService services.AuthService, credentialsService services.CredentialsService, mfaService services.MFAService, cookies *TokenCookies, logger *slog.Logger) CredentialsHandler {
+	return CredentialsHandler{
+		credentialsService: credentialsService,
+		issuer: sessionIssuer{
+			authService: authService,
+			mfaService:  mfaService,
+			cookies:     cookies,
+			logger:      logger,
+		},
+		logger: logger,
+	}
+}
+
+func (h *CredentialsHandler) SetupRoutes(router gin.IRouter, auth middleware.Middleware) {
+	router.POST("/login/password", h.PasswordLogin)
+
+	authorized := router.Group("/")
+	authorized.Use(auth.Handle)
+	{
+		authorized.POST("/credentials", h.Register)
+		authorized.PUT("/credentials/password", h.ChangePassword)
+	}
+}
+
+// PasswordLogin handles generating a pair of tokens for username and password
+// @Summary	Generate a token pair from username and password
+// @Param		request	body	api.PasswordLoginRequest	true	"password login request"
+// @Param		X-Token-Transport	header	string	false	"set to `cookie` to get the tokens in HttpOnly cookies instead, see api.CookieSessionResponse"
+// @Accept		json
+// @Produce	json
+// @Success	200	{object}	api.TokenPair
+// @Success	202	{object}	api.MFAChallengeResponse	"MFA required"
+// @Failure	400	{object}	api.Problem	"Bad Request"
+// @Failure	401	{object}	api.Problem	"Unauthorized"
+// @Failure	429	{object}	api.Problem	"Too Many Requests"
+// @Failure	500 {object}	api.Problem	"Internal Server Error"
+// @Router		/v1/login/password [post]
+func (h *CredentialsHandler) PasswordLogin(c *gin.Context) {
+	var req api.PasswordLoginRequest
+	if err := c.ShouldBind(&req); err != nil {
+		problems.AbortWithBindingError(c, err)
+		return
+	}
+
+	ipString := c.ClientIP()
+	inet, err := netip.ParseAddr(ipString)
+	if err != nil {
+		h.logger.ErrorContext(c.Request.Context(), "Failed to parse IP address", logging.Err(err))
+		problems.AbortInternal(c)
+		return
+	}
+
+	guid, err := h.credentialsService.Verify(c.Request.Context(), req.Username, req.Password, inet)
+	if err != nil {
+		problems.AbortWithError(c, h.logger, err, "Failed to verify credentials")
+		return
+	}
+
+	h.issuer.completeLogin(c, guid, []string{tokens.AMRPassword})
+}
+
+// Register handles creating credentials for the authenticated user
+// @Summary			Register username and password for the authenticated user
+// @Description	Links a username and password to the GUID of the authenticated user, so it can use password login
+// @Security		BearerAuth
+// @Param			request	body	api.RegisterCredentialsRequest	true	"register request"
+// @Accept			json
+// @Success			201 "Credentials created"
+// @Failure			400	{object}	api.Problem	"Bad Request"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			409	{object}	api.Problem	"Conflict"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/credentials [post]
+func (h *CredentialsHandler) Register(c *gin.Context) {
+	var req api.RegisterCredentialsRequest
+	if err := c.ShouldBind(&req); err != nil {
+		problems.AbortWithBindingError(c, err)
+		return
+	}
+
+	guid := c.GetString("user_guid")
+	err := h.credentialsService.Register(c.Request.Context(), guid, req.Username, req.Password)
+	if err != nil {
+		problems.AbortWithError(c, h.logger, err, "Failed to register credentials", logging.KeyGUID, guid)
+		return
+	}
+
+	c.Status(http.StatusCreated)
+}
+
+// ChangePassword handles changing the password of the authenticated user
+// @Summary			Change password of the authenticated user
+// @Security		BearerAuth
+// @Param			request	body	api.ChangePasswordRequest	true	"change password request"
+// @Accept			json
+// @Success			204 "Password changed"
+// @Failure			400	{object}	api.Problem	"Bad Request"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/credentials/password [put]
+func (h *CredentialsHandler) ChangePassword(c *gin.Context) {
+	var req api.ChangePasswordRequest
+	if err := c.ShouldBind(&req); err != nil {
+		problems.AbortWithBindingError(c, err)
+		return
+	}
+
+	guid := c.GetString("user_guid")
+	err := h.credentialsService.ChangePassword(c.Request.Context(), guid, req.OldPassword, req.NewPassword)
+	if err != nil {
+		problems.AbortWithError(c, h.logger, err, "Failed to change password", logging.KeyGUID, guid)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
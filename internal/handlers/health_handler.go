@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck checks a single dependency of the service. It returns an error if the dependency isn't usable
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	checks   []HealthCheck
+	shutdown <-chan struct{}
+}
+
+// NewHealthHandler creates a HealthHandler. Readiness starts failing as soon as shutdown is closed,
+// so the orchestrator stops sending traffic while the server drains.
+func NewHealthHandler(shutdown <-chan struct{}, checks ...HealthCheck) HealthHandler {
+	return HealthHandler{
+		checks:   checks,
+		shutdown: shutdown,
+	}
+}
+
+func (h *HealthHandler) SetupRoutes(router *gin.Engine) {
+	router.GET("/healthz", h.Live)
+	router.GET("/readyz", h.Ready)
+}
+
+// Live handles the liveness probe
+// @Summary			Liveness probe
+// @Description	Responds with 200 as long as the process is up
+// @Produce			json
+// @Success			200	{object}	api.HealthResponse
+// @Router			/healthz [get]
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, api.HealthResponse{Status: api.HealthStatusUp})
+}
+
+// Ready handles the readiness probe
+// @Summary			Readiness probe
+// @Description	Checks the database and the migrations version. Fails during shutdown
+// @Produce			json
+// @Success			200	{object}	api.HealthResponse
+// @Failure			503	{object}	api.HealthResponse	"Not ready"
+// @Router			/readyz [get]
+func (h *HealthHandler) Ready(c *gin.Context) {
+	response := api.HealthResponse{
+		Status:     api.HealthStatusUp,
+		Components: make(map[string]api.ComponentHealth, len(h.checks)+1),
+	}
+
+	select {
+	case <-h.shutdown:
+		response.Status = api.HealthStatusDown
+		response.Components["shutdown"] = api.ComponentHealth{
+			Status: api.HealthStatusDown,
+			Error:  "server is shutting down",
+		}
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthCheckTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			component := api.ComponentHealth{Status: api.HealthStatusUp}
+			if err := check.Check(ctx); err != nil {
+				component = api.ComponentHealth{Status: api.HealthStatusDown, Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Components[check.Name] = component
+			if component.Status == api.HealthStatusDown {
+				response.Status = api.HealthStatusDown
+			}
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if response.Status == api.HealthStatusDown {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
+}
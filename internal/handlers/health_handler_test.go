@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+)
+
+func TestHealthHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	up := HealthCheck{Name: "database", Check: func(context.Context) error { return nil }}
+	down := HealthCheck{Name: "migrations", Check: func(context.Context) error { return errors.New("expected migration version 8, got 7") }}
+
+	cases := map[string]struct {
+		path           string
+		checks         []HealthCheck
+		shuttingDown   bool
+		expectedStatus int
+		expected       api.HealthResponse
+	}{
+		"live": {
+			path:           "/healthz",
+			checks:         []HealthCheck{down},
+			expectedStatus: http.StatusOK,
+			expected:       api.HealthResponse{Status: api.HealthStatusUp},
+		},
+		"live during shutdown": {
+			path:           "/healthz",
+			shuttingDown:   true,
+			expectedStatus: http.StatusOK,
+			expected:       api.HealthResponse{Status: api.HealthStatusUp},
+		},
+		"ready": {
+			path:           "/readyz",
+			checks:         []HealthCheck{up},
+			expectedStatus: http.StatusOK,
+			expected: api.HealthResponse{Status: api.HealthStatusUp, Components: map[string]api.ComponentHealth{
+				"database": {Status: api.HealthStatusUp},
+			}},
+		},
+		"failing component": {
+			path:           "/readyz",
+			checks:         []HealthCheck{up, down},
+			expectedStatus: http.StatusServiceUnavailable,
+			expected: api.HealthResponse{Status: api.HealthStatusDown, Components: map[string]api.ComponentHealth{
+				"database":   {Status: api.HealthStatusUp},
+				"migrations": {Status: api.HealthStatusDown, Error: "expected migration version 8, got 7"},
+			}},
+		},
+		"shutting down": {
+			path:           "/readyz",
+			checks:         []HealthCheck{up},
+			shuttingDown:   true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expected: api.HealthResponse{Status: api.HealthStatusDown, Components: map[string]api.ComponentHealth{
+				"database": {Status: api.HealthStatusUp},
+				"shutdown": {Status: api.HealthStatusDown, Error: "server is shutting down"},
+			}},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			shutdown := make(chan struct{})
+			if tc.shuttingDown {
+				close(shutdown)
+			}
+			handler := NewHealthHandler(shutdown, tc.checks...)
+			router := gin.New()
+			handler.SetupRoutes(router)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if w.Code != tc.expectedStatus {
+				t.Errorf("expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			expected, err := json.Marshal(tc.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w.Body.String() != string(expected) {
+				t.Errorf("expected %s, got %s", expected, w.Body.String())
+			}
+		})
+	}
+}
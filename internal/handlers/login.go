@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/handlers/problems"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/services"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+// sessionIssuer finishes a login once the identity is verified.
+// It's shared by all the login routes, so every one of them respects MFA.
+type sessionIssuer struct {
+	authService services.AuthService
+	mfaService  services.MFAService
+	cookies     *TokenCookies
+	logger      *slog.Logger
+}
+
+// completeLogin responds with an MFA challenge if the user has MFA enabled, otherwise it issues the token pair
+func (i *sessionIssuer) completeLogin(c *gin.Context, guid string, amr []string) {
+	enabled, err := i.mfaService.IsEnabled(c.Request.Context(), guid)
+	if err != nil {
+		i.logger.ErrorContext(c.Request.Context(), "Failed to check MFA", logging.KeyGUID, guid, logging.Err(err))
+		problems.AbortInternal(c)
+		return
+	}
+
+	if !enabled {
+		i.issueTokens(c, guid, amr)
+		return
+	}
+
+	challenge, err := i.mfaService.IssueChallenge(guid, amr)
+	if err != nil {
+		i.logger.ErrorContext(c.Request.Context(), "Failed to issue MFA challenge", logging.KeyGUID, guid, logging.Err(err))
+		problems.AbortInternal(c)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, api.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    challenge,
+	})
+}
+
+// issueTokens creates a new session and responds with its token pair, or sets it in cookies if the client asked for it
+func (i *sessionIssuer) issueTokens(c *gin.Context, guid string, amr []string) {
+	ipString := c.ClientIP()
+	inet, err := netip.ParseAddr(ipString)
+	if err != nil {
+		i.logger.ErrorContext(c.Request.Context(), "Failed to parse IP address", logging.Err(err))
+		problems.AbortInternal(c)
+		return
+	}
+
+	tokenPair, err := i.authService.AuthorizeByGUID(c.Request.Context(), guid, amr, c.Request.UserAgent(), inet)
+	if err != nil {
+		i.logger.ErrorContext(c.Request.Context(), "Failed to authorize user", logging.KeyGUID, guid, logging.Err(err))
+		problems.AbortInternal(c)
+		return
+	}
+
+	if i.cookies.requested(c) {
+		respondWithCookies(c, i.cookies, tokenPair, i.logger)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.TokenPair{
+		AccessToken:  tokenPair.AccessToken,
+		RefreshToken: tokens.EncodeRefreshTokenToBase64(tokenPair.RefreshToken),
+	})
+}
+
+// respondWithCookies sets the token pair in cookies and responds with the new CSRF token
+func respondWithCookies(c *gin.Context, cookies *TokenCookies, tokenPair *services.TokenPair, logger *slog.Logger) {
+	csrfToken, err := cookies.set(c, tokenPair)
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to generate CSRF token", logging.Err(err))
+		problems.AbortInternal(c)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.CookieSessionResponse{CSRFToken: csrfToken})
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/handlers/middleware"
+	"github.com/kwinso/medods-test-task/internal/handlers/problems"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/services"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+// MFAHandler handles TOTP enrollment and the second step of the login
+type MFAHandler struct {
+	mfaService services.MFAService
+	issuer     sessionIssuer
+	logger     *slog.Logger
+}
+
+func NewMFAHandler(authService services.AuthService, mfaService services.MFAService, cookies *TokenCookies, logger *slog.Logger) MFAHandler {
+	return MFAHandler{
+		mfaService: mfaService,
+		issuer: sessionIssuer{
+			authService: authService,
+			mfaService:  mfaService,
+			cookies:     cookies,
+			logger:      logger,
+		},
+		logger: logger,
+	}
+}
+
+func (h *MFAHandler) SetupRoutes(router gin.IRouter, auth middleware.Middleware) {
+	router.POST("/login/mfa", h.MFALogin)
+
+	authorized := router.Group("/mfa")
+	authorized.Use(auth.Handle)
+	{
+		authorized.POST("/totp", h.EnrollTOTP)
+		authorized.POST("/totp/confirm", h.ConfirmTOTP)
+	}
+
+	stepUp := authorized.Group("/")
+	stepUp.Use(middleware.RequireACR(tokens.ACRMultiFactor))
+	{
+		stepUp.DELETE("/totp", h.DisableTOTP)
+		stepUp.POST("/recovery-codes", h.RegenerateRecoveryCodes)
+	}
+}
+
+// MFALogin handles the second step of the login for users with MFA enabled
+// @Summary			Complete the login with a second factor
+// @Description	Exchanges the MFA challenge token and a TOTP or recovery code for a token pair
+// @Param			request	body	api.MFALoginRequest	true	"mfa login request"
+// @Param			X-Token-Transport	header	string	false	"set to `cookie` to get the tokens in HttpOnly cookies instead, see api.CookieSessionResponse"
+// @Accept			json
+// @Produce			json
+// @Success			200	{object}	api.TokenPair
+// @Failure			400	{object}	api.Problem	"Bad Request"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			429	{object}	api.Problem	"Too Many Requests"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/login/mfa [post]
+func (h *MFAHandler) MFALogin(c *gin.Context) {
+	var req api.MFALoginRequest
+	if err := c.ShouldBind(&req); err != nil {
+		problems.AbortWithBindingError(c, err)
+		return
+	}
+
+	guid, amr, err := h.mfaService.CompleteChallenge(c.Request.Context(), req.MFAToken, req.Code, req.RecoveryCode)
+	if err != nil {
+		problems.AbortWithError(c, h.logger, err, "Failed to complete MFA challenge")
+		return
+	}
+
+	h.issuer.issueTokens(c, guid, amr)
+}
+
+// EnrollTOTP handles starting the TOTP enrollment
+// @Summary			Start TOTP enrollment
+// @Description	Generates a TOTP secret for the authenticated user. It must be confirmed with /mfa/totp/confirm
+// @Security		BearerAuth
+// @Produce			json
+// @Success			200	{object}	api.TOTPEnrollmentResponse
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			409	{object}	api.Problem	"Conflict"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/mfa/totp [post]
+func (h *MFAHandler) EnrollTOTP(c *gin.Context) {
+	guid := c.GetString("user_guid")
+
+	enrollment, err := h.mfaService.EnrollTOTP(c.Request.Context(), guid)
+	if err != nil {
+		problems.AbortWithError(c, h.logger, err, "Failed to enroll TOTP", logging.KeyGUID, guid)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.TOTPEnrollmentResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+// ConfirmTOTP handles finishing the TOTP enrollment
+// @Summary			Confirm TOTP enrollment
+// @Description	Enables TOTP for the authenticated user and returns recovery codes
+// @Security		BearerAuth
+// @Param			request	body	api.ConfirmTOTPRequest	true	"confirm request"
+// @Accept			json
+// @Produce			json
+// @Success			200	{object}	api.RecoveryCodesResponse
+// @Failure			400	{object}	api.Problem	"Bad Request"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			409	{object}	api.Problem	"Conflict"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/mfa/totp/confirm [post]
+func (h *MFAHandler) ConfirmTOTP(c *gin.Context) {
+	var req api.ConfirmTOTPRequest
+	if err := c.ShouldBind(&req); err != nil {
+		problems.AbortWithBindingError(c, err)
+		return
+	}
+
+	guid := c.GetString("user_guid")
+	codes, err := h.mfaService.ConfirmTOTP(c.Request.Context(), guid, req.Code)
+	if err != nil {
+		// the session is fine, a wrong code only fails the confirmation
+		if errors.Is(err, services.ErrInvalidMFACode) {
+			problems.Abort(c, api.NewProblem(http.StatusBadRequest, api.CodeInvalidMFACode, "The TOTP code is wrong"))
+			return
+		}
+		problems.AbortWithError(c, h.logger, err, "Failed to confirm TOTP", logging.KeyGUID, guid)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP handles turning MFA off
+// @Summary			Disable TOTP
+// @Description	Removes TOTP and recovery codes of the authenticated user. Requires an MFA session
+// @Security		BearerAuth
+// @Success			204 "TOTP disabled"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/mfa/totp [delete]
+func (h *MFAHandler) DisableTOTP(c *gin.Context) {
+	guid := c.GetString("user_guid")
+
+	err := h.mfaService.DisableTOTP(c.Request.Context(), guid)
+	if err != nil {
+		problems.AbortWithError(c, h.logger, err, "Failed to disable TOTP", logging.KeyGUID, guid)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes handles replacing the recovery codes
+// @Summary			Regenerate recovery codes
+// @Description	Replaces all recovery codes of the authenticated user. Requires an MFA session
+// @Security		BearerAuth
+// @Produce			json
+// @Success			200	{object}	api.RecoveryCodesResponse
+// @Failure			400	{object}	api.Problem	"Bad Request"
+// @Failure			401	{object}	api.Problem	"Unauthorized"
+// @Failure			500 {object}	api.Problem	"Internal Server Error"
+// @Router			/v1/mfa/recovery-codes [post]
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	guid := c.GetString("user_guid")
+
+	codes, err := h.mfaService.RegenerateRecoveryCodes(c.Request.Context(), guid)
+	if err != nil {
+		problems.AbortWithError(c, h.logger, err, "Failed to regenerate recovery codes", logging.KeyGUID, guid)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.RecoveryCodesResponse{RecoveryCodes: codes})
+}
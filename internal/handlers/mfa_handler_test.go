@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/services"
+)
+
+const testGuid = "2b0d1f4e-8a4c-4f5e-9a39-3f1c6f7d2b11"
+
+// fakeMFAService fails the MFA management calls with err
+type fakeMFAService struct {
+	services.MFAService
+	err error
+}
+
+func (s *fakeMFAService) DisableTOTP(context.Context, string) error {
+	return s.err
+}
+
+func (s *fakeMFAService) RegenerateRecoveryCodes(context.Context, string) ([]string, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []string{"code"}, nil
+}
+
+func TestMFAHandlerErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	routes := map[string]struct {
+		method         string
+		path           string
+		handle         func(h *MFAHandler) gin.HandlerFunc
+		expectedStatus int
+	}{
+		"disable totp": {
+			method:         http.MethodDelete,
+			path:           "/mfa/totp",
+			handle:         func(h *MFAHandler) gin.HandlerFunc { return h.DisableTOTP },
+			expectedStatus: http.StatusNoContent,
+		},
+		"regenerate recovery codes": {
+			method:         http.MethodPost,
+			path:           "/mfa/recovery-codes",
+			handle:         func(h *MFAHandler) gin.HandlerFunc { return h.RegenerateRecoveryCodes },
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	cases := map[string]struct {
+		err error
+		// expectedStatus and expectedCode are of the problem, zero expectedStatus means the route's success status
+		expectedStatus int
+		expectedCode   string
+	}{
+		"success":       {},
+		"not enrolled":  {err: services.ErrMFANotEnrolled, expectedStatus: http.StatusBadRequest, expectedCode: api.CodeMFANotEnrolled},
+		"unknown error": {err: errors.New("connection refused"), expectedStatus: http.StatusInternalServerError, expectedCode: api.CodeInternalError},
+	}
+
+	for routeName, route := range routes {
+		for name, tc := range cases {
+			t.Run(routeName+"/"+name, func(t *testing.T) {
+				h := NewMFAHandler(nil, &fakeMFAService{err: tc.err}, nil, logging.Discard())
+				router := gin.New()
+				router.Handle(route.method, route.path, func(c *gin.Context) {
+					c.Set("user_guid", testGuid)
+				}, route.handle(&h))
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(route.method, route.path, nil))
+
+				if tc.expectedStatus == 0 {
+					if w.Code != route.expectedStatus {
+						t.Errorf("expected status %d, got %d", route.expectedStatus, w.Code)
+					}
+					return
+				}
+				if w.Code != tc.expectedStatus {
+					t.Errorf("expected status %d, got %d", tc.expectedStatus, w.Code)
+				}
+				var problem api.Problem
+				if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+					t.Fatal(err)
+				}
+				if problem.Code != tc.expectedCode {
+					t.Errorf("expected code %s, got %s", tc.expectedCode, problem.Code)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		origin   string
+		expected bool
+	}{
+		{"https://portal.example.com", "https://portal.example.com", true},
+		{"https://portal.example.com", "https://PORTAL.example.com", true},
+		{"https://portal.example.com", "http://portal.example.com", false},
+		{"https://portal.example.com", "https://portal.example.com:8443", false},
+		{"https://*.example.com", "https://portal.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://evil-example.com", false},
+		{"https://*.example.com", "https://example.com.evil.com", false},
+		{"https://*.example.com", "http://portal.example.com", false},
+		{"https://*.example.com:8443", "https://portal.example.com:8443", true},
+		{"https://*.example.com", "https://portal.example.com:8443", false},
+	}
+
+	for _, c := range cases {
+		if actual := matchOrigin(c.pattern, c.origin); actual != c.expected {
+			t.Errorf("matchOrigin(%q, %q) = %t, expected %t", c.pattern, c.origin, actual, c.expected)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := CORSConfig{
+		AllowedOrigins:   []string{"https://portal.example.com", "https://*.apps.example.com"},
+		AllowedMethods:   []string{"GET", "PUT"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+
+	cases := map[string]struct {
+		cfg             CORSConfig
+		method          string
+		origin          string
+		preflight       bool
+		expectedStatus  int
+		expectedOrigin  string
+		expectedMethods string
+	}{
+		"same origin request": {
+			cfg: cfg, method: http.MethodGet, expectedStatus: http.StatusOK,
+		},
+		"allowed origin": {
+			cfg: cfg, method: http.MethodGet, origin: "https://portal.example.com",
+			expectedStatus: http.StatusOK, expectedOrigin: "https://portal.example.com",
+		},
+		"allowed subdomain": {
+			cfg: cfg, method: http.MethodGet, origin: "https://billing.apps.example.com",
+			expectedStatus: http.StatusOK, expectedOrigin: "https://billing.apps.example.com",
+		},
+		"other origin is served without headers": {
+			cfg: cfg, method: http.MethodGet, origin: "https://evil.com", expectedStatus: http.StatusOK,
+		},
+		"preflight": {
+			cfg: cfg, method: http.MethodOptions, origin: "https://portal.example.com", preflight: true,
+			expectedStatus: http.StatusNoContent, expectedOrigin: "https://portal.example.com", expectedMethods: "GET, PUT",
+		},
+		"preflight from other origin": {
+			cfg: cfg, method: http.MethodOptions, origin: "https://evil.com", preflight: true,
+			expectedStatus: http.StatusForbidden,
+		},
+		"any origin without credentials": {
+			cfg:    CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}},
+			method: http.MethodGet, origin: "https://evil.com", expectedStatus: http.StatusOK, expectedOrigin: "*",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(CORS(c.cfg))
+			router.GET("/me", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			router.NoRoute(func(c *gin.Context) {
+				c.Status(http.StatusNotFound)
+			})
+
+			req := httptest.NewRequest(c.method, "/me", nil)
+			if c.origin != "" {
+				req.Header.Set("Origin", c.origin)
+			}
+			if c.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != c.expectedStatus {
+				t.Errorf("expected status %d, got %d", c.expectedStatus, w.Code)
+			}
+			if actual := w.Header().Get("Access-Control-Allow-Origin"); actual != c.expectedOrigin {
+				t.Errorf("expected Access-Control-Allow-Origin %q, got %q", c.expectedOrigin, actual)
+			}
+			if actual := w.Header().Get("Access-Control-Allow-Methods"); actual != c.expectedMethods {
+				t.Errorf("expected Access-Control-Allow-Methods %q, got %q", c.expectedMethods, actual)
+			}
+			if c.expectedOrigin != "" && c.cfg.AllowCredentials && w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Error("expected credentials to be allowed")
+			}
+		})
+	}
+}
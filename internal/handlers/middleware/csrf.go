@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/handlers/problems"
+)
+
+// Cookies set for browser clients in cookie mode, see config.Config.CookieMode
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	// CSRFTokenCookie is readable by JS, the client must send its value back in CSRFTokenHeader
+	CSRFTokenCookie = "csrf_token"
+	CSRFTokenHeader = "X-CSRF-Token"
+)
+
+// CheckCSRF makes sure a request authenticated with cookies was sent by the client itself: the CSRF token header
+// must match the CSRF cookie, which other sites can't read (double-submit cookie). Safe methods don't change anything
+// and always pass. If the check fails, the request is aborted with 403.
+func CheckCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := c.Cookie(CSRFTokenCookie)
+	header := c.GetHeader(CSRFTokenHeader)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		problems.Abort(c, api.NewProblem(http.StatusForbidden, api.CodeCSRFTokenMismatch,
+			"Requests authenticated with cookies must send the CSRF token in the "+CSRFTokenHeader+" header"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/logging"
+)
+
+// RequestIDHeader carries the correlation ID of a request
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// RequestID takes the correlation ID from the X-Request-ID header or generates a new one, returns it in the response
+// header and stores it in the request context, so it's added to every log line of the request.
+//
+// IDs that are too long or contain anything but printable ASCII are replaced with a generated one.
+func RequestID(c *gin.Context) {
+	requestID := c.GetHeader(RequestIDHeader)
+	if !IsValidRequestID(requestID) {
+		requestID = uuid.NewString()
+	}
+
+	c.Header(RequestIDHeader, requestID)
+	c.Set("request_id", requestID)
+	c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+
+	c.Next()
+}
+
+// RequestLogger logs every request after it's handled. Only the route pattern is logged, so the path parameters
+// and the query string can't leak anything into the logs.
+func RequestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.Log(c.Request.Context(), level, "Request handled",
+			logging.KeyEvent, "http_request",
+			"method", c.Request.Method,
+			"route", route,
+			"status", c.Writer.Status(),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
+
+// IsValidRequestID checks that the correlation ID is short and only consists of printable ASCII
+func IsValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -1,12 +1,15 @@
 package middleware
 
 import (
-	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/handlers/problems"
 	"github.com/kwinso/medods-test-task/internal/services"
-	"log"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 )
 
@@ -17,49 +20,137 @@ type Middleware interface {
 // AuthMiddleware parses a bearer JWT token from the request and checks if there's a valid session present for the ID.
 // If it fails to do so, it aborts the connection with 401 error.
 //
+// If cookieMode is enabled, browser clients can send the access token in the AccessTokenCookie instead.
+// State-changing requests authenticated this way must pass CheckCSRF. Otherwise the cookie is ignored.
+//
 // If the token is parsed successfully, it will set following context values:
 //   - `user_guid` - GUID of the authorized user
 //   - `auth_id` - id of the auth session
+//   - `auth_amr` - authentication methods the session was created with
+//   - `auth_acr` - assurance level of the session (see tokens.ACRSingleFactor and tokens.ACRMultiFactor)
+//   - `auth_roles` - roles of the user at the time the token was issued
+//   - `auth_scopes` - scopes granted by the roles
 type AuthMiddleware struct {
 	authService services.AuthService
-	logger      *log.Logger
+	logger      *slog.Logger
+	stateless   bool
+	cookieMode  bool
 }
 
 // NewAuthMiddleware creates new AuthMiddleware
-func NewAuthMiddleware(authService services.AuthService, logger *log.Logger) *AuthMiddleware {
+func NewAuthMiddleware(authService services.AuthService, logger *slog.Logger, cookieMode bool) *AuthMiddleware {
 	return &AuthMiddleware{
 		authService: authService,
 		logger:      logger,
+		cookieMode:  cookieMode,
+	}
+}
+
+// NewStatelessAuthMiddleware creates an AuthMiddleware that trusts the access token until it expires
+// instead of looking up the session on every request. Revoked sessions are still rejected.
+func NewStatelessAuthMiddleware(authService services.AuthService, logger *slog.Logger, cookieMode bool) *AuthMiddleware {
+	return &AuthMiddleware{
+		authService: authService,
+		logger:      logger,
+		stateless:   true,
+		cookieMode:  cookieMode,
 	}
 }
 
 func (m *AuthMiddleware) Handle(c *gin.Context) {
-	bearerToken := c.GetHeader("Authorization")
-	if bearerToken == "" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, api.UnauthorizedResponse)
+	token, fromCookie, ok := m.accessToken(c)
+	if !ok {
+		problems.Abort(c, api.NewProblem(http.StatusUnauthorized, api.CodeMissingAccessToken,
+			"The request must have a bearer token in the Authorization header or the access token cookie"))
+		return
+	}
+	if fromCookie && !CheckCSRF(c) {
 		return
 	}
 
-	parts := strings.SplitN(bearerToken, " ", 2)
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, api.UnauthorizedResponse)
+	validate := m.authService.ValidateAccessToken
+	if m.stateless {
+		validate = m.authService.ValidateAccessTokenStateless
 	}
 
-	token := parts[1]
-	auth, err := m.authService.GetAuthByAccessToken(c.Request.Context(), token)
+	claims, err := validate(c.Request.Context(), token)
 	if err != nil {
-		if errors.Is(err, services.ErrAuthExpired) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, api.UnauthorizedResponse)
+		problems.AbortWithError(c, m.logger, err, "Failed to authorize user")
+		return
+	}
+
+	c.Set("user_guid", claims.Guid)
+	c.Set("auth_id", claims.AuthId)
+	c.Set("auth_amr", claims.AMR)
+	c.Set("auth_acr", claims.ACR)
+	c.Set("auth_roles", claims.Roles)
+	c.Set("auth_scopes", claims.Scopes())
+
+	c.Next()
+}
+
+// accessToken reads the bearer token from the Authorization header. Without the header, the access token cookie is used
+// in cookie mode
+func (m *AuthMiddleware) accessToken(c *gin.Context) (token string, fromCookie bool, ok bool) {
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		if !m.cookieMode {
+			return "", false, false
+		}
+		cookie, err := c.Cookie(AccessTokenCookie)
+		return cookie, true, err == nil && cookie != ""
+	}
+
+	parts := strings.SplitN(header, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", false, false
+	}
+	return parts[1], false, true
+}
+
+// acrLevels orders the assurance levels, so a higher level satisfies the lower one
+var acrLevels = map[string]int{
+	tokens.ACRSingleFactor: 1,
+	tokens.ACRMultiFactor:  2,
+}
+
+// RequireACR makes sure the session was created with at least the given assurance level.
+// It must be used after AuthMiddleware. If the level is too low, the request is rejected with 401 and
+// the `insufficient_user_authentication` error (RFC 9470), so the client knows it has to log in again with MFA.
+func RequireACR(acr string) gin.HandlerFunc {
+	required := acrLevels[acr]
+	return func(c *gin.Context) {
+		if acrLevels[c.GetString("auth_acr")] < required {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", acr_values=%q`, acr))
+			problems.Abort(c, api.NewProblem(http.StatusUnauthorized, api.CodeMFARequired, "The route requires a session created with MFA"))
 			return
 		}
 
-		m.logger.Printf("Failed to authorize user: %v\n", err)
-		c.AbortWithStatusJSON(http.StatusInternalServerError, api.InternalServerErrorResponse)
-		return
+		c.Next()
 	}
+}
 
-	c.Set("user_guid", auth.Guid)
-	c.Set("auth_id", auth.ID)
+// RequireScopes makes sure the access token has all the given scopes.
+// It must be used after AuthMiddleware. If any scope is missing, the request is rejected with 403.
+func RequireScopes(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted := c.GetStringSlice("auth_scopes")
 
-	c.Next()
+		var missing []string
+		for _, scope := range scopes {
+			if !slices.Contains(granted, scope) {
+				missing = append(missing, scope)
+			}
+		}
+
+		if len(missing) > 0 {
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+			problem := api.NewProblem(http.StatusForbidden, api.CodeInsufficientScope, "The access token lacks the scopes required by the route")
+			problem.MissingScopes = missing
+			problems.Abort(c, problem)
+			return
+		}
+
+		c.Next()
+	}
 }
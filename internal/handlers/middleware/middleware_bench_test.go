@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/services"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+// dbLatency roughly matches a GetAuthById round trip to a local Postgres
+const dbLatency = 200 * time.Microsecond
+
+// slowAuthRepository serves a single session with a simulated database round trip
+type slowAuthRepository struct {
+	auth db.Auth
+}
+
+func (r *slowAuthRepository) CreateAuth(_ context.Context, _ db.CreateAuthParams) (db.Auth, error) {
+	return r.auth, nil
+}
+
+func (r *slowAuthRepository) GetAuthById(_ context.Context, _ uuid.UUID) (db.Auth, error) {
+	time.Sleep(dbLatency)
+	return r.auth, nil
+}
+
+func (r *slowAuthRepository) DeleteAuthById(_ context.Context, _ uuid.UUID) error {
+	return nil
+}
+
+func (r *slowAuthRepository) UpdateAuthRefreshToken(_ context.Context, _ uuid.UUID, _, _ string, _ time.Time) error {
+	return nil
+}
+
+func (r *slowAuthRepository) ListAuthsByGuid(_ context.Context, _ string) ([]db.Auth, error) {
+	return []db.Auth{r.auth}, nil
+}
+
+func (r *slowAuthRepository) DeleteAuthsByGuid(_ context.Context, _ string) ([]uuid.UUID, error) {
+	return []uuid.UUID{r.auth.ID}, nil
+}
+
+func (r *slowAuthRepository) CountAuthsRefreshedSince(_ context.Context, _ time.Time) (int64, error) {
+	return 1, nil
+}
+
+func BenchmarkAuthMiddleware(b *testing.B) {
+	gin.SetMode(gin.ReleaseMode)
+	logger := logging.Discard()
+
+	settings := config.NewStore(&config.Config{
+		JwtKey:              "benchmark-key",
+		TokenTTL:            time.Hour,
+		AuthTTL:             time.Hour,
+		JwtIssuer:           "medods-auth",
+		JwtAudience:         []string{"medods"},
+		JwtAllowedAudiences: []string{"medods"},
+		JwtLeeway:           30 * time.Second,
+	})
+	jwtConfig := services.NewJWTConfig(*settings.Get())
+
+	auth := db.Auth{
+		ID:          uuid.New(),
+		Guid:        uuid.NewString(),
+		RefreshedAt: time.Now(),
+		Amr:         []string{tokens.AMRExternal},
+		Acr:         tokens.ACRSingleFactor,
+	}
+	token, err := tokens.GenerateAccessToken(tokens.AccessTokenParams{
+		Guid:   auth.Guid,
+		AuthId: auth.ID,
+		AMR:    auth.Amr,
+		ACR:    auth.Acr,
+	}, jwtConfig, tokens.NewSystemClock(), tokens.NewSystemEntropy())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	repos := map[string]repositories.AuthRepository{
+		"uncached": &slowAuthRepository{auth: auth},
+		"cached": repositories.NewCachedAuthRepository(&slowAuthRepository{auth: auth}, nil, repositories.AuthCacheConfig{
+			Size: 1000,
+			TTL:  time.Minute,
+		}, tokens.NewSystemClock(), logger),
+	}
+
+	for _, name := range []string{"uncached", "cached"} {
+		authService := services.NewAuthService(repos[name], nil, nil, nil, logger, settings, tokens.NewSystemClock(), tokens.NewSystemEntropy())
+
+		router := gin.New()
+		router.GET("/me", NewAuthMiddleware(authService, logger, false).Handle, func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					req := httptest.NewRequest(http.MethodGet, "/me", nil)
+					req.Header.Set("Authorization", "Bearer "+token)
+					w := httptest.NewRecorder()
+
+					router.ServeHTTP(w, req)
+					if w.Code != http.StatusNoContent {
+						b.Fatalf("unexpected status %d", w.Code)
+					}
+				}
+			})
+		})
+	}
+}
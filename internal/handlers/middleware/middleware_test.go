@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+)
+
+func TestRequireScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cases := map[string]struct {
+		granted         []string
+		required        []string
+		expectedStatus  int
+		expectedMissing []string
+	}{
+		"nothing required": {
+			expectedStatus: http.StatusOK,
+		},
+		"all granted": {
+			granted:        []string{"auth:admin", "reports:read"},
+			required:       []string{"reports:read"},
+			expectedStatus: http.StatusOK,
+		},
+		"one missing": {
+			granted:         []string{"reports:read"},
+			required:        []string{"reports:read", "reports:write"},
+			expectedStatus:  http.StatusForbidden,
+			expectedMissing: []string{"reports:write"},
+		},
+		"nothing granted": {
+			required:        []string{"auth:admin", "reports:read"},
+			expectedStatus:  http.StatusForbidden,
+			expectedMissing: []string{"auth:admin", "reports:read"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				c.Set("auth_scopes", tc.granted)
+			}, RequireScopes(tc.required...), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tc.expectedStatus, w.Code)
+			}
+			if tc.expectedStatus == http.StatusOK {
+				return
+			}
+
+			var problem api.Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Code != api.CodeInsufficientScope {
+				t.Errorf("expected code %q, got %q", api.CodeInsufficientScope, problem.Code)
+			}
+			if !slices.Equal(problem.MissingScopes, tc.expectedMissing) {
+				t.Errorf("expected missing scopes %v, got %v", tc.expectedMissing, problem.MissingScopes)
+			}
+			if w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected the WWW-Authenticate header")
+			}
+		})
+	}
+}
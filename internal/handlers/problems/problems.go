@@ -0,0 +1,124 @@
+// Package problems responds with RFC 7807 problem details. Service errors are mapped to stable error codes here,
+// so every route reports the same failure the same way.
+package problems
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/services"
+)
+
+type mapping struct {
+	err    error
+	status int
+	code   string
+	detail string
+}
+
+// mappings are checked in order with errors.Is
+var mappings = []mapping{
+	{services.ErrAuthExpired, http.StatusUnauthorized, api.CodeSessionExpired, "The session is expired or was logged out"},
+	{services.ErrUserAgentMismatch, http.StatusUnauthorized, api.CodeSessionRevokedUAMismatch,
+		"The session was revoked, because it was refreshed from a different user agent"},
+	{services.ErrInvalidTokenFormat, http.StatusUnauthorized, api.CodeInvalidRefreshToken, "The refresh token is malformed"},
+	{services.ErrInvalidRefreshToken, http.StatusUnauthorized, api.CodeInvalidRefreshToken, "The refresh token doesn't match the session"},
+	{services.ErrInvalidAccessToken, http.StatusUnauthorized, api.CodeInvalidAccessToken, "The access token is invalid"},
+	{services.ErrIdentityNotVerified, http.StatusUnauthorized, api.CodeIdentityNotVerified, "The identity could not be verified"},
+	{services.ErrInvalidCredentials, http.StatusUnauthorized, api.CodeInvalidCredentials, "The username or password is wrong"},
+	{services.ErrLoginLocked, http.StatusTooManyRequests, api.CodeLoginLocked, "Too many passwords were tried, try again later"},
+	{services.ErrCredentialsExist, http.StatusConflict, api.CodeCredentialsExist, "The user or the username already has credentials"},
+	{services.ErrInvalidChallenge, http.StatusUnauthorized, api.CodeInvalidMFAChallenge, "The MFA challenge is invalid or expired"},
+	{services.ErrInvalidMFACode, http.StatusUnauthorized, api.CodeInvalidMFACode, "The MFA code is wrong"},
+	{services.ErrMFALocked, http.StatusTooManyRequests, api.CodeMFALocked, "Too many MFA codes were tried, try again later"},
+	{services.ErrMFANotEnrolled, http.StatusBadRequest, api.CodeMFANotEnrolled, "TOTP isn't enrolled"},
+	{services.ErrMFAAlreadyEnabled, http.StatusConflict, api.CodeMFAAlreadyEnabled, "MFA is already enabled"},
+	{services.ErrRoleNotFound, http.StatusNotFound, api.CodeRoleNotFound, "The role doesn't exist"},
+}
+
+// FromError maps a service error to its problem. Returns false for errors without a mapping
+func FromError(err error) (api.Problem, bool) {
+	for _, m := range mappings {
+		if errors.Is(err, m.err) {
+			return api.NewProblem(m.status, m.code, m.detail), true
+		}
+	}
+	return api.Problem{}, false
+}
+
+// Abort responds with the problem and stops the handler chain
+func Abort(c *gin.Context, problem api.Problem) {
+	problem.Instance = c.Request.URL.Path
+	c.Header("Content-Type", api.ProblemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// AbortWithError responds with the problem the error maps to.
+// Unknown errors are logged with msg and args and answered with 500, so the details don't leak to the client.
+func AbortWithError(c *gin.Context, logger *slog.Logger, err error, msg string, args ...any) {
+	if problem, ok := FromError(err); ok {
+		Abort(c, problem)
+		return
+	}
+
+	logger.ErrorContext(c.Request.Context(), msg, append(args, logging.Err(err))...)
+	AbortInternal(c)
+}
+
+// AbortInternal responds with 500. The error must be logged by the caller
+func AbortInternal(c *gin.Context) {
+	Abort(c, api.NewProblem(http.StatusInternalServerError, api.CodeInternalError, ""))
+}
+
+// AbortWithBindingError responds to a request that failed to bind.
+// Validation errors are listed per field, anything else means the body couldn't be decoded.
+func AbortWithBindingError(c *gin.Context, err error) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		Abort(c, api.NewProblem(http.StatusBadRequest, api.CodeMalformedRequest, "The request body is malformed"))
+		return
+	}
+
+	fields := make([]api.FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		fields = append(fields, api.FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: fieldMessage(fe),
+		})
+	}
+	AbortWithInvalidFields(c, fields...)
+}
+
+// AbortWithInvalidFields responds with `validation_failed` listing the fields, e.g. for invalid route params
+func AbortWithInvalidFields(c *gin.Context, fields ...api.FieldError) {
+	problem := api.NewProblem(http.StatusBadRequest, api.CodeValidationFailed, "The request has invalid fields")
+	problem.Errors = fields
+	Abort(c, problem)
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_without":
+		return "is required"
+	case "min":
+		return "must be at least " + fe.Param() + " long"
+	case "max":
+		return "must be at most " + fe.Param() + " long"
+	case "len":
+		return "must be exactly " + fe.Param() + " long"
+	case "numeric":
+		return "must be numeric"
+	case "guid":
+		return "must be a GUID"
+	case "scope":
+		return "must be a valid scope"
+	default:
+		return "is invalid"
+	}
+}
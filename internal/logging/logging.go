@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Common attribute keys, so the same thing is called the same way in every log line
+const (
+	KeyEvent     = "event"
+	KeyGUID      = "guid"
+	KeyAuthID    = "auth_id"
+	KeyRequestID = "request_id"
+	KeyTraceID   = "trace_id"
+	KeyError     = "error"
+)
+
+type requestIDKey struct{}
+
+// New creates a JSON logger. Every record goes through the redaction layer (see NewRedactingHandler)
+// and gets the request ID and trace ID of the context it's logged with.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(NewRedactingHandler(&contextHandler{
+		root: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}),
+	}))
+}
+
+// Discard returns a logger that drops everything
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// WithRequestID stores the request ID in the context, so it's added to everything logged with it
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID stored by WithRequestID
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Err is a shorthand for the error attribute
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+// contextHandler adds the request ID and trace ID from the context to the top level of the record,
+// even if the logger has groups.
+type contextHandler struct {
+	root slog.Handler
+	// ops are WithAttrs and WithGroup calls, replayed on top of the context attributes
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.root.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	var attrs []slog.Attr
+	if id := RequestID(ctx); id != "" {
+		attrs = append(attrs, slog.String(KeyRequestID, id))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		attrs = append(attrs, slog.String(KeyTraceID, spanContext.TraceID().String()))
+	}
+
+	handler := h.root
+	if len(attrs) > 0 {
+		handler = handler.WithAttrs(attrs)
+	}
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+	return handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *contextHandler) with(op func(slog.Handler) slog.Handler) *contextHandler {
+	return &contextHandler{
+		root: h.root,
+		ops:  append(slices.Clip(h.ops), op),
+	}
+}
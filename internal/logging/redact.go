@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces sensitive values in logs
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values never reach the logs. Besides secrets, this includes
+// personal data like IP addresses and user agents.
+var sensitiveKeys = map[string]bool{
+	"token":         true,
+	"password":      true,
+	"secret":        true,
+	"assertion":     true,
+	"authorization": true,
+	"cookie":        true,
+	"pepper":        true,
+	"code":          true,
+	"recovery_code": true,
+	"ip":            true,
+	"ip_address":    true,
+	"user_agent":    true,
+}
+
+var sensitiveSuffixes = []string{"_token", "_password", "_secret", "_key"}
+
+// sensitivePatterns catch secrets that end up inside messages and errors
+var sensitivePatterns = []*regexp.Regexp{
+	// JWT access and MFA tokens
+	regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	// refresh tokens, raw and base64 encoded as they're given to clients
+	regexp.MustCompile(`rt\.[0-9a-fA-F-]{36}\.[0-9a-fA-F]+`),
+	regexp.MustCompile(`cnQu[A-Za-z0-9+/]+={0,2}`),
+	// bearer credentials in headers
+	regexp.MustCompile(`(?i)bearer\s+\S+`),
+	// TOTP provisioning URIs, they contain the secret
+	regexp.MustCompile(`otpauth://\S+`),
+	// hashes stored in the database
+	regexp.MustCompile(`\$(argon2id|hmac-sha256|2[aby])\$\S+`),
+}
+
+// RedactingHandler removes secrets and personal data from records before passing them to the next handler.
+//
+// Values of sensitive keys (tokens, passwords, IPs, user agents, ...) are replaced with Redacted,
+// and known secret formats are masked in the message and every string or error value.
+type RedactingHandler struct {
+	next slog.Handler
+}
+
+func NewRedactingHandler(next slog.Handler) *RedactingHandler {
+	return &RedactingHandler{next: next}
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, RedactString(r.Message), r.PC)
+	r.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		redacted = append(redacted, redactAttr(attr))
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name)}
+}
+
+// RedactString masks known secret formats in the string
+func RedactString(s string) string {
+	for _, pattern := range sensitivePatterns {
+		s = pattern.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(strings.ReplaceAll(key, "-", "_"))
+	if sensitiveKeys[key] {
+		return true
+	}
+	for _, suffix := range sensitiveSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactAttr(attr slog.Attr) slog.Attr {
+	if isSensitiveKey(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, RedactString(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, 0, len(group))
+		for _, member := range group {
+			redacted = append(redacted, redactAttr(member))
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			return slog.String(attr.Key, RedactString(v.Error()))
+		case []string:
+			redacted := make([]string, 0, len(v))
+			for _, s := range v {
+				redacted = append(redacted, RedactString(s))
+			}
+			return slog.Any(attr.Key, redacted)
+		default:
+			// anything else could be marshaled with secrets inside, so only its string form is logged
+			return slog.String(attr.Key, RedactString(value.String()))
+		}
+	default:
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+}
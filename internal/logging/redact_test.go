@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+func TestLoggerNeverWritesSecrets(t *testing.T) {
+	jwtConfig := tokens.JWTConfig{
+		Key:              "test-key",
+		TTL:              time.Minute,
+		Issuer:           "medods-auth",
+		Audience:         []string{"medods"},
+		AllowedAudiences: []string{"medods"},
+	}
+	accessToken, err := tokens.GenerateAccessToken(tokens.AccessTokenParams{
+		Guid:   uuid.NewString(),
+		AuthId: uuid.New(),
+	}, jwtConfig, tokens.NewSystemClock(), tokens.NewSystemEntropy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := tokens.GenerateRefreshToken(uuid.New(), tokens.NewSystemEntropy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedRefreshToken := tokens.EncodeRefreshTokenToBase64(refreshToken)
+	refreshTokenHash := tokens.HashRefreshToken(refreshToken, []byte("pepper"))
+
+	const (
+		password  = "correct horse battery staple"
+		userAgent = "Mozilla/5.0 (X11; Linux x86_64) Secret/1.0"
+		totpURI   = "otpauth://totp/MEDODS:user?secret=JBSWY3DPEHPK3PXP&issuer=MEDODS"
+	)
+	ip := netip.MustParseAddr("203.0.113.7")
+
+	secrets := []string{
+		accessToken,
+		refreshToken,
+		encodedRefreshToken,
+		refreshTokenHash,
+		password,
+		userAgent,
+		ip.String(),
+		"JBSWY3DPEHPK3PXP",
+	}
+
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelDebug)
+	ctx := WithRequestID(context.Background(), "test-request")
+
+	// secrets under sensitive keys
+	logger.InfoContext(ctx, "login",
+		"access_token", accessToken,
+		"refresh_token", encodedRefreshToken,
+		"password", password,
+		"user_agent", userAgent,
+		"ip", ip,
+		"refresh_token_hash", refreshTokenHash,
+	)
+	// secrets inside messages, errors and values of other keys
+	logger.ErrorContext(ctx, "refresh failed for "+refreshToken,
+		Err(fmt.Errorf("invalid token %q: %w", accessToken, errors.New("expired"))),
+		"header", "Bearer "+accessToken,
+		"uri", totpURI,
+		"stored", refreshTokenHash,
+		"tokens", []string{accessToken, encodedRefreshToken},
+	)
+	// secrets in groups and attributes bound to the logger
+	logger.With("authorization", "Bearer "+accessToken).WithGroup("request").InfoContext(ctx, "nested",
+		slog.Group("body", "password", password, "note", encodedRefreshToken),
+		slog.Any("payload", map[string]string{"refresh_token": refreshToken}),
+	)
+
+	output := buf.String()
+	for _, secret := range secrets {
+		if strings.Contains(output, secret) {
+			t.Errorf("log output contains a secret %q:\n%s", secret, output)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 log lines, got %d:\n%s", len(lines), output)
+	}
+	for _, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line is not JSON: %v\n%s", err, line)
+		}
+		if record[KeyRequestID] != "test-request" {
+			t.Errorf("expected request ID in %s", line)
+		}
+	}
+}
+
+func TestRedactingHandlerKeepsRegularFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	guid := uuid.NewString()
+	authId := uuid.New()
+	logger.Info("session created", KeyEvent, "login", KeyGUID, guid, KeyAuthID, authId, "status", 200)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"msg":     "session created",
+		KeyEvent:  "login",
+		KeyGUID:   guid,
+		KeyAuthID: authId.String(),
+		"status":  float64(200),
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, record[key])
+		}
+	}
+}
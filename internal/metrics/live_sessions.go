@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const liveSessionsTimeout = 2 * time.Second
+
+// liveSessionsCollector counts live sessions on every scrape, so the gauge is the same on all instances
+type liveSessionsCollector struct {
+	desc  *prometheus.Desc
+	count func(ctx context.Context) (int64, error)
+}
+
+// RegisterLiveSessions registers a gauge of live sessions, counted with the given function on every scrape
+func (m *Metrics) RegisterLiveSessions(count func(ctx context.Context) (int64, error)) {
+	m.Registry.MustRegister(&liveSessionsCollector{
+		desc:  prometheus.NewDesc(namespace+"_live_sessions", "Sessions that can still be refreshed.", nil, nil),
+		count: count,
+	})
+}
+
+func (c *liveSessionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *liveSessionsCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), liveSessionsTimeout)
+	defer cancel()
+
+	count, err := c.count(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count))
+}
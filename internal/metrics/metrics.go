@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "medods_auth"
+
+// Refresh failure reasons used as the `reason` label of RefreshFailures
+const (
+	RefreshFailureExpired           = "expired"
+	RefreshFailureUserAgentMismatch = "user_agent_mismatch"
+	RefreshFailureInvalidFormat     = "invalid_format"
+	RefreshFailureInvalidToken      = "invalid_token"
+	RefreshFailureError             = "error"
+)
+
+// Webhook delivery outcomes used as the `outcome` label of WebhookDeliveries
+const (
+	WebhookDelivered = "delivered"
+	WebhookRejected  = "rejected"
+	WebhookFailed    = "failed"
+)
+
+// Metrics holds the Prometheus collectors of the app. Every instance has its own registry,
+// so it's safe to create several of them (e.g. in tests).
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	Logins            *prometheus.CounterVec
+	Refreshes         prometheus.Counter
+	RefreshFailures   *prometheus.CounterVec
+	Logouts           prometheus.Counter
+	WebhookDeliveries *prometheus.CounterVec
+
+	HTTPRequestDuration *prometheus.HistogramVec
+	GRPCCallDuration    *prometheus.HistogramVec
+	DBQueryDuration     *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+
+		Logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Sessions created, by authentication methods.",
+		}, []string{"amr"}),
+		Refreshes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refreshes_total",
+			Help:      "Successful token refreshes.",
+		}),
+		RefreshFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refresh_failures_total",
+			Help:      "Failed token refreshes, by reason.",
+		}, []string{"reason"}),
+		Logouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logouts_total",
+			Help:      "Deleted sessions.",
+		}),
+		WebhookDeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_deliveries_total",
+			Help:      "Webhook report deliveries, by outcome.",
+		}, []string{"outcome"}),
+
+		HTTPRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests, by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		GRPCCallDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_call_duration_seconds",
+			Help:      "Duration of gRPC calls, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+		DBQueryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Duration of database queries, by query name.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"query", "status"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.Logins,
+		m.Refreshes,
+		m.RefreshFailures,
+		m.Logouts,
+		m.WebhookDeliveries,
+		m.HTTPRequestDuration,
+		m.GRPCCallDuration,
+		m.DBQueryDuration,
+	)
+
+	return m
+}
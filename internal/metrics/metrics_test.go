@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherFamily gathers the metric family with the name from the registry of m, nil if it has no metrics
+func gatherFamily(t *testing.T, m *Metrics, name string) *dto.MetricFamily {
+	t.Helper()
+	families, err := m.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return family
+		}
+	}
+	return nil
+}
+
+func TestQueryTracerLabelsQueries(t *testing.T) {
+	m := New()
+	tracer := NewQueryTracer(m)
+
+	queries := []struct {
+		sql string
+		err error
+	}{
+		{"-- name: GetAuthById :one\nSELECT * FROM auths WHERE id = $1", nil},
+		{"-- name: GetAuthById :one\nSELECT * FROM auths WHERE id = $1", pgx.ErrNoRows},
+		{"-- name: DeleteAuthById :exec\nDELETE FROM auths WHERE id = $1", errors.New("connection reset")},
+		{"SELECT 1", nil},
+	}
+	for _, q := range queries {
+		ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: q.sql})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: q.err})
+	}
+	// a query that wasn't started isn't observed
+	tracer.TraceQueryEnd(context.Background(), nil, pgx.TraceQueryEndData{})
+
+	family := gatherFamily(t, m, "medods_auth_db_query_duration_seconds")
+	if family == nil {
+		t.Fatal("expected the query durations to be gathered")
+	}
+	expected := map[[2]string]uint64{
+		{"GetAuthById", "ok"}:       2,
+		{"DeleteAuthById", "error"}: 1,
+		{"other", "ok"}:             1,
+	}
+	if len(family.GetMetric()) != len(expected) {
+		t.Errorf("expected %d label sets, got %d", len(expected), len(family.GetMetric()))
+	}
+	for _, metric := range family.GetMetric() {
+		labels := make(map[string]string)
+		for _, label := range metric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		key := [2]string{labels["query"], labels["status"]}
+		if count := metric.GetHistogram().GetSampleCount(); count != expected[key] {
+			t.Errorf("expected %d observations of %v, got %d", expected[key], key, count)
+		}
+	}
+}
+
+func TestLiveSessionsGauge(t *testing.T) {
+	m := New()
+	var count int64 = 3
+	var countErr error
+	m.RegisterLiveSessions(func(context.Context) (int64, error) {
+		return count, countErr
+	})
+
+	family := gatherFamily(t, m, "medods_auth_live_sessions")
+	if family == nil || family.GetType() != dto.MetricType_GAUGE || len(family.GetMetric()) != 1 {
+		t.Fatalf("expected a single live sessions gauge, got %v", family)
+	}
+	if value := family.GetMetric()[0].GetGauge().GetValue(); value != 3 {
+		t.Errorf("expected 3 live sessions, got %v", value)
+	}
+
+	// the gauge is counted on every scrape
+	count = 5
+	if value := gatherFamily(t, m, "medods_auth_live_sessions").GetMetric()[0].GetGauge().GetValue(); value != 5 {
+		t.Errorf("expected 5 live sessions, got %v", value)
+	}
+
+	countErr = errors.New("database is down")
+	if _, err := m.Registry.Gather(); err == nil {
+		t.Error("expected the count error to fail the scrape")
+	}
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	name  string
+	start time.Time
+}
+
+// QueryTracer is a pgx.QueryTracer that observes DBQueryDuration.
+// Queries are labeled by their sqlc name (`-- name: GetAuthById :one`), other queries are labeled as `other`.
+type QueryTracer struct {
+	metrics *Metrics
+}
+
+func NewQueryTracer(m *Metrics) *QueryTracer {
+	return &QueryTracer{metrics: m}
+}
+
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{
+		name:  queryName(data.SQL),
+		start: time.Now(),
+	})
+}
+
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+
+	status := "ok"
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		status = "error"
+	}
+	t.metrics.DBQueryDuration.WithLabelValues(start.name, status).Observe(time.Since(start.start).Seconds())
+}
+
+func queryName(sql string) string {
+	rest, ok := strings.CutPrefix(sql, "-- name: ")
+	if !ok {
+		return "other"
+	}
+
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
@@ -0,0 +1,148 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var (
+	ErrInvalidHash         = errors.New("invalid password hash format")
+	ErrIncompatibleVersion = errors.New("incompatible argon2 version")
+	ErrInvalidParams       = errors.New("argon2 parameters out of range")
+)
+
+// The bounds of Params. The maximums keep a single verification from exhausting the server,
+// e.g. with a tampered stored hash
+const (
+	MaxMemory     = 1024 * 1024
+	MaxIterations = 32
+	minSaltLength = 8
+	minKeyLength  = 16
+	maxLength     = 64
+)
+
+// Params are the tunable Argon2id parameters
+type Params struct {
+	// Memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultParams follow the OWASP recommendations for Argon2id
+var DefaultParams = Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Validate checks that the parameters are within the bounds argon2.IDKey can work with in reasonable time and memory.
+// Returns ErrInvalidParams otherwise
+func (p Params) Validate() error {
+	switch {
+	case p.Iterations < 1 || p.Iterations > MaxIterations,
+		p.Parallelism < 1,
+		p.Memory < 8*uint32(p.Parallelism) || p.Memory > MaxMemory,
+		p.SaltLength < minSaltLength || p.SaltLength > maxLength,
+		p.KeyLength < minKeyLength || p.KeyLength > maxLength:
+		return fmt.Errorf("%w: m=%d,t=%d,p=%d, %d byte salt, %d byte key", ErrInvalidParams,
+			p.Memory, p.Iterations, p.Parallelism, p.SaltLength, p.KeyLength)
+	}
+	return nil
+}
+
+// Hash hashes the password with Argon2id and encodes it in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+//
+// Returns ErrInvalidParams if p is out of bounds.
+func Hash(password string, p Params) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+
+	salt := make([]byte, p.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify checks the password against the encoded hash.
+// needsRehash is true when the hash was made with parameters that differ from the current ones.
+// Hashes with parameters out of bounds aren't computed and return ErrInvalidParams.
+func Verify(password, encoded string, current Params) (match bool, needsRehash bool, err error) {
+	p, salt, key, err := decode(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	otherKey := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+		return false, false, nil
+	}
+
+	needsRehash = p.Memory != current.Memory ||
+		p.Iterations != current.Iterations ||
+		p.Parallelism != current.Parallelism ||
+		p.SaltLength != current.SaltLength ||
+		p.KeyLength != current.KeyLength
+
+	return true, needsRehash, nil
+}
+
+func decode(encoded string) (p Params, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return p, nil, nil, ErrIncompatibleVersion
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, ErrInvalidHash
+	}
+	p.KeyLength = uint32(len(key))
+
+	if err := p.Validate(); err != nil {
+		return p, nil, nil, err
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,158 @@
+package passwords
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testParams are cheap, so the tests run fast
+var testParams = Params{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestHashAndVerify(t *testing.T) {
+	hash, err := Hash("correct horse battery staple", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("expected the PHC format with the params, got %s", hash)
+	}
+
+	other, err := Hash("correct horse battery staple", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == other {
+		t.Error("expected a random salt for every hash")
+	}
+
+	cases := map[string]struct {
+		password string
+		match    bool
+	}{
+		"same password":  {"correct horse battery staple", true},
+		"wrong password": {"correct horse battery stapler", false},
+		"empty password": {"", false},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			match, needsRehash, err := Verify(tc.password, hash, testParams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if match != tc.match {
+				t.Errorf("expected match %t, got %t", tc.match, match)
+			}
+			if needsRehash {
+				t.Error("expected no rehash with the same params")
+			}
+		})
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	hash, err := Hash("password", testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		modify   func(p *Params)
+		expected bool
+	}{
+		"same params":       {func(*Params) {}, false},
+		"other memory":      {func(p *Params) { p.Memory = 128 }, true},
+		"other iterations":  {func(p *Params) { p.Iterations = 2 }, true},
+		"other parallelism": {func(p *Params) { p.Parallelism = 2 }, true},
+		"other salt length": {func(p *Params) { p.SaltLength = 32 }, true},
+		"other key length":  {func(p *Params) { p.KeyLength = 64 }, true},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			current := testParams
+			tc.modify(&current)
+
+			match, needsRehash, err := Verify("password", hash, current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !match {
+				t.Fatal("expected the password to match with any current params")
+			}
+			if needsRehash != tc.expected {
+				t.Errorf("expected needsRehash %t, got %t", tc.expected, needsRehash)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsEncodings(t *testing.T) {
+	const (
+		salt = "c29tZXNhbHRzb21lc2FsdA"
+		key  = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	)
+
+	cases := map[string]struct {
+		encoded  string
+		expected error
+	}{
+		"empty":               {"", ErrInvalidHash},
+		"missing parts":       {"$argon2id$v=19$m=64,t=1,p=1$" + salt, ErrInvalidHash},
+		"other algorithm":     {"$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key, ErrInvalidHash},
+		"malformed version":   {"$argon2id$19$m=64,t=1,p=1$" + salt + "$" + key, ErrInvalidHash},
+		"other version":       {"$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key, ErrIncompatibleVersion},
+		"malformed params":    {"$argon2id$v=19$t=1,m=64,p=1$" + salt + "$" + key, ErrInvalidHash},
+		"malformed salt":      {"$argon2id$v=19$m=64,t=1,p=1$!!!$" + key, ErrInvalidHash},
+		"malformed key":       {"$argon2id$v=19$m=64,t=1,p=1$" + salt + "$!!!", ErrInvalidHash},
+		"zero iterations":     {"$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key, ErrInvalidParams},
+		"too many iterations": {"$argon2id$v=19$m=64,t=33,p=1$" + salt + "$" + key, ErrInvalidParams},
+		"zero parallelism":    {"$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key, ErrInvalidParams},
+		"too little memory":   {"$argon2id$v=19$m=8,t=1,p=2$" + salt + "$" + key, ErrInvalidParams},
+		"too much memory":     {"$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key, ErrInvalidParams},
+		"short salt":          {"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$" + key, ErrInvalidParams},
+		// an empty key would match any password
+		"empty key": {"$argon2id$v=19$m=64,t=1,p=1$" + salt + "$", ErrInvalidParams},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			match, _, err := Verify("password", tc.encoded, testParams)
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, err)
+			}
+			if match {
+				t.Error("expected no match")
+			}
+		})
+	}
+}
+
+func TestHashRejectsParams(t *testing.T) {
+	cases := map[string]func(p *Params){
+		"zero iterations":     func(p *Params) { p.Iterations = 0 },
+		"too many iterations": func(p *Params) { p.Iterations = MaxIterations + 1 },
+		"zero parallelism":    func(p *Params) { p.Parallelism = 0 },
+		"too little memory":   func(p *Params) { p.Memory = 7 },
+		"too much memory":     func(p *Params) { p.Memory = MaxMemory + 1 },
+		"short salt":          func(p *Params) { p.SaltLength = 4 },
+		"short key":           func(p *Params) { p.KeyLength = 0 },
+	}
+
+	for name, modify := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := testParams
+			modify(&p)
+			if _, err := Hash("password", p); !errors.Is(err, ErrInvalidParams) {
+				t.Errorf("expected %v, got %v", ErrInvalidParams, err)
+			}
+		})
+	}
+}
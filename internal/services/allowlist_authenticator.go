@@ -0,0 +1,45 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strings"
+)
+
+// allowlistAuthenticator only lets in GUIDs listed in a static file
+type allowlistAuthenticator struct {
+	guids map[string]struct{}
+}
+
+// NewAllowlistAuthenticator reads the allowlist from a file.
+// The file contains one GUID per line. Empty lines and lines starting with `#` are ignored.
+func NewAllowlistAuthenticator(path string) (Authenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	guids := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		guids[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &allowlistAuthenticator{guids: guids}, nil
+}
+
+func (a *allowlistAuthenticator) Authenticate(_ context.Context, guid, _ string) error {
+	if _, ok := a.guids[strings.ToLower(guid)]; !ok {
+		return ErrIdentityNotVerified
+	}
+	return nil
+}
@@ -6,13 +6,15 @@ import (
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
-	"log"
+	"log/slog"
 	"net/netip"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/kwinso/medods-test-task/internal/config"
 	"github.com/kwinso/medods-test-task/internal/db"
 	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/logging"
 	"github.com/kwinso/medods-test-task/internal/tokens"
 )
 
@@ -20,6 +22,9 @@ var (
 	ErrAuthExpired        = errors.New("auth expired")
 	ErrUserAgentMismatch  = errors.New("user agent mismatch")
 	ErrInvalidTokenFormat = errors.New("invalid token format")
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	// ErrInvalidRefreshToken is returned when the refresh token doesn't match its session, e.g. it was rotated out already
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
 )
 
 type TokenPair struct {
@@ -28,64 +33,106 @@ type TokenPair struct {
 }
 
 type AuthService interface {
-	AuthorizeByGUID(ctx context.Context, guid, userAgent string, ip netip.Addr) (*TokenPair, error)
-	GetAuthByAccessToken(ctx context.Context, token string) (*db.Auth, error)
+	// AuthorizeByGUID creates a new session for the GUID. The caller must have verified the identity already,
+	// amr lists the authentication methods it was verified with.
+	AuthorizeByGUID(ctx context.Context, guid string, amr []string, userAgent string, ip netip.Addr) (*TokenPair, error)
+	// ValidateAccessToken checks the access token and that its session is still alive.
+	//
+	// Returns:
+	// 	- ErrAuthExpired if the token or its session is expired or deleted
+	// 	- ErrInvalidAccessToken if the token is malformed, has a wrong signature or fails the claims validation
+	ValidateAccessToken(ctx context.Context, token string) (*tokens.TokenClaims, error)
+	// ValidateAccessTokenStateless trusts the access token until it expires, without looking up the session.
+	// Only the revocation list is checked, so it doesn't need a database round trip.
+	//
+	// Returns the same errors as ValidateAccessToken.
+	ValidateAccessTokenStateless(ctx context.Context, token string) (*tokens.TokenClaims, error)
 	// RefreshAuth refreshes the access token for the user.
 	//
 	// Returns:
-	// 	- ErrAuthExpired if the refresh token is expired
+	// 	- ErrAuthExpired if the session is expired or deleted
+	// 	- ErrInvalidTokenFormat if the refresh token is malformed
+	// 	- ErrInvalidRefreshToken if the refresh token doesn't match the session
 	// 	- ErrUserAgentMismatch if the user agent does not match. Mismatched user agent causes auth to be dropped
 	RefreshAuth(ctx context.Context, refreshToken, userAgent string, ip netip.Addr) (*TokenPair, error)
+	// DeleteAuthById deletes the session and revokes its access tokens
 	DeleteAuthById(ctx context.Context, authId uuid.UUID) error
+	ListSessions(ctx context.Context, guid string) ([]db.Auth, error)
+	// RevokeSessions deletes all sessions of the GUID and revokes their access tokens. Returns the number of deleted sessions,
+	// also together with the error if their access tokens couldn't be revoked
+	RevokeSessions(ctx context.Context, guid string) (int, error)
+	// CountLiveSessions counts the sessions that can still be refreshed
+	CountLiveSessions(ctx context.Context) (int64, error)
 }
 
 type authService struct {
 	repo          repositories.AuthRepository
-	key           string
-	tokenTTL      time.Duration
-	authTTL       time.Duration
-	logger        *log.Logger
+	rolesService  RolesService
+	revocations   RevocationService
+	settings      *config.Store
+	logger        *slog.Logger
 	reportService ReportService
+	clock         tokens.Clock
+	entropy       tokens.Entropy
+}
+
+// NewJWTConfig builds the access token settings from the app config
+func NewJWTConfig(cfg config.Config) tokens.JWTConfig {
+	return tokens.JWTConfig{
+		Key:              cfg.JwtKey,
+		KeyID:            cfg.JwtKeyID,
+		PreviousKeys:     cfg.JwtPreviousKeys,
+		TTL:              cfg.TokenTTL,
+		Issuer:           cfg.JwtIssuer,
+		Audience:         cfg.JwtAudience,
+		AllowedAudiences: cfg.JwtAllowedAudiences,
+		Leeway:           cfg.JwtLeeway,
+	}
 }
 
-func NewAuthService(repo repositories.AuthRepository, reportService ReportService, logger *log.Logger, key string, tokenTTL, authTTL time.Duration) AuthService {
+// NewAuthService creates an AuthService. Token and session TTLs are read from settings on every use, so they can be reloaded.
+// Sessions and tokens expire by the time of clock, session IDs and tokens are generated from entropy
+func NewAuthService(repo repositories.AuthRepository, rolesService RolesService, revocations RevocationService, reportService ReportService, logger *slog.Logger, settings *config.Store, clock tokens.Clock, entropy tokens.Entropy) AuthService {
 	return &authService{
 		repo:          repo,
-		key:           key,
-		tokenTTL:      tokenTTL,
-		authTTL:       authTTL,
+		rolesService:  rolesService,
+		revocations:   revocations,
+		settings:      settings,
 		logger:        logger,
 		reportService: reportService,
+		clock:         clock,
+		entropy:       entropy,
 	}
 }
 
-func (s *authService) AuthorizeByGUID(ctx context.Context, guid, userAgent string, ip netip.Addr) (*TokenPair, error) {
-	recordId := uuid.New()
-	refreshToken, err := tokens.GenerateRefreshToken(recordId)
+func (s *authService) AuthorizeByGUID(ctx context.Context, guid string, amr []string, userAgent string, ip netip.Addr) (*TokenPair, error) {
+	recordId, err := tokens.NewID(s.entropy)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(refreshToken)
-
-	refreshTokenHash, err := tokens.HashRefreshToken(refreshToken)
+	refreshToken, err := tokens.GenerateRefreshToken(recordId, s.entropy)
 	if err != nil {
 		return nil, err
 	}
 
+	refreshTokenHash := tokens.HashRefreshToken(refreshToken, s.refreshPepper())
+
 	auth, err := s.repo.CreateAuth(ctx, db.CreateAuthParams{
 		ID:               recordId,
 		Guid:             guid,
 		RefreshTokenHash: refreshTokenHash,
 		IpAddress:        ip,
 		UserAgent:        userAgent,
-		RefreshedAt:      time.Now(),
+		RefreshedAt:      s.clock.Now(),
+		Amr:              amr,
+		Acr:              tokens.ACRForAMR(amr),
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	accessToken, err := tokens.GenerateAccessToken(auth.Guid, auth.ID, s.key, s.tokenTTL)
+	accessToken, err := s.generateAccessToken(ctx, auth)
 	if err != nil {
 		return nil, err
 	}
@@ -96,12 +143,9 @@ func (s *authService) AuthorizeByGUID(ctx context.Context, guid, userAgent strin
 	}, nil
 }
 
-func (s *authService) GetAuthByAccessToken(ctx context.Context, token string) (*db.Auth, error) {
-	claims, err := tokens.ParseAccessToken(token, s.key)
+func (s *authService) ValidateAccessToken(ctx context.Context, token string) (*tokens.TokenClaims, error) {
+	claims, err := s.parseAccessToken(token)
 	if err != nil {
-		if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, ErrAuthExpired
-		}
 		return nil, err
 	}
 
@@ -114,11 +158,11 @@ func (s *authService) GetAuthByAccessToken(ctx context.Context, token string) (*
 	}
 
 	// If refreshed way to long ago, this auth is no longer valid
-	if time.Now().After(auth.RefreshedAt.Add(s.authTTL)) {
+	if s.clock.Now().After(auth.RefreshedAt.Add(s.authTTL())) {
 		return nil, ErrAuthExpired
 	}
 
-	return &auth, nil
+	return claims, nil
 }
 
 func (s *authService) RefreshAuth(ctx context.Context, refreshToken, userAgent string, ip netip.Addr) (*TokenPair, error) {
@@ -138,44 +182,49 @@ func (s *authService) RefreshAuth(ctx context.Context, refreshToken, userAgent s
 		return nil, err
 	}
 
-	valid := tokens.VerifyRefreshToken(refreshToken, auth.RefreshTokenHash)
+	valid := tokens.VerifyRefreshToken(refreshToken, auth.RefreshTokenHash, s.refreshPepper())
 	if !valid {
-		return nil, ErrAuthExpired
+		return nil, ErrInvalidRefreshToken
 	}
 
-	if time.Now().After(auth.RefreshedAt.Add(s.authTTL)) {
+	if s.clock.Now().After(auth.RefreshedAt.Add(s.authTTL())) {
 		return nil, ErrAuthExpired
 	}
 
 	if auth.UserAgent != userAgent {
-		s.logger.Printf("User agent mismatch (was %q, got %q) for user %v. Dropping authorization", auth.UserAgent, userAgent, auth.Guid)
+		s.logger.WarnContext(ctx, "User agent mismatch, dropping authorization",
+			logging.KeyEvent, "user_agent_mismatch", logging.KeyGUID, auth.Guid, logging.KeyAuthID, auth.ID)
 		_ = s.DeleteAuthById(ctx, auth.ID)
 		return nil, ErrUserAgentMismatch
 	}
 
 	if auth.IpAddress.Compare(ip) != 0 {
-		s.logger.Printf("Auth for %v IP changed from %q to %q. Sending report to webhook.", auth.Guid, auth.IpAddress, ip)
-		err := s.reportService.SendIPChangeReport(auth, ip)
+		s.logger.InfoContext(ctx, "IP changed, sending report to webhook",
+			logging.KeyEvent, "ip_change", logging.KeyGUID, auth.Guid, logging.KeyAuthID, auth.ID)
+		err := s.reportService.SendIPChangeReport(ctx, auth, ip)
 		if err != nil {
-			s.logger.Printf("Failed to deliver webhook change report for %v: %v", auth.Guid, err)
+			s.logger.ErrorContext(ctx, "Failed to deliver webhook change report",
+				logging.KeyEvent, "ip_change", logging.KeyGUID, auth.Guid, logging.KeyAuthID, auth.ID, logging.Err(err))
 		}
 	}
 
-	newRefreshToken, err := tokens.GenerateRefreshToken(auth.ID)
-	if err != nil {
-		return nil, err
-	}
-	refreshTokenHash, err := tokens.HashRefreshToken(newRefreshToken)
+	newRefreshToken, err := tokens.GenerateRefreshToken(auth.ID, s.entropy)
 	if err != nil {
 		return nil, err
 	}
+	// the new token is always hashed with HMAC, which also upgrades legacy bcrypt hashes
+	refreshTokenHash := tokens.HashRefreshToken(newRefreshToken, s.refreshPepper())
 
-	err = s.repo.UpdateAuthRefreshToken(ctx, auth.ID, refreshTokenHash)
+	// the session may have been read from a stale cache, only the refresh that replaces the current hash wins
+	err = s.repo.UpdateAuthRefreshToken(ctx, auth.ID, auth.RefreshTokenHash, refreshTokenHash, s.clock.Now())
 	if err != nil {
+		if errors.Is(err, repositories.ErrAuthChanged) {
+			return nil, ErrInvalidRefreshToken
+		}
 		return nil, err
 	}
 
-	accessToken, err := tokens.GenerateAccessToken(auth.Guid, auth.ID, s.key, s.tokenTTL)
+	accessToken, err := s.generateAccessToken(ctx, auth)
 	if err != nil {
 		return nil, err
 	}
@@ -186,6 +235,87 @@ func (s *authService) RefreshAuth(ctx context.Context, refreshToken, userAgent s
 	}, nil
 }
 
+func (s *authService) ValidateAccessTokenStateless(_ context.Context, token string) (*tokens.TokenClaims, error) {
+	claims, err := s.parseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.revocations.IsRevoked(claims.AuthId) {
+		return nil, ErrAuthExpired
+	}
+
+	return claims, nil
+}
+
 func (s *authService) DeleteAuthById(ctx context.Context, authId uuid.UUID) error {
-	return s.repo.DeleteAuthById(ctx, authId)
+	err := s.repo.DeleteAuthById(ctx, authId)
+	if err != nil {
+		return err
+	}
+
+	return s.revocations.Revoke(ctx, authId)
+}
+
+func (s *authService) ListSessions(ctx context.Context, guid string) ([]db.Auth, error) {
+	return s.repo.ListAuthsByGuid(ctx, guid)
+}
+
+func (s *authService) RevokeSessions(ctx context.Context, guid string) (int, error) {
+	ids, err := s.repo.DeleteAuthsByGuid(ctx, guid)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		err = s.revocations.Revoke(ctx, id)
+		if err != nil {
+			return len(ids), err
+		}
+	}
+	return len(ids), nil
+}
+
+func (s *authService) CountLiveSessions(ctx context.Context) (int64, error) {
+	return s.repo.CountAuthsRefreshedSince(ctx, s.clock.Now().Add(-s.authTTL()))
+}
+
+func (s *authService) parseAccessToken(token string) (*tokens.TokenClaims, error) {
+	claims, err := tokens.ParseAccessToken(token, s.jwtConfig(), s.clock)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrAuthExpired
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAccessToken, err)
+	}
+	return claims, nil
+}
+
+// generateAccessToken generates an access token for the session with the current roles and scopes of the user
+func (s *authService) generateAccessToken(ctx context.Context, auth db.Auth) (string, error) {
+	grants, err := s.rolesService.GetGrants(ctx, auth.Guid)
+	if err != nil {
+		return "", err
+	}
+
+	return tokens.GenerateAccessToken(tokens.AccessTokenParams{
+		Guid:   auth.Guid,
+		AuthId: auth.ID,
+		AMR:    auth.Amr,
+		ACR:    auth.Acr,
+		Roles:  grants.Roles,
+		Scopes: grants.Scopes,
+	}, s.jwtConfig(), s.clock, s.entropy)
+}
+
+func (s *authService) jwtConfig() tokens.JWTConfig {
+	return NewJWTConfig(*s.settings.Get())
+}
+
+func (s *authService) refreshPepper() []byte {
+	return []byte(s.settings.Get().RefreshTokenPepper)
+}
+
+func (s *authService) authTTL() time.Duration {
+	return s.settings.Get().AuthTTL
 }
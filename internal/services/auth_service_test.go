@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+const (
+	testGuid      = "12345678-1234-1234-1234-123456789012"
+	testUserAgent = "test/1.0"
+	testTokenTTL  = 5 * time.Minute
+	testAuthTTL   = time.Hour
+)
+
+var (
+	testIP    = netip.MustParseAddr("192.0.2.1")
+	testStart = time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+)
+
+// fakeClock only moves when advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// sequenceEntropy returns 0, 1, 2, ... so every run generates the same tokens and IDs
+type sequenceEntropy struct {
+	mu   sync.Mutex
+	next byte
+}
+
+func (e *sequenceEntropy) Read(p []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range p {
+		p[i] = e.next
+		e.next++
+	}
+	return len(p), nil
+}
+
+// noGrantsRolesService gives every user no roles
+type noGrantsRolesService struct {
+	RolesService
+}
+
+func (noGrantsRolesService) GetGrants(context.Context, string) (*Grants, error) {
+	return &Grants{}, nil
+}
+
+// memoryRevocations revokes sessions forever. If err is set, revocations fail with it
+type memoryRevocations struct {
+	mu      sync.Mutex
+	revoked map[uuid.UUID]bool
+	err     error
+}
+
+func (r *memoryRevocations) Revoke(_ context.Context, authId uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.revoked[authId] = true
+	return nil
+}
+
+func (r *memoryRevocations) IsRevoked(authId uuid.UUID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.revoked[authId]
+}
+
+func (r *memoryRevocations) Run(context.Context) {}
+
+// recordingReports keeps the reports instead of sending them
+type recordingReports struct {
+	mu    sync.Mutex
+	newIP []netip.Addr
+}
+
+func (r *recordingReports) SendIPChangeReport(_ context.Context, _ db.Auth, newIP netip.Addr) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.newIP = append(r.newIP, newIP)
+	return nil
+}
+
+type testAuthService struct {
+	AuthService
+	repo        repositories.AuthRepository
+	clock       *fakeClock
+	reports     *recordingReports
+	revocations *memoryRevocations
+}
+
+func newTestAuthService(entropy tokens.Entropy) *testAuthService {
+	clock := &fakeClock{now: testStart}
+	return newTestAuthServiceWithRepo(repositories.NewMemoryAuthRepository(clock), clock, entropy)
+}
+
+// newTestAuthServiceWithRepo creates a service on top of repo. The repo must take the time from clock
+func newTestAuthServiceWithRepo(repo repositories.AuthRepository, clock *fakeClock, entropy tokens.Entropy) *testAuthService {
+	reports := &recordingReports{}
+	settings := config.NewStore(&config.Config{
+		JwtKey:             "test-key",
+		JwtIssuer:          "medods-auth",
+		JwtAudience:        []string{"medods"},
+		RefreshTokenPepper: "test-pepper",
+		TokenTTL:           testTokenTTL,
+		AuthTTL:            testAuthTTL,
+	})
+
+	revocations := &memoryRevocations{revoked: make(map[uuid.UUID]bool)}
+	service := NewAuthService(repo, noGrantsRolesService{}, revocations, reports, logging.Discard(), settings, clock, entropy)
+	return &testAuthService{AuthService: service, repo: repo, clock: clock, reports: reports, revocations: revocations}
+}
+
+func (s *testAuthService) login(t *testing.T) *TokenPair {
+	t.Helper()
+	pair, err := s.AuthorizeByGUID(context.Background(), testGuid, []string{tokens.AMRExternal}, testUserAgent, testIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+func (s *testAuthService) refresh(t *testing.T, pair *TokenPair) *TokenPair {
+	t.Helper()
+	refreshed, err := s.RefreshAuth(context.Background(), pair.RefreshToken, testUserAgent, testIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return refreshed
+}
+
+func TestAuthServiceIsDeterministic(t *testing.T) {
+	first := newTestAuthService(&sequenceEntropy{}).login(t)
+	second := newTestAuthService(&sequenceEntropy{}).login(t)
+
+	if *first != *second {
+		t.Errorf("expected the same tokens for the same clock and entropy, got %+v and %+v", first, second)
+	}
+
+	expectedId, err := tokens.NewID(&sequenceEntropy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authId, err := tokens.ParseEncodedRefreshToken(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *authId != expectedId {
+		t.Errorf("expected session ID %s from entropy, got %s", expectedId, authId)
+	}
+}
+
+func TestSessionExpiryBoundary(t *testing.T) {
+	for name, c := range map[string]struct {
+		after    time.Duration
+		expected error
+	}{
+		"at the TTL":    {testAuthTTL, nil},
+		"after the TTL": {testAuthTTL + time.Nanosecond, ErrAuthExpired},
+	} {
+		t.Run(name, func(t *testing.T) {
+			service := newTestAuthService(tokens.NewSystemEntropy())
+			pair := service.login(t)
+
+			service.clock.Advance(c.after)
+			_, err := service.RefreshAuth(context.Background(), pair.RefreshToken, testUserAgent, testIP)
+			if !errors.Is(err, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+}
+
+func TestRefreshExtendsSession(t *testing.T) {
+	service := newTestAuthService(tokens.NewSystemEntropy())
+	pair := service.login(t)
+
+	// refreshing just before the session expires keeps it alive for another AuthTTL
+	for range 3 {
+		service.clock.Advance(testAuthTTL - time.Second)
+		pair = service.refresh(t, pair)
+	}
+
+	authId, err := tokens.ParseEncodedRefreshToken(pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := service.repo.GetAuthById(context.Background(), *authId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !auth.RefreshedAt.Equal(service.clock.Now()) {
+		t.Errorf("expected the session to be refreshed at %v, got %v", service.clock.Now(), auth.RefreshedAt)
+	}
+
+	service.clock.Advance(testAuthTTL + time.Second)
+	if _, err := service.RefreshAuth(context.Background(), pair.RefreshToken, testUserAgent, testIP); !errors.Is(err, ErrAuthExpired) {
+		t.Errorf("expected the session to expire without refreshes, got %v", err)
+	}
+}
+
+func TestAccessTokenLifetimeIsAbsolute(t *testing.T) {
+	service := newTestAuthService(tokens.NewSystemEntropy())
+	ctx := context.Background()
+	pair := service.login(t)
+
+	service.clock.Advance(testTokenTTL - time.Second)
+	refreshed := service.refresh(t, pair)
+	if _, err := service.ValidateAccessToken(ctx, pair.AccessToken); err != nil {
+		t.Errorf("expected the old access token to be valid until it expires, got %v", err)
+	}
+
+	// refreshing issues a new access token, but doesn't extend the old one
+	service.clock.Advance(2 * time.Second)
+	if _, err := service.ValidateAccessToken(ctx, pair.AccessToken); !errors.Is(err, ErrAuthExpired) {
+		t.Errorf("expected the old access token to expire, got %v", err)
+	}
+	if _, err := service.ValidateAccessTokenStateless(ctx, pair.AccessToken); !errors.Is(err, ErrAuthExpired) {
+		t.Errorf("expected the old access token to expire without the session lookup, got %v", err)
+	}
+	if _, err := service.ValidateAccessToken(ctx, refreshed.AccessToken); err != nil {
+		t.Errorf("expected the new access token to be valid, got %v", err)
+	}
+}
+
+func TestRefreshRotation(t *testing.T) {
+	service := newTestAuthService(&sequenceEntropy{})
+	ctx := context.Background()
+	pair := service.login(t)
+
+	refreshed := service.refresh(t, pair)
+	if refreshed.RefreshToken == pair.RefreshToken {
+		t.Fatal("expected the refresh token to be rotated")
+	}
+
+	if _, err := service.RefreshAuth(ctx, pair.RefreshToken, testUserAgent, testIP); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected the rotated out token to be rejected, got %v", err)
+	}
+	refreshed = service.refresh(t, refreshed)
+
+	if _, err := service.RefreshAuth(ctx, refreshed.RefreshToken, "other/1.0", testIP); !errors.Is(err, ErrUserAgentMismatch) {
+		t.Errorf("expected a user agent mismatch, got %v", err)
+	}
+	if _, err := service.RefreshAuth(ctx, refreshed.RefreshToken, testUserAgent, testIP); !errors.Is(err, ErrAuthExpired) {
+		t.Errorf("expected the session to be dropped after the mismatch, got %v", err)
+	}
+	if _, err := service.ValidateAccessTokenStateless(ctx, refreshed.AccessToken); !errors.Is(err, ErrAuthExpired) {
+		t.Errorf("expected the access token to be revoked after the mismatch, got %v", err)
+	}
+}
+
+// Instances cache the sessions they read. A token rotated out by one instance must not verify against the stale
+// session cached by another one.
+func TestRefreshTokenReuseWithStaleCache(t *testing.T) {
+	clock := &fakeClock{now: testStart}
+	shared := repositories.NewMemoryAuthRepository(clock)
+	cacheConfig := repositories.AuthCacheConfig{Size: 10, TTL: time.Minute}
+	first := newTestAuthServiceWithRepo(repositories.NewCachedAuthRepository(shared, nil, cacheConfig, clock, logging.Discard()),
+		clock, tokens.NewSystemEntropy())
+	second := newTestAuthServiceWithRepo(repositories.NewCachedAuthRepository(shared, nil, cacheConfig, clock, logging.Discard()),
+		clock, tokens.NewSystemEntropy())
+	ctx := context.Background()
+
+	pair := first.login(t)
+	// the second instance caches the session with the current refresh token hash
+	if _, err := second.ValidateAccessToken(ctx, pair.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+
+	first.refresh(t, pair)
+	if _, err := second.RefreshAuth(ctx, pair.RefreshToken, testUserAgent, testIP); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expected the rotated out token to be rejected, got %v", err)
+	}
+}
+
+func TestRefreshReportsIPChange(t *testing.T) {
+	service := newTestAuthService(tokens.NewSystemEntropy())
+	pair := service.login(t)
+
+	pair = service.refresh(t, pair)
+	newIP := netip.MustParseAddr("198.51.100.7")
+	if _, err := service.RefreshAuth(context.Background(), pair.RefreshToken, testUserAgent, newIP); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(service.reports.newIP) != 1 || service.reports.newIP[0] != newIP {
+		t.Errorf("expected a single report for %v, got %v", newIP, service.reports.newIP)
+	}
+}
+
+func TestCountLiveSessionsBoundary(t *testing.T) {
+	service := newTestAuthService(tokens.NewSystemEntropy())
+	ctx := context.Background()
+	service.login(t)
+
+	service.clock.Advance(time.Minute)
+	service.login(t)
+
+	service.clock.Advance(testAuthTTL - time.Minute - time.Nanosecond)
+	count, err := service.CountLiveSessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected both sessions to be live, got %d", count)
+	}
+
+	service.clock.Advance(time.Nanosecond)
+	count, err = service.CountLiveSessions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected the first session to expire, got %d live", count)
+	}
+}
+
+func TestRevokeSessionsCountsDeletedOnError(t *testing.T) {
+	s := newTestAuthService(tokens.NewSystemEntropy())
+	ctx := context.Background()
+	s.login(t)
+	s.login(t)
+
+	revokeErr := errors.New("revocations are unavailable")
+	s.revocations.err = revokeErr
+	count, err := s.RevokeSessions(ctx, testGuid)
+	if !errors.Is(err, revokeErr) {
+		t.Fatalf("expected %v, got %v", revokeErr, err)
+	}
+	if count != 2 {
+		t.Errorf("expected the 2 deleted sessions to be counted, got %d", count)
+	}
+
+	sessions, err := s.ListSessions(ctx, testGuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("expected the sessions to be deleted, got %d", len(sessions))
+	}
+}
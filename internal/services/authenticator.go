@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/kwinso/medods-test-task/internal/config"
+)
+
+var (
+	ErrIdentityNotVerified = errors.New("identity not verified")
+)
+
+// Authenticator verifies that the caller really is the owner of the GUID before a session is issued for it.
+type Authenticator interface {
+	// Authenticate checks the GUID against the upstream identity source.
+	// The assertion is an opaque proof supplied by the client and may be empty for authenticators that don't need it.
+	//
+	// Returns ErrIdentityNotVerified if the identity can't be confirmed.
+	Authenticate(ctx context.Context, guid, assertion string) error
+}
+
+// NewAuthenticator creates the Authenticator selected by the config
+func NewAuthenticator(cfg config.Config) (Authenticator, error) {
+	switch cfg.Authenticator {
+	case config.AuthenticatorNone:
+		return noopAuthenticator{}, nil
+	case config.AuthenticatorAllowlist:
+		return NewAllowlistAuthenticator(cfg.AllowlistFile)
+	case config.AuthenticatorRegistry:
+		key, err := os.ReadFile(cfg.RegistryPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewRegistryAuthenticator(key, cfg.RegistryIssuer, cfg.RegistryAudience)
+	case config.AuthenticatorHTTP:
+		return NewHTTPAuthenticator(cfg.UserServiceURL), nil
+	default:
+		return nil, fmt.Errorf("unknown authenticator %q", cfg.Authenticator)
+	}
+}
+
+// noopAuthenticator trusts every GUID. It keeps the behaviour of the original test task.
+type noopAuthenticator struct{}
+
+func (noopAuthenticator) Authenticate(_ context.Context, _, _ string) error {
+	return nil
+}
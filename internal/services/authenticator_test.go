@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kwinso/medods-test-task/internal/config"
+)
+
+const otherGuid = "87654321-4321-4321-4321-210987654321"
+
+func writeTestFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func generateRegistryKey(t *testing.T) (ed25519.PrivateKey, []byte) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func signAssertion(t *testing.T, key ed25519.PrivateKey, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assertion
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	_, publicKey := generateRegistryKey(t)
+	cases := map[string]struct {
+		cfg  config.Config
+		want Authenticator
+	}{
+		"none": {
+			cfg:  config.Config{Authenticator: config.AuthenticatorNone},
+			want: noopAuthenticator{},
+		},
+		"allowlist": {
+			cfg: config.Config{
+				Authenticator: config.AuthenticatorAllowlist,
+				AllowlistFile: writeTestFile(t, "allowlist", []byte(testGuid)),
+			},
+			want: &allowlistAuthenticator{},
+		},
+		"registry": {
+			cfg: config.Config{
+				Authenticator:         config.AuthenticatorRegistry,
+				RegistryPublicKeyFile: writeTestFile(t, "registry.pem", publicKey),
+				RegistryIssuer:        "registry",
+				RegistryAudience:      "medods-auth",
+			},
+			want: &registryAuthenticator{},
+		},
+		"http": {
+			cfg: config.Config{
+				Authenticator:  config.AuthenticatorHTTP,
+				UserServiceURL: url.URL{Scheme: "http", Host: "localhost", Path: "/verify"},
+			},
+			want: &httpAuthenticator{},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			authenticator, err := NewAuthenticator(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.TypeOf(authenticator) != reflect.TypeOf(tc.want) {
+				t.Errorf("expected %T, got %T", tc.want, authenticator)
+			}
+		})
+	}
+
+	if _, err := NewAuthenticator(config.Config{Authenticator: "ldap"}); err == nil {
+		t.Error("expected an unknown authenticator to be rejected")
+	}
+	if _, err := NewRegistryAuthenticator(publicKey, "", "medods-auth"); err == nil {
+		t.Error("expected the registry authenticator without an issuer to be rejected")
+	}
+	if _, err := NewRegistryAuthenticator(publicKey, "registry", ""); err == nil {
+		t.Error("expected the registry authenticator without an audience to be rejected")
+	}
+}
+
+func TestAuthenticatorsRejectUnverifiedIdentity(t *testing.T) {
+	registryKey, publicKey := generateRegistryKey(t)
+	otherKey, _ := generateRegistryKey(t)
+	registry, err := NewRegistryAuthenticator(publicKey, "registry", "medods-auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	validClaims := jwt.RegisteredClaims{
+		Subject:   testGuid,
+		Issuer:    "registry",
+		Audience:  jwt.ClaimStrings{"medods-auth"},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+	withClaims := func(change func(claims *jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		claims := validClaims
+		change(&claims)
+		return claims
+	}
+
+	allowlist, err := NewAllowlistAuthenticator(writeTestFile(t, "allowlist", []byte("# staff\n"+testGuid+"\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("status") {
+		case "forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		case "missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(userService.Close)
+	httpAuthenticator := func(status string) Authenticator {
+		endpoint, err := url.Parse(userService.URL + "?status=" + status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewHTTPAuthenticator(*endpoint)
+	}
+
+	cases := map[string]struct {
+		authenticator Authenticator
+		guid          string
+		assertion     string
+		want          error
+		wantOther     bool
+	}{
+		"allowlisted guid": {authenticator: allowlist, guid: testGuid},
+		"not allowlisted guid": {
+			authenticator: allowlist,
+			guid:          otherGuid,
+			want:          ErrIdentityNotVerified,
+		},
+		"valid assertion": {
+			authenticator: registry,
+			guid:          testGuid,
+			assertion:     signAssertion(t, registryKey, validClaims),
+		},
+		"missing assertion": {
+			authenticator: registry,
+			guid:          testGuid,
+			want:          ErrIdentityNotVerified,
+		},
+		"assertion for another guid": {
+			authenticator: registry,
+			guid:          otherGuid,
+			assertion:     signAssertion(t, registryKey, validClaims),
+			want:          ErrIdentityNotVerified,
+		},
+		"assertion signed by another key": {
+			authenticator: registry,
+			guid:          testGuid,
+			assertion:     signAssertion(t, otherKey, validClaims),
+			want:          ErrIdentityNotVerified,
+		},
+		"expired assertion": {
+			authenticator: registry,
+			guid:          testGuid,
+			assertion: signAssertion(t, registryKey, withClaims(func(claims *jwt.RegisteredClaims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			})),
+			want: ErrIdentityNotVerified,
+		},
+		"assertion from another issuer": {
+			authenticator: registry,
+			guid:          testGuid,
+			assertion: signAssertion(t, registryKey, withClaims(func(claims *jwt.RegisteredClaims) {
+				claims.Issuer = "someone"
+			})),
+			want: ErrIdentityNotVerified,
+		},
+		"assertion without issuer": {
+			authenticator: registry,
+			guid:          testGuid,
+			assertion: signAssertion(t, registryKey, withClaims(func(claims *jwt.RegisteredClaims) {
+				claims.Issuer = ""
+			})),
+			want: ErrIdentityNotVerified,
+		},
+		"assertion without audience": {
+			authenticator: registry,
+			guid:          testGuid,
+			assertion: signAssertion(t, registryKey, withClaims(func(claims *jwt.RegisteredClaims) {
+				claims.Audience = nil
+			})),
+			want: ErrIdentityNotVerified,
+		},
+		"assertion for another audience": {
+			authenticator: registry,
+			guid:          testGuid,
+			assertion: signAssertion(t, registryKey, withClaims(func(claims *jwt.RegisteredClaims) {
+				claims.Audience = jwt.ClaimStrings{"billing"}
+			})),
+			want: ErrIdentityNotVerified,
+		},
+		"confirmed by user service": {authenticator: httpAuthenticator("ok"), guid: testGuid},
+		"forbidden by user service": {
+			authenticator: httpAuthenticator("forbidden"),
+			guid:          testGuid,
+			want:          ErrIdentityNotVerified,
+		},
+		"unknown to user service": {
+			authenticator: httpAuthenticator("missing"),
+			guid:          testGuid,
+			want:          ErrIdentityNotVerified,
+		},
+		"user service failure": {
+			authenticator: httpAuthenticator("broken"),
+			guid:          testGuid,
+			wantOther:     true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.authenticator.Authenticate(context.Background(), tc.guid, tc.assertion)
+			switch {
+			case tc.wantOther:
+				if err == nil || errors.Is(err, ErrIdentityNotVerified) {
+					t.Errorf("expected an error other than %v, got %v", ErrIdentityNotVerified, err)
+				}
+			case tc.want == nil:
+				if err != nil {
+					t.Errorf("expected the identity to be verified, got %v", err)
+				}
+			case !errors.Is(err, tc.want):
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/passwords"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrCredentialsExist   = errors.New("credentials already exist")
+	ErrLoginLocked        = errors.New("login locked")
+)
+
+const (
+	// loginMaxAttemptsPerUsername and loginMaxAttemptsPerIP are how many passwords can be tried in a row for a username
+	// or from an IP before it's locked for loginLockout. Every attempt after the lock is over locks it again until
+	// a password is accepted.
+	loginMaxAttemptsPerUsername = 10
+	loginMaxAttemptsPerIP       = 50
+	loginLockout                = 15 * time.Minute
+)
+
+type CredentialsService interface {
+	// Register links a username and password to the GUID.
+	//
+	// Returns ErrCredentialsExist if the GUID already has credentials or the username is taken.
+	Register(ctx context.Context, guid, username, password string) error
+	// ChangePassword replaces the password for the GUID after checking the old one.
+	//
+	// Returns ErrInvalidCredentials if the old password doesn't match.
+	ChangePassword(ctx context.Context, guid, oldPassword, newPassword string) error
+	// Verify checks the username and password sent from the IP and returns the GUID they belong to.
+	// If the stored hash was made with outdated Argon2id parameters, it's transparently rehashed.
+	//
+	// Returns:
+	// 	- ErrInvalidCredentials if the username is unknown or the password doesn't match
+	// 	- ErrLoginLocked if too many passwords were tried for the username or from the IP
+	Verify(ctx context.Context, username, password string, ip netip.Addr) (string, error)
+}
+
+type credentialsService struct {
+	repo     repositories.CredentialsRepository
+	attempts repositories.LoginAttemptsRepository
+	params   passwords.Params
+	clock    tokens.Clock
+	logger   *slog.Logger
+
+	// dummyHash is verified against when the username is unknown, so the response time doesn't leak
+	// which usernames exist
+	dummyHash     string
+	dummyHashOnce sync.Once
+}
+
+// NewCredentialsService creates a CredentialsService. Failed logins are counted in attempts, locks expire by the time of clock
+func NewCredentialsService(repo repositories.CredentialsRepository, attempts repositories.LoginAttemptsRepository, params passwords.Params, clock tokens.Clock, logger *slog.Logger) CredentialsService {
+	return &credentialsService{
+		repo:     repo,
+		attempts: attempts,
+		params:   params,
+		clock:    clock,
+		logger:   logger,
+	}
+}
+
+func (s *credentialsService) Register(ctx context.Context, guid, username, password string) error {
+	hash, err := passwords.Hash(password, s.params)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.CreateCredentials(ctx, guid, username, hash)
+	if err != nil {
+		if errors.Is(err, repositories.ErrAlreadyExists) {
+			return ErrCredentialsExist
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *credentialsService) ChangePassword(ctx context.Context, guid, oldPassword, newPassword string) error {
+	credentials, err := s.repo.GetCredentialsByGuid(ctx, guid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	match, _, err := passwords.Verify(oldPassword, credentials.PasswordHash, s.params)
+	if err != nil {
+		return err
+	}
+	if !match {
+		return ErrInvalidCredentials
+	}
+
+	hash, err := passwords.Hash(newPassword, s.params)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.UpdatePasswordHash(ctx, guid, hash)
+}
+
+func (s *credentialsService) Verify(ctx context.Context, username, password string, ip netip.Addr) (string, error) {
+	// the attempts are counted before the password is checked, so parallel requests can't try more passwords
+	subjects := []string{"ip:" + ip.String(), "username:" + username}
+	err := s.startAttempt(ctx, subjects[0], loginMaxAttemptsPerIP)
+	if err != nil {
+		return "", err
+	}
+	err = s.startAttempt(ctx, subjects[1], loginMaxAttemptsPerUsername)
+	if err != nil {
+		return "", err
+	}
+
+	credentials, err := s.repo.GetCredentialsByUsername(ctx, username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			_, _, _ = passwords.Verify(password, s.getDummyHash(), s.params)
+			return "", ErrInvalidCredentials
+		}
+		return "", err
+	}
+
+	match, needsRehash, err := passwords.Verify(password, credentials.PasswordHash, s.params)
+	if err != nil {
+		return "", err
+	}
+	if !match {
+		return "", ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		hash, err := passwords.Hash(password, s.params)
+		if err == nil {
+			err = s.repo.UpdatePasswordHash(ctx, credentials.Guid, hash)
+		}
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to rehash password", logging.KeyGUID, credentials.Guid, logging.Err(err))
+		}
+	}
+
+	for _, subject := range subjects {
+		err = s.attempts.ResetAttempts(ctx, subject)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return credentials.Guid, nil
+}
+
+// startAttempt counts the login attempt of the subject. Returns ErrLoginLocked if the subject is locked
+func (s *credentialsService) startAttempt(ctx context.Context, subject string, maxAttempts int32) error {
+	now := s.clock.Now()
+	started, err := s.attempts.StartAttempt(ctx, subject, maxAttempts, now, now.Add(loginLockout))
+	if err != nil {
+		return err
+	}
+	if !started {
+		return ErrLoginLocked
+	}
+	return nil
+}
+
+func (s *credentialsService) getDummyHash() string {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = passwords.Hash("dummy password", s.params)
+	})
+	return s.dummyHash
+}
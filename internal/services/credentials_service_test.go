@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/passwords"
+)
+
+const (
+	testUsername = "j.doe"
+	testPassword = "correct horse battery staple"
+)
+
+// testArgon2Params are cheap, so the tests run fast
+var testArgon2Params = passwords.Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// memoryCredentialsRepository keeps the credentials by GUID and counts the password hash updates
+type memoryCredentialsRepository struct {
+	mu          sync.Mutex
+	credentials map[string]db.Credential
+	updates     int
+}
+
+func (r *memoryCredentialsRepository) CreateCredentials(_ context.Context, guid, username, passwordHash string) (db.Credential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credentials := db.Credential{Guid: guid, Username: username, PasswordHash: passwordHash}
+	r.credentials[guid] = credentials
+	return credentials, nil
+}
+
+func (r *memoryCredentialsRepository) GetCredentialsByUsername(_ context.Context, username string) (db.Credential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, credentials := range r.credentials {
+		if credentials.Username == username {
+			return credentials, nil
+		}
+	}
+	return db.Credential{}, sql.ErrNoRows
+}
+
+func (r *memoryCredentialsRepository) GetCredentialsByGuid(_ context.Context, guid string) (db.Credential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credentials, ok := r.credentials[guid]
+	if !ok {
+		return db.Credential{}, sql.ErrNoRows
+	}
+	return credentials, nil
+}
+
+func (r *memoryCredentialsRepository) UpdatePasswordHash(_ context.Context, guid, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	credentials := r.credentials[guid]
+	credentials.PasswordHash = passwordHash
+	r.credentials[guid] = credentials
+	r.updates++
+	return nil
+}
+
+// memoryLoginAttemptsRepository counts the attempts by subject the same way the queries update the table
+type memoryLoginAttemptsRepository struct {
+	mu          sync.Mutex
+	attempts    map[string]int32
+	lockedUntil map[string]time.Time
+}
+
+func newMemoryLoginAttemptsRepository() *memoryLoginAttemptsRepository {
+	return &memoryLoginAttemptsRepository{attempts: make(map[string]int32), lockedUntil: make(map[string]time.Time)}
+}
+
+func (r *memoryLoginAttemptsRepository) StartAttempt(_ context.Context, subject string, maxAttempts int32, now, lockedUntil time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lockedUntil[subject].After(now) {
+		return false, nil
+	}
+	r.attempts[subject]++
+	delete(r.lockedUntil, subject)
+	if r.attempts[subject] >= maxAttempts {
+		r.lockedUntil[subject] = lockedUntil
+	}
+	return true, nil
+}
+
+func (r *memoryLoginAttemptsRepository) ResetAttempts(_ context.Context, subject string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attempts, subject)
+	delete(r.lockedUntil, subject)
+	return nil
+}
+
+func newTestCredentialsService(t *testing.T, repo *memoryCredentialsRepository, params passwords.Params, clock *fakeClock) CredentialsService {
+	t.Helper()
+	return NewCredentialsService(repo, newMemoryLoginAttemptsRepository(), params, clock, logging.Discard())
+}
+
+func TestCredentialsVerifyRehashes(t *testing.T) {
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+
+	cases := map[string]struct {
+		params          passwords.Params
+		username        string
+		password        string
+		expected        error
+		expectedUpdates int
+		// expectedParams is the prefix of the stored hash after the login
+		expectedParams string
+	}{
+		"same params": {
+			params:         testArgon2Params,
+			username:       testUsername,
+			password:       testPassword,
+			expectedParams: "$argon2id$v=19$m=64,t=1,p=1$",
+		},
+		"params changed": {
+			params:          stronger,
+			username:        testUsername,
+			password:        testPassword,
+			expectedUpdates: 1,
+			expectedParams:  "$argon2id$v=19$m=64,t=2,p=1$",
+		},
+		"wrong password": {
+			params:         stronger,
+			username:       testUsername,
+			password:       "wrong password",
+			expected:       ErrInvalidCredentials,
+			expectedParams: "$argon2id$v=19$m=64,t=1,p=1$",
+		},
+		"unknown username": {
+			params:         stronger,
+			username:       "unknown",
+			password:       testPassword,
+			expected:       ErrInvalidCredentials,
+			expectedParams: "$argon2id$v=19$m=64,t=1,p=1$",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := &memoryCredentialsRepository{credentials: make(map[string]db.Credential)}
+			clock := &fakeClock{now: testStart}
+			err := newTestCredentialsService(t, repo, testArgon2Params, clock).Register(ctx, testGuid, testUsername, testPassword)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			service := newTestCredentialsService(t, repo, tc.params, clock)
+			guid, err := service.Verify(ctx, tc.username, tc.password, testIP)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, err)
+			}
+			if tc.expected == nil && guid != testGuid {
+				t.Errorf("expected %s, got %s", testGuid, guid)
+			}
+
+			if repo.updates != tc.expectedUpdates {
+				t.Errorf("expected %d hash updates, got %d", tc.expectedUpdates, repo.updates)
+			}
+			if stored := repo.credentials[testGuid].PasswordHash; !strings.HasPrefix(stored, tc.expectedParams) {
+				t.Errorf("expected the stored hash to start with %s, got %s", tc.expectedParams, stored)
+			}
+
+			// the rehashed password still works and isn't rehashed again
+			if tc.expected == nil {
+				if _, err := service.Verify(ctx, testUsername, testPassword, testIP); err != nil {
+					t.Fatal(err)
+				}
+				if repo.updates != tc.expectedUpdates {
+					t.Errorf("expected no rehash on the next login, got %d updates", repo.updates)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentialsVerifyLimits(t *testing.T) {
+	otherIP := netip.MustParseAddr("192.0.2.2")
+
+	// fail tries the wrong password of the username from the IP the given number of times
+	fail := func(t *testing.T, s CredentialsService, username string, ip netip.Addr, times int) {
+		t.Helper()
+		for range times {
+			if _, err := s.Verify(context.Background(), username, "wrong password", ip); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("expected %v, got %v", ErrInvalidCredentials, err)
+			}
+		}
+	}
+
+	cases := map[string]struct {
+		// run tries passwords before the valid one is sent from ip
+		run      func(t *testing.T, s CredentialsService, clock *fakeClock)
+		ip       netip.Addr
+		expected error
+	}{
+		"valid password": {
+			run: func(t *testing.T, s CredentialsService, _ *fakeClock) {
+				fail(t, s, testUsername, testIP, loginMaxAttemptsPerUsername-1)
+			},
+			ip: testIP,
+		},
+		"username is locked": {
+			run: func(t *testing.T, s CredentialsService, _ *fakeClock) {
+				fail(t, s, testUsername, testIP, loginMaxAttemptsPerUsername)
+			},
+			ip:       otherIP,
+			expected: ErrLoginLocked,
+		},
+		"ip is locked": {
+			run: func(t *testing.T, s CredentialsService, _ *fakeClock) {
+				for i := range loginMaxAttemptsPerIP / loginMaxAttemptsPerUsername {
+					fail(t, s, fmt.Sprintf("user%d", i), testIP, loginMaxAttemptsPerUsername)
+				}
+			},
+			ip:       testIP,
+			expected: ErrLoginLocked,
+		},
+		"unknown usernames are limited": {
+			run: func(t *testing.T, s CredentialsService, _ *fakeClock) {
+				fail(t, s, "unknown", testIP, loginMaxAttemptsPerUsername)
+				if _, err := s.Verify(context.Background(), "unknown", "wrong password", otherIP); !errors.Is(err, ErrLoginLocked) {
+					t.Fatalf("expected %v, got %v", ErrLoginLocked, err)
+				}
+			},
+			ip: testIP,
+		},
+		"lock is over": {
+			run: func(t *testing.T, s CredentialsService, clock *fakeClock) {
+				fail(t, s, testUsername, testIP, loginMaxAttemptsPerUsername)
+				clock.Advance(loginLockout)
+			},
+			ip: testIP,
+		},
+		"wrong password after the lock locks again": {
+			run: func(t *testing.T, s CredentialsService, clock *fakeClock) {
+				fail(t, s, testUsername, testIP, loginMaxAttemptsPerUsername)
+				clock.Advance(loginLockout)
+				fail(t, s, testUsername, testIP, 1)
+			},
+			ip:       testIP,
+			expected: ErrLoginLocked,
+		},
+		"valid password resets the attempts": {
+			run: func(t *testing.T, s CredentialsService, _ *fakeClock) {
+				fail(t, s, testUsername, testIP, loginMaxAttemptsPerUsername-1)
+				if _, err := s.Verify(context.Background(), testUsername, testPassword, testIP); err != nil {
+					t.Fatal(err)
+				}
+				fail(t, s, testUsername, testIP, loginMaxAttemptsPerUsername-1)
+			},
+			ip: testIP,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := &fakeClock{now: testStart}
+			repo := &memoryCredentialsRepository{credentials: make(map[string]db.Credential)}
+			s := newTestCredentialsService(t, repo, testArgon2Params, clock)
+			if err := s.Register(ctx, testGuid, testUsername, testPassword); err != nil {
+				t.Fatal(err)
+			}
+			tc.run(t, s, clock)
+
+			guid, err := s.Verify(ctx, testUsername, testPassword, tc.ip)
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, err)
+			}
+			if tc.expected == nil && guid != testGuid {
+				t.Errorf("expected %s, got %s", testGuid, guid)
+			}
+		})
+	}
+}
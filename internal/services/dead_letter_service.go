@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+)
+
+// DeadLetterService manages webhook reports that couldn't be delivered
+type DeadLetterService interface {
+	// List returns up to limit dead letters, the oldest first
+	List(ctx context.Context, limit int32) ([]db.WebhookDeadLetter, error)
+	// Replay tries to deliver up to limit dead letters once. Delivered ones are deleted, the rest are kept.
+	// Returns the number of delivered and failed reports.
+	Replay(ctx context.Context, limit int32) (int, int, error)
+}
+
+type deadLetterService struct {
+	repo    repositories.DeadLettersRepository
+	webhook *WebhookReportsService
+}
+
+func NewDeadLetterService(repo repositories.DeadLettersRepository, webhook *WebhookReportsService) DeadLetterService {
+	return &deadLetterService{
+		repo:    repo,
+		webhook: webhook,
+	}
+}
+
+func (s *deadLetterService) List(ctx context.Context, limit int32) ([]db.WebhookDeadLetter, error) {
+	return s.repo.ListDeadLetters(ctx, limit)
+}
+
+func (s *deadLetterService) Replay(ctx context.Context, limit int32) (int, int, error) {
+	deadLetters, err := s.repo.ListDeadLetters(ctx, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	delivered, failed := 0, 0
+	for _, deadLetter := range deadLetters {
+		if err := s.webhook.Deliver(ctx, deadLetter.Payload); err != nil {
+			failed++
+			continue
+		}
+
+		if err := s.repo.DeleteDeadLetter(ctx, deadLetter.ID); err != nil {
+			return delivered, failed, err
+		}
+		delivered++
+	}
+	return delivered, failed, nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// httpAuthenticator asks the internal user service whether the GUID may log in.
+//
+// The user service receives a POST request with a JSON body `{"guid": "...", "assertion": "..."}` and is expected
+// to respond with 200 if the identity is confirmed, or with 401, 403 or 404 if it's not.
+// Any other response is treated as an error.
+type httpAuthenticator struct {
+	endpoint url.URL
+	client   *http.Client
+}
+
+type identityVerificationRequest struct {
+	Guid      string `json:"guid"`
+	Assertion string `json:"assertion,omitempty"`
+}
+
+func NewHTTPAuthenticator(endpoint url.URL) Authenticator {
+	return &httpAuthenticator{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}
+}
+
+func (a *httpAuthenticator) Authenticate(ctx context.Context, guid, assertion string) error {
+	content, err := json.Marshal(identityVerificationRequest{
+		Guid:      guid,
+		Assertion: assertion,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint.String(), bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return ErrIdentityNotVerified
+	default:
+		return fmt.Errorf(MismatchedResponseStatusErrFormat, http.StatusOK, resp.Status)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/metrics"
+)
+
+// instrumentedAuthService counts the session events. Access token validation is passed through,
+// it's measured by the HTTP metrics.
+type instrumentedAuthService struct {
+	AuthService
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedAuthService wraps the AuthService to count logins, refreshes and logouts
+func NewInstrumentedAuthService(next AuthService, m *metrics.Metrics) AuthService {
+	return &instrumentedAuthService{
+		AuthService: next,
+		metrics:     m,
+	}
+}
+
+func (s *instrumentedAuthService) AuthorizeByGUID(ctx context.Context, guid string, amr []string, userAgent string, ip netip.Addr) (*TokenPair, error) {
+	pair, err := s.AuthService.AuthorizeByGUID(ctx, guid, amr, userAgent, ip)
+	if err == nil {
+		s.metrics.Logins.WithLabelValues(strings.Join(amr, "+")).Inc()
+	}
+	return pair, err
+}
+
+func (s *instrumentedAuthService) RefreshAuth(ctx context.Context, refreshToken, userAgent string, ip netip.Addr) (*TokenPair, error) {
+	pair, err := s.AuthService.RefreshAuth(ctx, refreshToken, userAgent, ip)
+	switch {
+	case err == nil:
+		s.metrics.Refreshes.Inc()
+	case errors.Is(err, ErrAuthExpired):
+		s.metrics.RefreshFailures.WithLabelValues(metrics.RefreshFailureExpired).Inc()
+	case errors.Is(err, ErrUserAgentMismatch):
+		s.metrics.RefreshFailures.WithLabelValues(metrics.RefreshFailureUserAgentMismatch).Inc()
+	case errors.Is(err, ErrInvalidTokenFormat):
+		s.metrics.RefreshFailures.WithLabelValues(metrics.RefreshFailureInvalidFormat).Inc()
+	case errors.Is(err, ErrInvalidRefreshToken):
+		s.metrics.RefreshFailures.WithLabelValues(metrics.RefreshFailureInvalidToken).Inc()
+	default:
+		s.metrics.RefreshFailures.WithLabelValues(metrics.RefreshFailureError).Inc()
+	}
+	return pair, err
+}
+
+func (s *instrumentedAuthService) DeleteAuthById(ctx context.Context, authId uuid.UUID) error {
+	err := s.AuthService.DeleteAuthById(ctx, authId)
+	if err == nil {
+		s.metrics.Logouts.Inc()
+	}
+	return err
+}
+
+func (s *instrumentedAuthService) RevokeSessions(ctx context.Context, guid string) (int, error) {
+	count, err := s.AuthService.RevokeSessions(ctx, guid)
+	s.metrics.Logouts.Add(float64(count))
+	return count, err
+}
+
+type instrumentedReportService struct {
+	next    ReportService
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedReportService wraps the ReportService to count webhook deliveries by outcome
+func NewInstrumentedReportService(next ReportService, m *metrics.Metrics) ReportService {
+	return &instrumentedReportService{
+		next:    next,
+		metrics: m,
+	}
+}
+
+func (s *instrumentedReportService) SendIPChangeReport(ctx context.Context, auth db.Auth, newIP netip.Addr) error {
+	err := s.next.SendIPChangeReport(ctx, auth, newIP)
+	switch {
+	case err == nil:
+		s.metrics.WebhookDeliveries.WithLabelValues(metrics.WebhookDelivered).Inc()
+	case errors.Is(err, ErrWebhookRejected):
+		s.metrics.WebhookDeliveries.WithLabelValues(metrics.WebhookRejected).Inc()
+	default:
+		s.metrics.WebhookDeliveries.WithLabelValues(metrics.WebhookFailed).Inc()
+	}
+	return err
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/metrics"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatherMetrics gathers the app metrics of the registry by `name{label="value"}`. Histograms are counted by samples
+func gatherMetrics(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gathered := make(map[string]float64)
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "medods_auth_") {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, fmt.Sprintf("%s=%q", label.GetName(), label.GetValue()))
+			}
+			key := family.GetName()
+			if len(labels) > 0 {
+				key += "{" + strings.Join(labels, ",") + "}"
+			}
+
+			switch {
+			case metric.Counter != nil:
+				gathered[key] = metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				gathered[key] = metric.GetGauge().GetValue()
+			case metric.Histogram != nil:
+				gathered[key] = float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	return gathered
+}
+
+func assertMetrics(t *testing.T, registry *prometheus.Registry, expected map[string]float64) {
+	t.Helper()
+	gathered := gatherMetrics(t, registry)
+	for key, value := range expected {
+		if gathered[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, gathered[key])
+		}
+	}
+	for key := range gathered {
+		if _, ok := expected[key]; !ok {
+			t.Errorf("expected no %s, got %v", key, gathered[key])
+		}
+	}
+}
+
+func TestInstrumentedAuthServiceCountsSessions(t *testing.T) {
+	m := metrics.New()
+	inner := newTestAuthService(tokens.NewSystemEntropy())
+	service := NewInstrumentedAuthService(inner, m)
+	m.RegisterLiveSessions(service.CountLiveSessions)
+	ctx := context.Background()
+
+	if _, err := service.AuthorizeByGUID(ctx, testGuid, []string{tokens.AMRPassword, tokens.AMROTP}, testUserAgent, testIP); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := service.AuthorizeByGUID(ctx, testGuid, []string{tokens.AMRExternal}, testUserAgent, testIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err = service.RefreshAuth(ctx, pair.RefreshToken, testUserAgent, testIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMetrics(t, m.Registry, map[string]float64{
+		`medods_auth_logins_total{amr="pwd+otp"}`: 1,
+		`medods_auth_logins_total{amr="ext"}`:     1,
+		`medods_auth_refreshes_total`:             1,
+		`medods_auth_logouts_total`:               0,
+		`medods_auth_live_sessions`:               2,
+	})
+
+	authId, err := tokens.ParseEncodedRefreshToken(pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeleteAuthById(ctx, *authId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.AuthorizeByGUID(ctx, testGuid, []string{tokens.AMRExternal}, testUserAgent, testIP); err != nil {
+		t.Fatal(err)
+	}
+	// the revoked sessions are counted even if their access tokens couldn't be revoked
+	inner.revocations.err = errors.New("revocations are unavailable")
+	if count, err := service.RevokeSessions(ctx, testGuid); err == nil || count != 2 {
+		t.Fatalf("expected 2 sessions to be deleted with an error, got %d and %v", count, err)
+	}
+	assertMetrics(t, m.Registry, map[string]float64{
+		`medods_auth_logins_total{amr="pwd+otp"}`: 1,
+		`medods_auth_logins_total{amr="ext"}`:     2,
+		`medods_auth_refreshes_total`:             1,
+		`medods_auth_logouts_total`:               3,
+		`medods_auth_live_sessions`:               0,
+	})
+}
+
+// failingAuthService fails every refresh with err
+type failingAuthService struct {
+	AuthService
+	err error
+}
+
+func (s failingAuthService) RefreshAuth(context.Context, string, string, netip.Addr) (*TokenPair, error) {
+	return nil, s.err
+}
+
+func TestInstrumentedAuthServiceCountsRefreshFailures(t *testing.T) {
+	cases := map[string]struct {
+		err    error
+		reason string
+	}{
+		"expired":             {ErrAuthExpired, metrics.RefreshFailureExpired},
+		"user agent mismatch": {ErrUserAgentMismatch, metrics.RefreshFailureUserAgentMismatch},
+		"invalid format":      {ErrInvalidTokenFormat, metrics.RefreshFailureInvalidFormat},
+		"invalid token":       {ErrInvalidRefreshToken, metrics.RefreshFailureInvalidToken},
+		"wrapped":             {fmt.Errorf("refresh: %w", ErrAuthExpired), metrics.RefreshFailureExpired},
+		"other error":         {errors.New("connection refused"), metrics.RefreshFailureError},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := metrics.New()
+			service := NewInstrumentedAuthService(failingAuthService{err: tc.err}, m)
+
+			for range 2 {
+				if _, err := service.RefreshAuth(context.Background(), "token", testUserAgent, testIP); !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v", tc.err, err)
+				}
+			}
+			assertMetrics(t, m.Registry, map[string]float64{
+				`medods_auth_refreshes_total`: 0,
+				`medods_auth_logouts_total`:   0,
+				fmt.Sprintf(`medods_auth_refresh_failures_total{reason=%q}`, tc.reason): 2,
+			})
+		})
+	}
+}
+
+// resultReports returns the next of the results on every delivery
+type resultReports struct {
+	results []error
+}
+
+func (r *resultReports) SendIPChangeReport(context.Context, db.Auth, netip.Addr) error {
+	err := r.results[0]
+	r.results = r.results[1:]
+	return err
+}
+
+func TestInstrumentedReportServiceCountsDeliveries(t *testing.T) {
+	m := metrics.New()
+	service := NewInstrumentedReportService(&resultReports{results: []error{
+		nil,
+		nil,
+		fmt.Errorf("%w: expected 200, got 500", ErrWebhookRejected),
+		errors.New("connection refused"),
+	}}, m)
+
+	for range 4 {
+		_ = service.SendIPChangeReport(context.Background(), db.Auth{Guid: testGuid}, testIP)
+	}
+	assertMetrics(t, m.Registry, map[string]float64{
+		`medods_auth_refreshes_total`:                               0,
+		`medods_auth_logouts_total`:                                 0,
+		`medods_auth_webhook_deliveries_total{outcome="delivered"}`: 2,
+		`medods_auth_webhook_deliveries_total{outcome="rejected"}`:  1,
+		`medods_auth_webhook_deliveries_total{outcome="failed"}`:    1,
+	})
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("mfa already enabled")
+	ErrMFANotEnrolled    = errors.New("mfa not enrolled")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+	ErrInvalidChallenge  = errors.New("invalid mfa challenge")
+	ErrMFALocked         = errors.New("mfa locked")
+)
+
+const (
+	totpPeriod         = 30 * time.Second
+	recoveryCodesCount = 10
+	// challengeMaxAttempts is how many codes can be tried with one challenge
+	challengeMaxAttempts = 5
+	// mfaMaxAttempts is how many codes can be tried for a GUID with any challenges before it's locked for mfaLockout.
+	// Every attempt after the lock is over locks it again until a code is accepted.
+	mfaMaxAttempts = 10
+	mfaLockout     = 15 * time.Minute
+)
+
+var totpOpts = totp.ValidateOpts{
+	Period:    uint(totpPeriod / time.Second),
+	Digits:    otp.DigitsSix,
+	Algorithm: otp.AlgorithmSHA1,
+}
+
+// TOTPEnrollment holds what the user needs to add the TOTP to an authenticator app
+type TOTPEnrollment struct {
+	Secret string
+	// URI is an otpauth:// URI, usually shown as a QR code
+	URI string
+}
+
+type MFAService interface {
+	// IsEnabled reports whether the GUID has a confirmed TOTP
+	IsEnabled(ctx context.Context, guid string) (bool, error)
+	// EnrollTOTP generates a new TOTP secret for the GUID. It's not used until confirmed with ConfirmTOTP.
+	//
+	// Returns ErrMFAAlreadyEnabled if the GUID already has a confirmed TOTP.
+	EnrollTOTP(ctx context.Context, guid string) (*TOTPEnrollment, error)
+	// ConfirmTOTP enables the enrolled TOTP if the code is valid and returns a fresh set of recovery codes.
+	//
+	// Returns:
+	// 	- ErrMFANotEnrolled if there's no TOTP enrollment
+	// 	- ErrMFAAlreadyEnabled if the TOTP is already confirmed
+	// 	- ErrInvalidMFACode if the code doesn't match
+	ConfirmTOTP(ctx context.Context, guid, code string) ([]string, error)
+	// DisableTOTP removes the TOTP and recovery codes of the GUID
+	DisableTOTP(ctx context.Context, guid string) error
+	// RegenerateRecoveryCodes replaces all recovery codes of the GUID.
+	//
+	// Returns ErrMFANotEnrolled if the GUID doesn't have a confirmed TOTP.
+	RegenerateRecoveryCodes(ctx context.Context, guid string) ([]string, error)
+	// IssueChallenge issues a short-lived token stating that the first factor (amr) was verified for the GUID
+	IssueChallenge(guid string, amr []string) (string, error)
+	// CompleteChallenge verifies the challenge token together with either a TOTP code or a recovery code.
+	// Returns the GUID and the authentication methods for the new session. A challenge can be completed once and
+	// tried a limited number of times.
+	//
+	// Returns:
+	// 	- ErrInvalidChallenge if the challenge token is invalid, expired, already completed or out of attempts
+	// 	- ErrMFALocked if too many codes were tried for the GUID
+	// 	- ErrInvalidMFACode if the code doesn't match or was already used
+	CompleteChallenge(ctx context.Context, challenge, code, recoveryCode string) (string, []string, error)
+}
+
+type mfaService struct {
+	repo     repositories.MFARepository
+	settings *config.Store
+	clock    tokens.Clock
+	entropy  tokens.Entropy
+}
+
+// NewMFAService creates an MFAService. Challenge tokens are signed with the JWT key from settings.
+// TOTP codes and challenges are checked by the time of clock, secrets and recovery codes are generated from entropy
+func NewMFAService(repo repositories.MFARepository, settings *config.Store, clock tokens.Clock, entropy tokens.Entropy) MFAService {
+	return &mfaService{
+		repo:     repo,
+		settings: settings,
+		clock:    clock,
+		entropy:  entropy,
+	}
+}
+
+func (s *mfaService) IsEnabled(ctx context.Context, guid string) (bool, error) {
+	secret, err := s.repo.GetTOTPSecret(ctx, guid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return secret.ConfirmedAt != nil, nil
+}
+
+func (s *mfaService) EnrollTOTP(ctx context.Context, guid string) (*TOTPEnrollment, error) {
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.settings.Get().TOTPIssuer,
+		AccountName: guid,
+		Period:      totpOpts.Period,
+		Digits:      totpOpts.Digits,
+		Algorithm:   totpOpts.Algorithm,
+		Rand:        s.entropy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := s.repo.SaveUnconfirmedTOTPSecret(ctx, guid, key.Secret())
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	return &TOTPEnrollment{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+	}, nil
+}
+
+func (s *mfaService) ConfirmTOTP(ctx context.Context, guid, code string) ([]string, error) {
+	secret, err := s.repo.GetTOTPSecret(ctx, guid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFANotEnrolled
+		}
+		return nil, err
+	}
+	if secret.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	err = s.verifyTOTP(ctx, guid, secret.Secret, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.repo.ConfirmTOTPSecret(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *mfaService) DisableTOTP(ctx context.Context, guid string) error {
+	err := s.repo.DeleteRecoveryCodes(ctx, guid)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteTOTPSecret(ctx, guid)
+}
+
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, guid string) ([]string, error) {
+	enabled, err := s.IsEnabled(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrMFANotEnrolled
+	}
+
+	return s.replaceRecoveryCodes(ctx, guid)
+}
+
+func (s *mfaService) IssueChallenge(guid string, amr []string) (string, error) {
+	cfg := s.settings.Get()
+	return tokens.GenerateMFAChallengeToken(guid, amr, cfg.JwtKey, cfg.MFAChallengeTTL, s.clock, s.entropy)
+}
+
+func (s *mfaService) CompleteChallenge(ctx context.Context, challenge, code, recoveryCode string) (string, []string, error) {
+	claims, err := tokens.ParseMFAChallengeToken(challenge, s.settings.Get().JwtKey, s.clock)
+	if err != nil {
+		return "", nil, ErrInvalidChallenge
+	}
+	challengeId, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return "", nil, ErrInvalidChallenge
+	}
+
+	// the attempts are counted before the code is checked, so parallel requests can't try more codes
+	started, err := s.repo.StartChallengeAttempt(ctx, challengeId, claims.Guid, claims.ExpiresAt.Time, challengeMaxAttempts)
+	if err != nil {
+		return "", nil, err
+	}
+	if !started {
+		return "", nil, ErrInvalidChallenge
+	}
+
+	secret, err := s.repo.GetTOTPSecret(ctx, claims.Guid)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, ErrInvalidChallenge
+		}
+		return "", nil, err
+	}
+	if secret.ConfirmedAt == nil {
+		return "", nil, ErrInvalidChallenge
+	}
+
+	now := s.clock.Now()
+	started, err = s.repo.StartTOTPAttempt(ctx, claims.Guid, mfaMaxAttempts, now, now.Add(mfaLockout))
+	if err != nil {
+		return "", nil, err
+	}
+	if !started {
+		return "", nil, ErrMFALocked
+	}
+
+	amr := append([]string{}, claims.AMR...)
+	switch {
+	case code != "":
+		err = s.verifyTOTP(ctx, claims.Guid, secret.Secret, code)
+		if err != nil {
+			return "", nil, err
+		}
+		amr = append(amr, tokens.AMROTP)
+	case recoveryCode != "":
+		used, err := s.repo.UseRecoveryCode(ctx, claims.Guid, hashRecoveryCode(recoveryCode))
+		if err != nil {
+			return "", nil, err
+		}
+		if !used {
+			return "", nil, ErrInvalidMFACode
+		}
+		amr = append(amr, tokens.AMRRecoveryCode)
+	default:
+		return "", nil, ErrInvalidMFACode
+	}
+
+	consumed, err := s.repo.ConsumeChallenge(ctx, challengeId)
+	if err != nil {
+		return "", nil, err
+	}
+	if !consumed {
+		return "", nil, ErrInvalidChallenge
+	}
+	err = s.repo.ResetTOTPAttempts(ctx, claims.Guid)
+	if err != nil {
+		return "", nil, err
+	}
+	err = s.repo.DeleteExpiredChallenges(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return claims.Guid, append(amr, tokens.AMRMultiFactor), nil
+}
+
+// verifyTOTP checks the code within one period of clock skew and makes sure the same code can't be used twice
+func (s *mfaService) verifyTOTP(ctx context.Context, guid, secret, code string) error {
+	now := s.clock.Now()
+	for _, skew := range []time.Duration{0, -totpPeriod, totpPeriod} {
+		t := now.Add(skew)
+		expected, err := totp.GenerateCodeCustom(secret, t, totpOpts)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) != 1 {
+			continue
+		}
+
+		step := t.Unix() / int64(totpOpts.Period)
+		fresh, err := s.repo.UseTOTPStep(ctx, guid, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	return ErrInvalidMFACode
+}
+
+func (s *mfaService) replaceRecoveryCodes(ctx context.Context, guid string) ([]string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashes := make([]string, recoveryCodesCount)
+	for i := range codes {
+		code, err := generateRecoveryCode(s.entropy)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	err := s.repo.ReplaceRecoveryCodes(ctx, guid, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// generateRecoveryCode generates a random code formatted as `xxxxx-xxxxx`
+func generateRecoveryCode(entropy tokens.Entropy) (string, error) {
+	random := make([]byte, 8)
+	_, err := io.ReadFull(entropy, random)
+	if err != nil {
+		return "", err
+	}
+	encoded := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(random))[:10]
+	return encoded[:5] + "-" + encoded[5:], nil
+}
+
+// hashRecoveryCode hashes the normalized code. Recovery codes are random enough, so a fast hash is fine.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
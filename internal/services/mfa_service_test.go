@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"github.com/pquerna/otp/totp"
+)
+
+// wrongCode never matches a TOTP code, which is numeric
+const wrongCode = "wrong!"
+
+// memoryMFARepository keeps the TOTP secrets and the challenges in maps, the same way the queries update the tables.
+// Recovery codes aren't stored.
+type memoryMFARepository struct {
+	repositories.MFARepository
+	mu         sync.Mutex
+	secrets    map[string]db.TotpSecret
+	challenges map[uuid.UUID]db.MfaChallenge
+}
+
+func (r *memoryMFARepository) SaveUnconfirmedTOTPSecret(_ context.Context, guid, secret string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.secrets[guid].ConfirmedAt != nil {
+		return false, nil
+	}
+	r.secrets[guid] = db.TotpSecret{Guid: guid, Secret: secret}
+	return true, nil
+}
+
+func (r *memoryMFARepository) GetTOTPSecret(_ context.Context, guid string) (db.TotpSecret, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	secret, ok := r.secrets[guid]
+	if !ok {
+		return db.TotpSecret{}, sql.ErrNoRows
+	}
+	return secret, nil
+}
+
+func (r *memoryMFARepository) ConfirmTOTPSecret(_ context.Context, guid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	secret := r.secrets[guid]
+	now := time.Now()
+	secret.ConfirmedAt = &now
+	r.secrets[guid] = secret
+	return nil
+}
+
+func (r *memoryMFARepository) UseTOTPStep(_ context.Context, guid string, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	secret := r.secrets[guid]
+	if secret.LastUsedStep >= step {
+		return false, nil
+	}
+	secret.LastUsedStep = step
+	r.secrets[guid] = secret
+	return true, nil
+}
+
+func (r *memoryMFARepository) StartTOTPAttempt(_ context.Context, guid string, maxAttempts int32, now, lockedUntil time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	secret, ok := r.secrets[guid]
+	if !ok || (secret.LockedUntil != nil && secret.LockedUntil.After(now)) {
+		return false, nil
+	}
+	secret.Attempts++
+	secret.LockedUntil = nil
+	if secret.Attempts >= maxAttempts {
+		secret.LockedUntil = &lockedUntil
+	}
+	r.secrets[guid] = secret
+	return true, nil
+}
+
+func (r *memoryMFARepository) ResetTOTPAttempts(_ context.Context, guid string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	secret := r.secrets[guid]
+	secret.Attempts = 0
+	secret.LockedUntil = nil
+	r.secrets[guid] = secret
+	return nil
+}
+
+func (r *memoryMFARepository) StartChallengeAttempt(_ context.Context, id uuid.UUID, guid string, expiresAt time.Time, maxAttempts int32) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	challenge, ok := r.challenges[id]
+	if !ok {
+		challenge = db.MfaChallenge{ID: id, Guid: guid, ExpiresAt: expiresAt}
+	} else if challenge.ConsumedAt != nil || challenge.Attempts >= maxAttempts {
+		return false, nil
+	}
+	challenge.Attempts++
+	r.challenges[id] = challenge
+	return true, nil
+}
+
+func (r *memoryMFARepository) ConsumeChallenge(_ context.Context, id uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	challenge := r.challenges[id]
+	if challenge.ConsumedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	challenge.ConsumedAt = &now
+	r.challenges[id] = challenge
+	return true, nil
+}
+
+func (r *memoryMFARepository) DeleteExpiredChallenges(context.Context) error {
+	return nil
+}
+
+func (r *memoryMFARepository) ReplaceRecoveryCodes(context.Context, string, []string) error {
+	return nil
+}
+
+type testMFAService struct {
+	MFAService
+	clock *fakeClock
+	// secret is the confirmed TOTP secret of testGuid
+	secret string
+}
+
+func newTestMFAService(t *testing.T) *testMFAService {
+	t.Helper()
+	clock := &fakeClock{now: testStart}
+	repo := &memoryMFARepository{
+		secrets:    make(map[string]db.TotpSecret),
+		challenges: make(map[uuid.UUID]db.MfaChallenge),
+	}
+	settings := config.NewStore(&config.Config{
+		JwtKey:          "test-key",
+		TOTPIssuer:      "medods",
+		MFAChallengeTTL: time.Hour,
+	})
+	s := &testMFAService{MFAService: NewMFAService(repo, settings, clock, &sequenceEntropy{}), clock: clock}
+
+	enrollment, err := s.EnrollTOTP(context.Background(), testGuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.secret = enrollment.Secret
+	if _, err := s.ConfirmTOTP(context.Background(), testGuid, s.code(t)); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// code returns the TOTP code of the next time step, so it wasn't used yet
+func (s *testMFAService) code(t *testing.T) string {
+	t.Helper()
+	s.clock.Advance(totpPeriod)
+	code, err := totp.GenerateCodeCustom(s.secret, s.clock.Now(), totpOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func (s *testMFAService) challenge(t *testing.T) string {
+	t.Helper()
+	challenge, err := s.IssueChallenge(testGuid, []string{tokens.AMRPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+// fail tries the wrong code the given number of times
+func (s *testMFAService) fail(t *testing.T, challenge string, times int) {
+	t.Helper()
+	for range times {
+		if _, _, err := s.CompleteChallenge(context.Background(), challenge, wrongCode, ""); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("expected %v, got %v", ErrInvalidMFACode, err)
+		}
+	}
+}
+
+func TestCompleteChallengeLimits(t *testing.T) {
+	cases := map[string]struct {
+		// run tries codes and returns the challenge and the result expected when it's completed with a valid code
+		run      func(t *testing.T, s *testMFAService) string
+		expected error
+	}{
+		"valid code": {
+			run: func(t *testing.T, s *testMFAService) string {
+				challenge := s.challenge(t)
+				s.fail(t, challenge, challengeMaxAttempts-1)
+				return challenge
+			},
+		},
+		"completed challenge is replayed": {
+			run: func(t *testing.T, s *testMFAService) string {
+				challenge := s.challenge(t)
+				if _, _, err := s.CompleteChallenge(context.Background(), challenge, s.code(t), ""); err != nil {
+					t.Fatal(err)
+				}
+				return challenge
+			},
+			expected: ErrInvalidChallenge,
+		},
+		"challenge is out of attempts": {
+			run: func(t *testing.T, s *testMFAService) string {
+				challenge := s.challenge(t)
+				s.fail(t, challenge, challengeMaxAttempts)
+				return challenge
+			},
+			expected: ErrInvalidChallenge,
+		},
+		"guid is locked": {
+			run: func(t *testing.T, s *testMFAService) string {
+				for range mfaMaxAttempts / challengeMaxAttempts {
+					s.fail(t, s.challenge(t), challengeMaxAttempts)
+				}
+				return s.challenge(t)
+			},
+			expected: ErrMFALocked,
+		},
+		"lock is over": {
+			run: func(t *testing.T, s *testMFAService) string {
+				for range mfaMaxAttempts / challengeMaxAttempts {
+					s.fail(t, s.challenge(t), challengeMaxAttempts)
+				}
+				s.clock.Advance(mfaLockout)
+				return s.challenge(t)
+			},
+		},
+		"wrong code after the lock locks again": {
+			run: func(t *testing.T, s *testMFAService) string {
+				for range mfaMaxAttempts / challengeMaxAttempts {
+					s.fail(t, s.challenge(t), challengeMaxAttempts)
+				}
+				s.clock.Advance(mfaLockout)
+				s.fail(t, s.challenge(t), 1)
+				return s.challenge(t)
+			},
+			expected: ErrMFALocked,
+		},
+		"valid code resets the attempts": {
+			run: func(t *testing.T, s *testMFAService) string {
+				s.fail(t, s.challenge(t), mfaMaxAttempts/2)
+				if _, _, err := s.CompleteChallenge(context.Background(), s.challenge(t), s.code(t), ""); err != nil {
+					t.Fatal(err)
+				}
+				challenge := s.challenge(t)
+				s.fail(t, challenge, mfaMaxAttempts/2-1)
+				return challenge
+			},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := newTestMFAService(t)
+			challenge := tc.run(t, s)
+
+			guid, amr, err := s.CompleteChallenge(context.Background(), challenge, s.code(t), "")
+			if !errors.Is(err, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, err)
+			}
+			if tc.expected == nil && (guid != testGuid || tokens.ACRForAMR(amr) != tokens.ACRMultiFactor) {
+				t.Errorf("expected an MFA session for %s, got %s with %v", testGuid, guid, amr)
+			}
+		})
+	}
+}
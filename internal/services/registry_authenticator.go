@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// registryAuthenticator verifies JWT assertions signed by the patient registry.
+// The assertion must be issued by the registry for this service and for the GUID (`iss`, `aud` and `sub` claims)
+// and must not be expired.
+type registryAuthenticator struct {
+	publicKey interface{}
+	methods   []string
+	issuer    string
+	audience  string
+}
+
+// NewRegistryAuthenticator creates an authenticator for the patient registry assertions.
+// publicKeyPEM is a PKIX public key (RSA, ECDSA or Ed25519) of the registry.
+// Issuer and audience are required, so assertions issued for other services aren't accepted.
+func NewRegistryAuthenticator(publicKeyPEM []byte, issuer, audience string) (Authenticator, error) {
+	if issuer == "" || audience == "" {
+		return nil, errors.New("registry issuer and audience are required")
+	}
+
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return nil, errors.New("registry public key is not a PEM block")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []string
+	switch key.(type) {
+	case *rsa.PublicKey:
+		methods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512"}
+	case *ecdsa.PublicKey:
+		methods = []string{"ES256", "ES384", "ES512"}
+	case ed25519.PublicKey:
+		methods = []string{"EdDSA"}
+	default:
+		return nil, fmt.Errorf("unsupported registry public key type %T", key)
+	}
+
+	return &registryAuthenticator{
+		publicKey: key,
+		methods:   methods,
+		issuer:    issuer,
+		audience:  audience,
+	}, nil
+}
+
+func (a *registryAuthenticator) Authenticate(_ context.Context, guid, assertion string) error {
+	if assertion == "" {
+		return ErrIdentityNotVerified
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(a.methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithSubject(guid),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithAudience(a.audience),
+	}
+
+	_, err := jwt.ParseWithClaims(assertion, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return a.publicKey, nil
+	}, opts...)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIdentityNotVerified, err)
+	}
+
+	return nil
+}
@@ -2,30 +2,41 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/kwinso/medods-test-task/internal/config"
 	"github.com/kwinso/medods-test-task/internal/db"
 	"net/http"
 	"net/netip"
-	"net/url"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 type ReportService interface {
-	SendIPChangeReport(auth db.Auth, newIP netip.Addr) error
+	SendIPChangeReport(ctx context.Context, auth db.Auth, newIP netip.Addr) error
 }
 
 type WebhookReportsService struct {
-	reportEndpoint url.URL
+	settings *config.Store
+	client   *http.Client
 }
 
-func NewWebhookReportsService(reportEndpoint url.URL) WebhookReportsService {
+// NewWebhookReportsService creates a WebhookReportsService that sends reports to the webhook URL from settings.
+// Requests carry the trace context headers of ctx
+func NewWebhookReportsService(settings *config.Store) WebhookReportsService {
 	return WebhookReportsService{
-		reportEndpoint: reportEndpoint,
+		settings: settings,
+		client:   &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)},
 	}
 }
 
 var (
 	MismatchedResponseStatusErrFormat = "expected response status to be %d, but got %s"
+	// ErrWebhookRejected is returned when the webhook responds with an unexpected status
+	ErrWebhookRejected = errors.New("webhook rejected the report")
 )
 
 type ipChangeReport struct {
@@ -35,25 +46,42 @@ type ipChangeReport struct {
 	NewIP     string `json:"new_ip"`
 }
 
-func (s *WebhookReportsService) SendIPChangeReport(auth db.Auth, newIP netip.Addr) error {
-	ipReport := &ipChangeReport{
+// NewIPChangeReportPayload builds the JSON body of the IP change report
+func NewIPChangeReportPayload(auth db.Auth, newIP netip.Addr) ([]byte, error) {
+	return json.Marshal(&ipChangeReport{
 		Guid:      auth.Guid,
 		UserAgent: auth.UserAgent,
 		OldIP:     auth.IpAddress.String(),
 		NewIP:     newIP.String(),
+	})
+}
+
+func (s *WebhookReportsService) SendIPChangeReport(ctx context.Context, auth db.Auth, newIP netip.Addr) error {
+	content, err := NewIPChangeReportPayload(auth, newIP)
+	if err != nil {
+		return err
 	}
-	content, err := json.Marshal(ipReport)
+
+	return s.Deliver(ctx, content)
+}
+
+// Deliver posts an already built report to the webhook
+func (s *WebhookReportsService) Deliver(ctx context.Context, content []byte) error {
+	reportEndpoint := s.settings.Get().WebhookURL
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reportEndpoint.String(), bytes.NewBuffer(content))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.Post(s.reportEndpoint.String(), "application/json", bytes.NewBuffer(content))
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf(MismatchedResponseStatusErrFormat, 200, resp.Status)
+		return fmt.Errorf("%w: "+MismatchedResponseStatusErrFormat, ErrWebhookRejected, 200, resp.Status)
 	}
 
 	return nil
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/logging"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+const (
+	revocationsPruneInterval = time.Minute
+	revocationsRetryInterval = 5 * time.Second
+)
+
+// RevocationService keeps a compact in-memory list of revoked sessions, so access tokens can be validated without
+// a database round trip while logout still takes effect immediately.
+//
+// A revocation only has to be remembered until the access tokens issued for the session expire.
+type RevocationService interface {
+	// Revoke marks the session as revoked on this and all other instances
+	Revoke(ctx context.Context, authId uuid.UUID) error
+	IsRevoked(authId uuid.UUID) bool
+	// Run loads the active revocations and keeps the list in sync with other instances until ctx is done
+	Run(ctx context.Context)
+}
+
+type revocationService struct {
+	repo     repositories.RevocationsRepository
+	listener db.Listener
+	settings *config.Store
+	clock    tokens.Clock
+	logger   *slog.Logger
+
+	mu      sync.RWMutex
+	revoked map[uuid.UUID]time.Time
+}
+
+// NewRevocationService creates a RevocationService. Revocations are kept for the longest lifetime of an access token
+// the settings had, including leeway, so tokens issued before a reload that lowered the TTL are still rejected.
+// If listener is nil, revocations made by other instances are only picked up on start.
+func NewRevocationService(repo repositories.RevocationsRepository, listener db.Listener, settings *config.Store, clock tokens.Clock, logger *slog.Logger) RevocationService {
+	return &revocationService{
+		repo:     repo,
+		listener: listener,
+		settings: settings,
+		clock:    clock,
+		logger:   logger,
+		revoked:  make(map[uuid.UUID]time.Time),
+	}
+}
+
+func (s *revocationService) Revoke(ctx context.Context, authId uuid.UUID) error {
+	expiresAt := s.clock.Now().Add(s.settings.MaxTokenLifetime())
+	s.add(authId, expiresAt)
+
+	return s.repo.CreateRevocation(ctx, authId, expiresAt)
+}
+
+func (s *revocationService) IsRevoked(authId uuid.UUID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expiresAt, ok := s.revoked[authId]
+	return ok && s.clock.Now().Before(expiresAt)
+}
+
+func (s *revocationService) Run(ctx context.Context) {
+	if s.listener == nil {
+		if err := s.reload(ctx); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to load revocations", logging.Err(err))
+		}
+		s.pruneLoop(ctx)
+		return
+	}
+
+	go s.pruneLoop(ctx)
+
+	for {
+		err := s.sync(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.WarnContext(ctx, "Revocations sync failed, retrying", "retry_in", revocationsRetryInterval, logging.Err(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(revocationsRetryInterval):
+		}
+	}
+}
+
+// sync subscribes to the revocations channel and then reloads the list, so nothing revoked in between is missed
+func (s *revocationService) sync(ctx context.Context) error {
+	sub, err := s.listener.Subscribe(ctx, repositories.RevocationsChannel)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	err = s.reload(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		payload, err := sub.Next(ctx)
+		if err != nil {
+			return err
+		}
+
+		authId, err := uuid.Parse(payload)
+		if err != nil {
+			s.logger.WarnContext(ctx, "Ignoring malformed revocation notification", "payload", payload)
+			continue
+		}
+		s.add(authId, s.clock.Now().Add(s.settings.MaxTokenLifetime()))
+	}
+}
+
+func (s *revocationService) reload(ctx context.Context) error {
+	revocations, err := s.repo.ListActiveRevocations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, revocation := range revocations {
+		s.add(revocation.AuthID, revocation.ExpiresAt)
+	}
+	return nil
+}
+
+func (s *revocationService) add(authId uuid.UUID, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.revoked[authId]; !ok || current.Before(expiresAt) {
+		s.revoked[authId] = expiresAt
+	}
+}
+
+func (s *revocationService) pruneLoop(ctx context.Context) {
+	ticker := time.NewTicker(revocationsPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := s.clock.Now()
+		s.mu.Lock()
+		for authId, expiresAt := range s.revoked {
+			if now.After(expiresAt) {
+				delete(s.revoked, authId)
+			}
+		}
+		s.mu.Unlock()
+
+		if err := s.repo.DeleteExpiredRevocations(ctx); err != nil && ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "Failed to delete expired revocations", logging.Err(err))
+		}
+	}
+}
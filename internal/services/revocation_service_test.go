@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/config"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/logging"
+)
+
+const testLeeway = 30 * time.Second
+
+// memoryRevocationsRepository keeps the stored revocations in a map
+type memoryRevocationsRepository struct {
+	mu          sync.Mutex
+	revocations map[uuid.UUID]time.Time
+}
+
+func (r *memoryRevocationsRepository) CreateRevocation(_ context.Context, authId uuid.UUID, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revocations[authId] = expiresAt
+	return nil
+}
+
+func (r *memoryRevocationsRepository) ListActiveRevocations(context.Context) ([]db.AuthRevocation, error) {
+	return nil, nil
+}
+
+func (r *memoryRevocationsRepository) DeleteExpiredRevocations(context.Context) error {
+	return nil
+}
+
+// loadTestSettings loads the config from env vars, so it can be reloaded with other values
+func loadTestSettings(t *testing.T, tokenTTL string) *config.Store {
+	t.Helper()
+	t.Setenv("AUTH_WEBHOOK_URL", "http://localhost/webhook")
+	t.Setenv("AUTH_DB_URL", "postgres://localhost/auth")
+	t.Setenv("AUTH_JWT_KEY", "test-key")
+	t.Setenv("AUTH_REFRESH_TOKEN_PEPPER", "test-pepper")
+	t.Setenv("AUTH_AUTHENTICATOR", config.AuthenticatorNone)
+	t.Setenv("AUTH_ALLOW_INSECURE_AUTHENTICATOR", "true")
+	t.Setenv("AUTH_JWT_LEEWAY", testLeeway.String())
+	t.Setenv("AUTH_TOKEN_TTL", tokenTTL)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.NewStore(cfg)
+}
+
+func TestRevocationLifetime(t *testing.T) {
+	cases := map[string]struct {
+		reloadTTL string
+		lifetime  time.Duration
+	}{
+		"token lifetime": {
+			lifetime: testTokenTTL + testLeeway,
+		},
+		"reload raises ttl": {
+			reloadTTL: "10m",
+			lifetime:  10*time.Minute + testLeeway,
+		},
+		// tokens issued before the reload are valid for the old TTL
+		"reload lowers ttl": {
+			reloadTTL: "1m",
+			lifetime:  testTokenTTL + testLeeway,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			settings := loadTestSettings(t, testTokenTTL.String())
+			if tc.reloadTTL != "" {
+				t.Setenv("AUTH_TOKEN_TTL", tc.reloadTTL)
+				if _, _, err := settings.Reload(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			repo := &memoryRevocationsRepository{revocations: make(map[uuid.UUID]time.Time)}
+			clock := &fakeClock{now: testStart}
+			service := NewRevocationService(repo, nil, settings, clock, logging.Discard())
+
+			authId := uuid.New()
+			if service.IsRevoked(authId) {
+				t.Fatal("expected the session not to be revoked yet")
+			}
+			if err := service.Revoke(context.Background(), authId); err != nil {
+				t.Fatal(err)
+			}
+			if stored := repo.revocations[authId]; !stored.Equal(testStart.Add(tc.lifetime)) {
+				t.Errorf("expected the revocation to be stored until %s, got %s", testStart.Add(tc.lifetime), stored)
+			}
+
+			clock.Advance(tc.lifetime - time.Second)
+			if !service.IsRevoked(authId) {
+				t.Errorf("expected the session to be revoked for %s", tc.lifetime)
+			}
+
+			clock.Advance(time.Second)
+			if service.IsRevoked(authId) {
+				t.Error("expected the revocation to expire with the last token of the session")
+			}
+		})
+	}
+}
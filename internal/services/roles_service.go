@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+)
+
+// ScopeAdmin grants access to the admin API
+const ScopeAdmin = "auth:admin"
+
+// Grants are the roles of a GUID and the scopes they give
+type Grants struct {
+	Roles  []string
+	Scopes []string
+}
+
+type RolesService interface {
+	// GetGrants returns the roles of the GUID and the union of their scopes
+	GetGrants(ctx context.Context, guid string) (*Grants, error)
+
+	// SaveRole creates the role or replaces its scopes
+	SaveRole(ctx context.Context, name string, scopes []string) (db.Role, error)
+	ListRoles(ctx context.Context) ([]db.Role, error)
+	// DeleteRole returns ErrRoleNotFound if there's no such role
+	DeleteRole(ctx context.Context, name string) error
+	ListUserRoles(ctx context.Context, guid string) ([]db.Role, error)
+	// AssignRole returns ErrRoleNotFound if there's no such role
+	AssignRole(ctx context.Context, guid, role string) error
+	// UnassignRole returns ErrRoleNotFound if the GUID doesn't have the role
+	UnassignRole(ctx context.Context, guid, role string) error
+}
+
+type rolesService struct {
+	repo repositories.RolesRepository
+}
+
+func NewRolesService(repo repositories.RolesRepository) RolesService {
+	return &rolesService{
+		repo: repo,
+	}
+}
+
+func (s *rolesService) GetGrants(ctx context.Context, guid string) (*Grants, error) {
+	roles, err := s.repo.ListRolesByGuid(ctx, guid)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := &Grants{}
+	for _, role := range roles {
+		grants.Roles = append(grants.Roles, role.Name)
+		for _, scope := range role.Scopes {
+			if !slices.Contains(grants.Scopes, scope) {
+				grants.Scopes = append(grants.Scopes, scope)
+			}
+		}
+	}
+	slices.Sort(grants.Scopes)
+
+	return grants, nil
+}
+
+func (s *rolesService) SaveRole(ctx context.Context, name string, scopes []string) (db.Role, error) {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return s.repo.UpsertRole(ctx, name, scopes)
+}
+
+func (s *rolesService) ListRoles(ctx context.Context) ([]db.Role, error) {
+	return s.repo.ListRoles(ctx)
+}
+
+func (s *rolesService) DeleteRole(ctx context.Context, name string) error {
+	return translateRoleErr(s.repo.DeleteRole(ctx, name))
+}
+
+func (s *rolesService) ListUserRoles(ctx context.Context, guid string) ([]db.Role, error) {
+	return s.repo.ListRolesByGuid(ctx, guid)
+}
+
+func (s *rolesService) AssignRole(ctx context.Context, guid, role string) error {
+	return translateRoleErr(s.repo.AssignRole(ctx, guid, role))
+}
+
+func (s *rolesService) UnassignRole(ctx context.Context, guid, role string) error {
+	return translateRoleErr(s.repo.UnassignRole(ctx, guid, role))
+}
+
+func translateRoleErr(err error) error {
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrRoleNotFound
+	}
+	return err
+}
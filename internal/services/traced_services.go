@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/kwinso/medods-test-task/internal/services"
+
+// tracedAuthService creates a span for every AuthService call
+type tracedAuthService struct {
+	next   AuthService
+	tracer trace.Tracer
+}
+
+// NewTracedAuthService wraps the AuthService to create a span for every call
+func NewTracedAuthService(next AuthService) AuthService {
+	return &tracedAuthService{
+		next:   next,
+		tracer: otel.Tracer(tracerName),
+	}
+}
+
+func (s *tracedAuthService) AuthorizeByGUID(ctx context.Context, guid string, amr []string, userAgent string, ip netip.Addr) (*TokenPair, error) {
+	ctx, span := s.tracer.Start(ctx, "AuthService.AuthorizeByGUID", trace.WithAttributes(
+		attribute.StringSlice("auth.amr", amr),
+	))
+	defer span.End()
+
+	pair, err := s.next.AuthorizeByGUID(ctx, guid, amr, userAgent, ip)
+	recordSpanError(span, err)
+	return pair, err
+}
+
+func (s *tracedAuthService) ValidateAccessToken(ctx context.Context, token string) (*tokens.TokenClaims, error) {
+	ctx, span := s.tracer.Start(ctx, "AuthService.ValidateAccessToken")
+	defer span.End()
+
+	claims, err := s.next.ValidateAccessToken(ctx, token)
+	recordSpanError(span, err)
+	return claims, err
+}
+
+func (s *tracedAuthService) ValidateAccessTokenStateless(ctx context.Context, token string) (*tokens.TokenClaims, error) {
+	ctx, span := s.tracer.Start(ctx, "AuthService.ValidateAccessTokenStateless")
+	defer span.End()
+
+	claims, err := s.next.ValidateAccessTokenStateless(ctx, token)
+	recordSpanError(span, err)
+	return claims, err
+}
+
+func (s *tracedAuthService) RefreshAuth(ctx context.Context, refreshToken, userAgent string, ip netip.Addr) (*TokenPair, error) {
+	ctx, span := s.tracer.Start(ctx, "AuthService.RefreshAuth")
+	defer span.End()
+
+	pair, err := s.next.RefreshAuth(ctx, refreshToken, userAgent, ip)
+	recordSpanError(span, err)
+	return pair, err
+}
+
+func (s *tracedAuthService) DeleteAuthById(ctx context.Context, authId uuid.UUID) error {
+	ctx, span := s.tracer.Start(ctx, "AuthService.DeleteAuthById", trace.WithAttributes(
+		attribute.String("auth.id", authId.String()),
+	))
+	defer span.End()
+
+	err := s.next.DeleteAuthById(ctx, authId)
+	recordSpanError(span, err)
+	return err
+}
+
+func (s *tracedAuthService) ListSessions(ctx context.Context, guid string) ([]db.Auth, error) {
+	ctx, span := s.tracer.Start(ctx, "AuthService.ListSessions")
+	defer span.End()
+
+	sessions, err := s.next.ListSessions(ctx, guid)
+	recordSpanError(span, err)
+	return sessions, err
+}
+
+func (s *tracedAuthService) RevokeSessions(ctx context.Context, guid string) (int, error) {
+	ctx, span := s.tracer.Start(ctx, "AuthService.RevokeSessions")
+	defer span.End()
+
+	count, err := s.next.RevokeSessions(ctx, guid)
+	span.SetAttributes(attribute.Int("auth.revoked_sessions", count))
+	recordSpanError(span, err)
+	return count, err
+}
+
+func (s *tracedAuthService) CountLiveSessions(ctx context.Context) (int64, error) {
+	ctx, span := s.tracer.Start(ctx, "AuthService.CountLiveSessions")
+	defer span.End()
+
+	count, err := s.next.CountLiveSessions(ctx)
+	recordSpanError(span, err)
+	return count, err
+}
+
+func recordSpanError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"time"
+
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/logging"
+)
+
+const deadLetterTimeout = 5 * time.Second
+
+// WebhookDispatcher delivers reports with the next ReportService. Reports that can't be delivered are stored as
+// dead letters (see DeadLetterService).
+type WebhookDispatcher interface {
+	ReportService
+}
+
+type webhookDispatcher struct {
+	next        ReportService
+	deadLetters repositories.DeadLettersRepository
+	logger      *slog.Logger
+}
+
+// NewWebhookDispatcher creates a WebhookDispatcher that delivers reports with the next ReportService
+func NewWebhookDispatcher(next ReportService, deadLetters repositories.DeadLettersRepository, logger *slog.Logger) WebhookDispatcher {
+	return &webhookDispatcher{
+		next:        next,
+		deadLetters: deadLetters,
+		logger:      logger,
+	}
+}
+
+func (d *webhookDispatcher) SendIPChangeReport(ctx context.Context, auth db.Auth, newIP netip.Addr) error {
+	err := d.next.SendIPChangeReport(ctx, auth, newIP)
+	if err != nil {
+		d.storeDeadLetter(ctx, auth, newIP, err)
+	}
+	return err
+}
+
+func (d *webhookDispatcher) storeDeadLetter(ctx context.Context, auth db.Auth, newIP netip.Addr, deliveryErr error) {
+	payload, err := NewIPChangeReportPayload(auth, newIP)
+	if err == nil {
+		// the report is stored even if the request was canceled while it was delivered
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), deadLetterTimeout)
+		defer cancel()
+
+		err = d.deadLetters.CreateDeadLetter(ctx, db.CreateWebhookDeadLetterParams{
+			Guid:     auth.Guid,
+			AuthID:   auth.ID,
+			Payload:  payload,
+			Error:    deliveryErr.Error(),
+			Attempts: 1,
+		})
+	}
+	if err != nil {
+		d.logger.ErrorContext(ctx, "Failed to store webhook dead letter, the report is lost",
+			logging.KeyEvent, "ip_change", logging.KeyGUID, auth.Guid, logging.KeyAuthID, auth.ID, logging.Err(err))
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/db"
+	"github.com/kwinso/medods-test-task/internal/db/repositories"
+	"github.com/kwinso/medods-test-task/internal/logging"
+)
+
+// failingReports fails every delivery
+type failingReports struct{}
+
+func (failingReports) SendIPChangeReport(context.Context, db.Auth, netip.Addr) error {
+	return errors.New("webhook is down")
+}
+
+// deliveredReports accepts every delivery
+type deliveredReports struct{}
+
+func (deliveredReports) SendIPChangeReport(context.Context, db.Auth, netip.Addr) error {
+	return nil
+}
+
+// memoryDeadLetters keeps the stored dead letters in a slice
+type memoryDeadLetters struct {
+	repositories.DeadLettersRepository
+	mu          sync.Mutex
+	deadLetters []db.CreateWebhookDeadLetterParams
+}
+
+func (r *memoryDeadLetters) CreateDeadLetter(_ context.Context, deadLetter db.CreateWebhookDeadLetterParams) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadLetters = append(r.deadLetters, deadLetter)
+	return nil
+}
+
+func TestWebhookDispatcherStoresUndeliveredReports(t *testing.T) {
+	deadLetters := &memoryDeadLetters{}
+	dispatcher := NewWebhookDispatcher(failingReports{}, deadLetters, logging.Discard())
+
+	const failed = 3
+	for range failed {
+		auth := db.Auth{ID: uuid.New(), Guid: testGuid}
+		if err := dispatcher.SendIPChangeReport(context.Background(), auth, testIP); err == nil {
+			t.Fatal("expected the delivery error")
+		}
+	}
+
+	if len(deadLetters.deadLetters) != failed {
+		t.Fatalf("expected %d dead letters, got %d", failed, len(deadLetters.deadLetters))
+	}
+	for _, deadLetter := range deadLetters.deadLetters {
+		if deadLetter.Guid != testGuid || deadLetter.Error == "" || deadLetter.Attempts != 1 {
+			t.Errorf("expected a dead letter for %s with the delivery error, got %+v", testGuid, deadLetter)
+		}
+	}
+}
+
+func TestWebhookDispatcherDelivers(t *testing.T) {
+	deadLetters := &memoryDeadLetters{}
+	dispatcher := NewWebhookDispatcher(deliveredReports{}, deadLetters, logging.Discard())
+
+	if err := dispatcher.SendIPChangeReport(context.Background(), db.Auth{ID: uuid.New(), Guid: testGuid}, testIP); err != nil {
+		t.Fatal(err)
+	}
+	if len(deadLetters.deadLetters) != 0 {
+		t.Errorf("expected no dead letters, got %+v", deadLetters.deadLetters)
+	}
+}
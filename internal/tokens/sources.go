@@ -0,0 +1,39 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Clock tells the current time. Tokens are issued and validated by the time of the injected Clock,
+// so expiry can be tested without sleeping
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+// NewSystemClock creates a Clock that returns the wall clock time
+func NewSystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Entropy is the source of the random token parts and IDs. Anything but NewSystemEntropy is only meant for tests
+type Entropy io.Reader
+
+// NewSystemEntropy returns the cryptographically secure random source of crypto/rand
+func NewSystemEntropy() Entropy {
+	return rand.Reader
+}
+
+// NewID generates a random UUID from entropy
+func NewID(entropy Entropy) (uuid.UUID, error) {
+	return uuid.NewRandomFromReader(entropy)
+}
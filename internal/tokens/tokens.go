@@ -1,11 +1,14 @@
 package tokens
 
 import (
-	"crypto/rand"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"github.com/google/uuid"
+	"io"
+	"slices"
 	"strings"
 	"time"
 
@@ -14,46 +17,243 @@ import (
 )
 
 var (
-	ErrInvalidTokenFormat = errors.New("invalid token format")
+	ErrInvalidTokenFormat  = errors.New("invalid token format")
+	ErrUnexpectedTokenType = errors.New("unexpected token type")
+	ErrUnknownKeyID        = errors.New("unknown signing key id")
 )
 
+// Authentication method references (RFC 8176) put into the `amr` claim
+const (
+	// AMRExternal is used when the identity is confirmed by an upstream authenticator
+	AMRExternal     = "ext"
+	AMRPassword     = "pwd"
+	AMROTP          = "otp"
+	AMRRecoveryCode = "rcv"
+	AMRMultiFactor  = "mfa"
+)
+
+// Authentication context class references put into the `acr` claim.
+// These follow the NIST authenticator assurance levels.
+const (
+	ACRSingleFactor = "aal1"
+	ACRMultiFactor  = "aal2"
+)
+
+// mfaChallengeTokenType is put into the `typ` header of MFA challenge tokens,
+// so they can never be mistaken for access tokens signed with the same key
+const mfaChallengeTokenType = "mfa-challenge+jwt"
+
 type TokenClaims struct {
 	jwt.RegisteredClaims
 	Guid   string    `json:"guid"`
 	AuthId uuid.UUID `json:"auth_id"`
+	AMR    []string  `json:"amr,omitempty"`
+	ACR    string    `json:"acr,omitempty"`
+	Roles  []string  `json:"roles,omitempty"`
+	// Scope is a space-separated list of scopes, as in RFC 9068
+	Scope string `json:"scope,omitempty"`
+}
+
+// Scopes returns the scopes listed in the `scope` claim
+func (c *TokenClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// JWTConfig describes how access tokens are signed and validated
+type JWTConfig struct {
+	Key string
+	// KeyID is put into the `kid` header, so tokens can still be validated after the key is rotated
+	KeyID string
+	// PreviousKeys are rotated out keys by their IDs. They are only used to validate tokens issued before the rotation
+	PreviousKeys map[string]string
+	TTL          time.Duration
+	// Issuer is put into the `iss` claim and must match during validation
+	Issuer string
+	// Audience is put into the `aud` claim of issued tokens
+	Audience []string
+	// AllowedAudiences are accepted during validation, the token must be issued for at least one of them.
+	// If empty, Audience is used.
+	AllowedAudiences []string
+	// Leeway is the allowed clock skew for the `exp`, `nbf` and `iat` checks
+	Leeway time.Duration
+}
+
+// AccessTokenParams are the session details put into the access token
+type AccessTokenParams struct {
+	Guid   string
+	AuthId uuid.UUID
+	AMR    []string
+	ACR    string
+	Roles  []string
+	Scopes []string
+}
+
+// verificationKeys picks the key the token was signed with by its `kid`.
+// Tokens without `kid` were issued before key IDs were configured, so all the keys are tried.
+func verificationKeys(token *jwt.Token, cfg JWTConfig) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		keys := jwt.VerificationKeySet{Keys: []jwt.VerificationKey{[]byte(cfg.Key)}}
+		for _, key := range cfg.PreviousKeys {
+			keys.Keys = append(keys.Keys, []byte(key))
+		}
+		return keys, nil
+	}
+
+	if kid == cfg.KeyID {
+		return []byte(cfg.Key), nil
+	}
+	if key, ok := cfg.PreviousKeys[kid]; ok {
+		return []byte(key), nil
+	}
+	return nil, ErrUnknownKeyID
 }
 
-func GenerateAccessToken(guid string, authId uuid.UUID, key string, ttl time.Duration) (string, error) {
+// MFAChallengeClaims are the claims of a short-lived token that is issued after the first factor is verified
+type MFAChallengeClaims struct {
+	jwt.RegisteredClaims
+	Guid string   `json:"guid"`
+	AMR  []string `json:"amr"`
+}
+
+// ACRForAMR returns the assurance level that the authentication methods provide
+func ACRForAMR(amr []string) string {
+	for _, method := range amr {
+		if method == AMRMultiFactor {
+			return ACRMultiFactor
+		}
+	}
+	return ACRSingleFactor
+}
+
+// GenerateAccessToken issues an access token valid for cfg.TTL from the time of clock, with `jti` from entropy
+func GenerateAccessToken(params AccessTokenParams, cfg JWTConfig, clock Clock, entropy Entropy) (string, error) {
+	jti, err := NewID(entropy)
+	if err != nil {
+		return "", err
+	}
+
+	now := clock.Now()
 	t := jwt.NewWithClaims(jwt.SigningMethodHS512, TokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			Issuer:    cfg.Issuer,
+			Subject:   params.Guid,
+			Audience:  cfg.Audience,
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.TTL)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti.String(),
 		},
-		Guid:   guid,
-		AuthId: authId,
+		Guid:   params.Guid,
+		AuthId: params.AuthId,
+		AMR:    params.AMR,
+		ACR:    params.ACR,
+		Roles:  params.Roles,
+		Scope:  strings.Join(params.Scopes, " "),
 	})
 
-	return t.SignedString([]byte(key))
+	if cfg.KeyID != "" {
+		t.Header["kid"] = cfg.KeyID
+	}
+
+	return t.SignedString([]byte(cfg.Key))
 }
 
-func ParseAccessToken(tokenString, key string) (*TokenClaims, error) {
+// ParseAccessToken verifies the signature and the registered claims of the access token.
+// The token must be issued by cfg.Issuer for one of the allowed audiences, must not be expired or used before `nbf`,
+// and must have `iat`, `jti` and `sub` matching the GUID. The time claims are checked against clock.
+func ParseAccessToken(tokenString string, cfg JWTConfig, clock Clock) (*TokenClaims, error) {
 	// Parse the token
 	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// since we only use the one private key to sign the tokens,
-		// we also only use its public counterpart to verify
-		return []byte(key), nil
+		if token.Header["typ"] == mfaChallengeTokenType {
+			return nil, ErrUnexpectedTokenType
+		}
+		return verificationKeys(token, cfg)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(clock.Now),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*TokenClaims)
+
+	// jwt.WithIssuedAt only checks `iat` when it's present
+	if claims.IssuedAt == nil {
+		return nil, jwt.ErrTokenRequiredClaimMissing
+	}
+
+	allowedAudiences := cfg.AllowedAudiences
+	if len(allowedAudiences) == 0 {
+		allowedAudiences = cfg.Audience
+	}
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(allowedAudiences, aud)
+	}) {
+		return nil, jwt.ErrTokenInvalidAudience
+	}
+
+	if claims.Subject == "" || claims.Subject != claims.Guid {
+		return nil, jwt.ErrTokenInvalidSubject
+	}
+	if claims.ID == "" {
+		return nil, jwt.ErrTokenInvalidId
+	}
+
+	return claims, nil
+}
+
+// GenerateMFAChallengeToken generates a token that proves the first factor was verified for the GUID.
+// It expires ttl after the time of clock and has `jti` from entropy, so the challenge can be completed only once
+func GenerateMFAChallengeToken(guid string, amr []string, key string, ttl time.Duration, clock Clock, entropy Entropy) (string, error) {
+	jti, err := NewID(entropy)
+	if err != nil {
+		return "", err
+	}
+
+	t := jwt.NewWithClaims(jwt.SigningMethodHS512, MFAChallengeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(clock.Now().Add(ttl)),
+			ID:        jti.String(),
+		},
+		Guid: guid,
+		AMR:  amr,
 	})
+	t.Header["typ"] = mfaChallengeTokenType
+
+	return t.SignedString([]byte(key))
+}
+
+// ParseMFAChallengeToken verifies the challenge token, its expiry is checked against clock. The token must have `jti`
+func ParseMFAChallengeToken(tokenString, key string, clock Clock) (*MFAChallengeClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &MFAChallengeClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["typ"] != mfaChallengeTokenType {
+			return nil, ErrUnexpectedTokenType
+		}
+		return []byte(key), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS512.Alg()}), jwt.WithExpirationRequired(), jwt.WithTimeFunc(clock.Now))
 	if err != nil {
 		return nil, err
 	}
 
-	return token.Claims.(*TokenClaims), nil
+	claims := token.Claims.(*MFAChallengeClaims)
+	if claims.ID == "" {
+		return nil, jwt.ErrTokenInvalidId
+	}
+
+	return claims, nil
 }
 
-// GenerateRefreshToken generates a new refresh token which is a random 32-bit base64 string
-func GenerateRefreshToken(authId uuid.UUID) (string, error) {
+// GenerateRefreshToken generates a new refresh token for the session with 128 random bits from entropy
+func GenerateRefreshToken(authId uuid.UUID, entropy Entropy) (string, error) {
 	payload := authId.String()
 	randomPart := make([]byte, 16)
-	_, err := rand.Read(randomPart)
+	_, err := io.ReadFull(entropy, randomPart)
 	if err != nil {
 		return "", err
 	}
@@ -62,6 +262,16 @@ func GenerateRefreshToken(authId uuid.UUID) (string, error) {
 	return token, nil
 }
 
+// GenerateCSRFToken generates a token for the double-submit CSRF check with 128 random bits from entropy
+func GenerateCSRFToken(entropy Entropy) (string, error) {
+	token := make([]byte, 16)
+	_, err := io.ReadFull(entropy, token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
 func EncodeRefreshTokenToBase64(token string) string {
 	return base64.StdEncoding.EncodeToString([]byte(token))
 }
@@ -79,14 +289,35 @@ func ParseEncodedRefreshToken(token string) (*uuid.UUID, error) {
 	return &parsedUUID, nil
 }
 
-// HashRefreshToken hashes a refresh token using bcrypt for storing in the database
-func HashRefreshToken(refreshToken string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(refreshToken), 5)
-	return string(bytes), err
+// refreshTokenHashPrefix marks the HMAC-SHA256 refresh token hash format. Hashes without it are legacy bcrypt hashes
+const refreshTokenHashPrefix = "$hmac-sha256$v=1$"
+
+// HashRefreshToken hashes a refresh token with HMAC-SHA256 keyed by the server pepper for storing in the database.
+//
+// Refresh tokens carry 128 random bits, so a slow hash doesn't make them any harder to brute force.
+// The hash is deterministic and can be used to look the session up.
+func HashRefreshToken(refreshToken string, pepper []byte) string {
+	return refreshTokenHashPrefix + base64.RawStdEncoding.EncodeToString(refreshTokenMAC(refreshToken, pepper))
+}
+
+// VerifyRefreshToken verifies a refresh token against a hash made by HashRefreshToken.
+// Legacy bcrypt hashes are still accepted, they are replaced on the next refresh.
+func VerifyRefreshToken(refreshToken, hashed string, pepper []byte) bool {
+	encoded, ok := strings.CutPrefix(hashed, refreshTokenHashPrefix)
+	if !ok {
+		err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(refreshToken))
+		return err == nil
+	}
+
+	mac, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, refreshTokenMAC(refreshToken, pepper))
 }
 
-// VerifyRefreshToken verifies a refresh token using bcrypt
-func VerifyRefreshToken(refreshToken, hashed string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(refreshToken))
-	return err == nil
+func refreshTokenMAC(refreshToken string, pepper []byte) []byte {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(refreshToken))
+	return mac.Sum(nil)
 }
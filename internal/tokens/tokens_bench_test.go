@@ -0,0 +1,60 @@
+package tokens
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var benchmarkPepper = []byte("benchmark-pepper")
+
+func benchmarkRefreshToken(b *testing.B) string {
+	token, err := GenerateRefreshToken(uuid.New(), NewSystemEntropy())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return token
+}
+
+func BenchmarkHashRefreshToken(b *testing.B) {
+	token := benchmarkRefreshToken(b)
+
+	b.Run("bcrypt", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := bcrypt.GenerateFromPassword([]byte(token), 5); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("hmac-sha256", func(b *testing.B) {
+		for b.Loop() {
+			HashRefreshToken(token, benchmarkPepper)
+		}
+	})
+}
+
+func BenchmarkVerifyRefreshToken(b *testing.B) {
+	token := benchmarkRefreshToken(b)
+
+	legacyHash, err := bcrypt.GenerateFromPassword([]byte(token), 5)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	hashes := map[string]string{
+		"bcrypt":      string(legacyHash),
+		"hmac-sha256": HashRefreshToken(token, benchmarkPepper),
+	}
+
+	for _, name := range []string{"bcrypt", "hmac-sha256"} {
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				if !VerifyRefreshToken(token, hashes[name], benchmarkPepper) {
+					b.Fatal("refresh token didn't verify")
+				}
+			}
+		})
+	}
+}
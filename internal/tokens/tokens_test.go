@@ -0,0 +1,310 @@
+package tokens
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var testIssuedAt = time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+var testJWTConfig = JWTConfig{
+	Key:      "test-key",
+	KeyID:    "test",
+	TTL:      5 * time.Minute,
+	Issuer:   "medods-auth",
+	Audience: []string{"medods"},
+}
+
+// fixedClock always returns the same time
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// sequenceEntropy returns 0, 1, 2, ... so every run generates the same tokens and IDs
+type sequenceEntropy struct {
+	next byte
+}
+
+func (e *sequenceEntropy) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = e.next
+		e.next++
+	}
+	return len(p), nil
+}
+
+func testAccessToken(t *testing.T, cfg JWTConfig) string {
+	t.Helper()
+	token, err := GenerateAccessToken(AccessTokenParams{
+		Guid:   "12345678-1234-1234-1234-123456789012",
+		AuthId: uuid.MustParse("00000000-0000-4000-8000-000000000001"),
+	}, cfg, fixedClock(testIssuedAt), &sequenceEntropy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestGenerateAccessTokenIsDeterministic(t *testing.T) {
+	first := testAccessToken(t, testJWTConfig)
+	second := testAccessToken(t, testJWTConfig)
+	if first != second {
+		t.Errorf("expected the same token for the same clock and entropy, got %q and %q", first, second)
+	}
+
+	claims, err := ParseAccessToken(first, testJWTConfig, fixedClock(testIssuedAt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedId, err := NewID(&sequenceEntropy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID != expectedId.String() {
+		t.Errorf("expected jti %s from entropy, got %s", expectedId, claims.ID)
+	}
+	if !claims.IssuedAt.Equal(testIssuedAt) || !claims.NotBefore.Equal(testIssuedAt) {
+		t.Errorf("expected iat and nbf %v, got %v and %v", testIssuedAt, claims.IssuedAt, claims.NotBefore)
+	}
+	if !claims.ExpiresAt.Equal(testIssuedAt.Add(testJWTConfig.TTL)) {
+		t.Errorf("expected exp %v, got %v", testIssuedAt.Add(testJWTConfig.TTL), claims.ExpiresAt)
+	}
+}
+
+func TestAccessTokenCarriesGrants(t *testing.T) {
+	cases := map[string]struct {
+		roles  []string
+		scopes []string
+		scope  string
+	}{
+		"no grants":   {},
+		"one scope":   {roles: []string{"reports"}, scopes: []string{"reports:read"}, scope: "reports:read"},
+		"many scopes": {roles: []string{"admin", "reports"}, scopes: []string{"auth:admin", "reports:read"}, scope: "auth:admin reports:read"},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			token, err := GenerateAccessToken(AccessTokenParams{
+				Guid:   "12345678-1234-1234-1234-123456789012",
+				AuthId: uuid.MustParse("00000000-0000-4000-8000-000000000001"),
+				Roles:  tc.roles,
+				Scopes: tc.scopes,
+			}, testJWTConfig, fixedClock(testIssuedAt), &sequenceEntropy{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := ParseAccessToken(token, testJWTConfig, fixedClock(testIssuedAt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(claims.Roles, tc.roles) {
+				t.Errorf("expected roles %v, got %v", tc.roles, claims.Roles)
+			}
+			if claims.Scope != tc.scope {
+				t.Errorf("expected scope %q, got %q", tc.scope, claims.Scope)
+			}
+			if !slices.Equal(claims.Scopes(), tc.scopes) {
+				t.Errorf("expected scopes %v, got %v", tc.scopes, claims.Scopes())
+			}
+		})
+	}
+}
+
+func TestParseAccessTokenExpiryBoundaries(t *testing.T) {
+	withLeeway := testJWTConfig
+	withLeeway.Leeway = 30 * time.Second
+
+	cases := []struct {
+		name     string
+		cfg      JWTConfig
+		at       time.Duration
+		expected error
+	}{
+		{"issued", testJWTConfig, 0, nil},
+		{"just before expiry", testJWTConfig, testJWTConfig.TTL - time.Second, nil},
+		{"just after expiry", testJWTConfig, testJWTConfig.TTL + time.Second, jwt.ErrTokenExpired},
+		{"before issued", testJWTConfig, -time.Second, jwt.ErrTokenUsedBeforeIssued},
+		{"expired within leeway", withLeeway, testJWTConfig.TTL + 29*time.Second, nil},
+		{"expired after leeway", withLeeway, testJWTConfig.TTL + 31*time.Second, jwt.ErrTokenExpired},
+		{"before issued within leeway", withLeeway, -29 * time.Second, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			token := testAccessToken(t, c.cfg)
+
+			_, err := ParseAccessToken(token, c.cfg, fixedClock(testIssuedAt.Add(c.at)))
+			if c.expected == nil && err != nil {
+				t.Errorf("expected the token to be valid, got %v", err)
+			}
+			if c.expected != nil && !errors.Is(err, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+}
+
+// signTestClaims signs the claims with the key of testJWTConfig, so only the claims can make them invalid
+func signTestClaims(t *testing.T, claims TokenClaims) string {
+	t.Helper()
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	unsigned.Header["kid"] = testJWTConfig.KeyID
+	token, err := unsigned.SignedString([]byte(testJWTConfig.Key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestParseAccessTokenClaims(t *testing.T) {
+	const guid = "12345678-1234-1234-1234-123456789012"
+	valid := func() TokenClaims {
+		return TokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    testJWTConfig.Issuer,
+				Subject:   guid,
+				Audience:  testJWTConfig.Audience,
+				ExpiresAt: jwt.NewNumericDate(testIssuedAt.Add(testJWTConfig.TTL)),
+				NotBefore: jwt.NewNumericDate(testIssuedAt),
+				IssuedAt:  jwt.NewNumericDate(testIssuedAt),
+				ID:        "00000000-0000-4000-8000-000000000002",
+			},
+			Guid:   guid,
+			AuthId: uuid.MustParse("00000000-0000-4000-8000-000000000001"),
+		}
+	}
+	withAllowedAudiences := testJWTConfig
+	withAllowedAudiences.AllowedAudiences = []string{"medods", "medods-reports"}
+
+	cases := []struct {
+		name     string
+		cfg      JWTConfig
+		modify   func(claims *TokenClaims)
+		expected error
+	}{
+		{"valid", testJWTConfig, func(*TokenClaims) {}, nil},
+		{"other issuer", testJWTConfig, func(c *TokenClaims) { c.Issuer = "other-auth" }, jwt.ErrTokenInvalidIssuer},
+		{"no issuer", testJWTConfig, func(c *TokenClaims) { c.Issuer = "" }, jwt.ErrTokenRequiredClaimMissing},
+		{"other audience", testJWTConfig, func(c *TokenClaims) { c.Audience = jwt.ClaimStrings{"other"} }, jwt.ErrTokenInvalidAudience},
+		{"no audience", testJWTConfig, func(c *TokenClaims) { c.Audience = nil }, jwt.ErrTokenInvalidAudience},
+		{"one of the audiences", testJWTConfig, func(c *TokenClaims) { c.Audience = jwt.ClaimStrings{"other", "medods"} }, nil},
+		{"allowed audience", withAllowedAudiences, func(c *TokenClaims) { c.Audience = jwt.ClaimStrings{"medods-reports"} }, nil},
+		{"audience not allowed", withAllowedAudiences, func(c *TokenClaims) { c.Audience = jwt.ClaimStrings{"other"} }, jwt.ErrTokenInvalidAudience},
+		{"subject doesn't match guid", testJWTConfig, func(c *TokenClaims) { c.Subject = "87654321-4321-4321-4321-210987654321" }, jwt.ErrTokenInvalidSubject},
+		{"no subject", testJWTConfig, func(c *TokenClaims) { c.Subject = "" }, jwt.ErrTokenInvalidSubject},
+		{"no subject and guid", testJWTConfig, func(c *TokenClaims) { c.Subject, c.Guid = "", "" }, jwt.ErrTokenInvalidSubject},
+		{"no jti", testJWTConfig, func(c *TokenClaims) { c.ID = "" }, jwt.ErrTokenInvalidId},
+		{"no iat", testJWTConfig, func(c *TokenClaims) { c.IssuedAt = nil }, jwt.ErrTokenRequiredClaimMissing},
+		{"no exp", testJWTConfig, func(c *TokenClaims) { c.ExpiresAt = nil }, jwt.ErrTokenRequiredClaimMissing},
+		{"not valid yet", testJWTConfig, func(c *TokenClaims) { c.NotBefore = jwt.NewNumericDate(testIssuedAt.Add(time.Minute)) }, jwt.ErrTokenNotValidYet},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			claims := valid()
+			c.modify(&claims)
+
+			_, err := ParseAccessToken(signTestClaims(t, claims), c.cfg, fixedClock(testIssuedAt))
+			if c.expected == nil && err != nil {
+				t.Errorf("expected the token to be valid, got %v", err)
+			}
+			if c.expected != nil && !errors.Is(err, c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, err)
+			}
+		})
+	}
+}
+
+func TestMFAChallengeTokenExpiryBoundaries(t *testing.T) {
+	ttl := 5 * time.Minute
+	token, err := GenerateMFAChallengeToken("12345678-1234-1234-1234-123456789012", []string{AMRPassword}, "test-key", ttl,
+		fixedClock(testIssuedAt), &sequenceEntropy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseMFAChallengeToken(token, "test-key", fixedClock(testIssuedAt.Add(ttl-time.Second)))
+	if err != nil {
+		t.Errorf("expected the challenge to be valid before it expires, got %v", err)
+	} else if expectedId, _ := NewID(&sequenceEntropy{}); claims.ID != expectedId.String() {
+		t.Errorf("expected jti %s from entropy, got %s", expectedId, claims.ID)
+	}
+	if _, err := ParseMFAChallengeToken(token, "test-key", fixedClock(testIssuedAt.Add(ttl+time.Second))); !errors.Is(err, jwt.ErrTokenExpired) {
+		t.Errorf("expected the challenge to expire, got %v", err)
+	}
+}
+
+func TestMFAChallengeTokenRequiresID(t *testing.T) {
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodHS512, MFAChallengeClaims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(testIssuedAt.Add(time.Minute))},
+		Guid:             "12345678-1234-1234-1234-123456789012",
+	})
+	unsigned.Header["typ"] = mfaChallengeTokenType
+	token, err := unsigned.SignedString([]byte("test-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseMFAChallengeToken(token, "test-key", fixedClock(testIssuedAt)); !errors.Is(err, jwt.ErrTokenInvalidId) {
+		t.Errorf("expected %v, got %v", jwt.ErrTokenInvalidId, err)
+	}
+}
+
+func TestGenerateRefreshTokenFromEntropy(t *testing.T) {
+	authId := uuid.MustParse("00000000-0000-4000-8000-000000000001")
+
+	token, err := GenerateRefreshToken(authId, &sequenceEntropy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "rt." + authId.String() + ".000102030405060708090a0b0c0d0e0f"
+	if token != expected {
+		t.Errorf("expected %q, got %q", expected, token)
+	}
+
+	parsed, err := ParseEncodedRefreshToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != authId {
+		t.Errorf("expected auth ID %s, got %s", authId, parsed)
+	}
+
+	// a short read must fail instead of producing a token with fewer random bits
+	if _, err := GenerateRefreshToken(authId, bytes.NewReader(make([]byte, 8))); err == nil {
+		t.Error("expected an error when entropy runs out")
+	}
+}
+
+func TestRefreshTokenHashRoundTrip(t *testing.T) {
+	token, err := GenerateRefreshToken(uuid.New(), &sequenceEntropy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pepper := []byte("pepper")
+
+	hash := HashRefreshToken(token, pepper)
+	if !strings.HasPrefix(hash, refreshTokenHashPrefix) {
+		t.Errorf("expected the HMAC hash format, got %q", hash)
+	}
+	if !VerifyRefreshToken(token, hash, pepper) {
+		t.Error("expected the token to match its hash")
+	}
+	if VerifyRefreshToken(token, hash, []byte("other pepper")) {
+		t.Error("expected a different pepper not to match")
+	}
+	if VerifyRefreshToken(token+"0", hash, pepper) {
+		t.Error("expected a different token not to match")
+	}
+}
@@ -0,0 +1,396 @@
+// Package authclient is a Go client for the HTTP API of the auth service.
+//
+// The client keeps the token pair in a TokenStore: the login methods save the issued tokens, and the authenticated
+// methods send the stored access token, refreshing it before it expires or when the API rejects it. The same
+// token handling is available for other services' APIs with Client.Transport.
+//
+//	client, err := authclient.New(authclient.Config{BaseURL: "https://auth.medods.ru"})
+//	if err != nil { ... }
+//	if _, err := client.Login(ctx, guid, assertion); err != nil { ... }
+//	guid, err := client.Me(ctx)
+//
+// Refresh tokens are exchanged in the base64 encoding the API uses, TokenPair.RefreshToken holds the decoded token.
+package authclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultRefreshBefore = 30 * time.Second
+
+// Config of the Client
+type Config struct {
+	// BaseURL of the auth service, e.g. https://auth.medods.ru. The /v1 prefix is added by the client
+	BaseURL string
+	// HTTPClient sends the requests. http.DefaultClient by default
+	HTTPClient *http.Client
+	// Store keeps the token pair. NewMemoryStore by default
+	Store TokenStore
+	// RefreshBefore is how long before the access token expires it's refreshed. 30s by default
+	RefreshBefore time.Duration
+	// UserAgent is sent with the requests. Sessions are bound to the user agent they were created with,
+	// so it must not change while the tokens are in use
+	UserAgent string
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+}
+
+// Client calls the auth service. It's safe for concurrent use
+type Client struct {
+	baseURL       *url.URL
+	httpClient    *http.Client
+	authClient    *http.Client
+	store         TokenStore
+	refreshBefore time.Duration
+	userAgent     string
+	now           func() time.Time
+	refreshes     singleflight.Group
+}
+
+// TokenPair of a session
+type TokenPair struct {
+	AccessToken string
+	// RefreshToken is the decoded refresh token
+	RefreshToken string
+	// ExpiresAt is when the access token expires, read from its `exp` claim. Zero if the token has none
+	ExpiresAt time.Time
+}
+
+// LoginResult is either the tokens of the new session, or an MFA challenge that must be completed with MFALogin
+type LoginResult struct {
+	// Tokens of the new session, nil if MFA is required
+	Tokens *TokenPair
+	// MFARequired is set if the user has MFA enabled
+	MFARequired bool
+	// MFAToken must be passed to MFALogin together with the second factor
+	MFAToken string
+}
+
+// TOTPEnrollment is the secret of a TOTP enrollment that must be confirmed with ConfirmTOTP
+type TOTPEnrollment struct {
+	// Secret is a base32 TOTP secret for manual entry into an authenticator app
+	Secret string `json:"secret"`
+	// URI is an otpauth:// URI that can be shown as a QR code
+	URI string `json:"uri"`
+}
+
+// Role is a named set of scopes that can be assigned to users
+type Role struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// New creates a Client
+func New(cfg Config) (*Client, error) {
+	baseURL, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", cfg.BaseURL)
+	}
+
+	c := &Client{
+		baseURL:       baseURL.JoinPath("v1"),
+		httpClient:    cfg.HTTPClient,
+		store:         cfg.Store,
+		refreshBefore: cfg.RefreshBefore,
+		userAgent:     cfg.UserAgent,
+		now:           cfg.Now,
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	if c.store == nil {
+		c.store = NewMemoryStore()
+	}
+	if c.refreshBefore == 0 {
+		c.refreshBefore = defaultRefreshBefore
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+
+	authClient := *c.httpClient
+	authClient.Transport = c.Transport(c.httpClient.Transport)
+	c.authClient = &authClient
+	return c, nil
+}
+
+// Tokens returns the stored token pair, or ErrNoTokens
+func (c *Client) Tokens(ctx context.Context) (*TokenPair, error) {
+	return c.store.Load(ctx)
+}
+
+// Login creates a session for the GUID. Whether the assertion is required depends on the authenticator the service
+// is configured with. The tokens are saved to the store, unless MFA is required.
+func (c *Client) Login(ctx context.Context, guid, assertion string) (*LoginResult, error) {
+	return c.login(ctx, "login", map[string]string{"guid": guid, "assertion": assertion})
+}
+
+// PasswordLogin creates a session for the user with the username and password. The tokens are saved to the store,
+// unless MFA is required.
+func (c *Client) PasswordLogin(ctx context.Context, username, password string) (*LoginResult, error) {
+	return c.login(ctx, "login/password", map[string]string{"username": username, "password": password})
+}
+
+// MFALogin completes the login with the MFA token from LoginResult and either a TOTP code or a recovery code.
+// The tokens are saved to the store.
+func (c *Client) MFALogin(ctx context.Context, mfaToken, code, recoveryCode string) (*TokenPair, error) {
+	var res apiTokenPair
+	err := c.do(ctx, c.httpClient, http.MethodPost, "login/mfa", map[string]string{
+		"mfa_token":     mfaToken,
+		"code":          code,
+		"recovery_code": recoveryCode,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return c.saveTokens(ctx, res)
+}
+
+func (c *Client) login(ctx context.Context, path string, req any) (*LoginResult, error) {
+	var res struct {
+		apiTokenPair
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	if err := c.do(ctx, c.httpClient, http.MethodPost, path, req, &res); err != nil {
+		return nil, err
+	}
+
+	if res.MFARequired {
+		return &LoginResult{MFARequired: true, MFAToken: res.MFAToken}, nil
+	}
+	tokens, err := c.saveTokens(ctx, res.apiTokenPair)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{Tokens: tokens}, nil
+}
+
+// Refresh rotates the stored token pair. Concurrent refreshes, including the ones made by Transport, share one request.
+// If the session is expired or revoked, the tokens are cleared from the store.
+func (c *Client) Refresh(ctx context.Context) (*TokenPair, error) {
+	return c.refresh(ctx, nil)
+}
+
+// Me returns the GUID of the authenticated user
+func (c *Client) Me(ctx context.Context) (string, error) {
+	var res struct {
+		GUID string `json:"guid"`
+	}
+	if err := c.do(ctx, c.authClient, http.MethodGet, "me", nil, &res); err != nil {
+		return "", err
+	}
+	return res.GUID, nil
+}
+
+// Logout deletes the session and clears the tokens from the store
+func (c *Client) Logout(ctx context.Context) error {
+	if err := c.do(ctx, c.authClient, http.MethodDelete, "logout", nil, nil); err != nil {
+		return err
+	}
+	return c.store.Clear(ctx)
+}
+
+// RegisterCredentials adds a username and password to the authenticated user, so PasswordLogin can be used
+func (c *Client) RegisterCredentials(ctx context.Context, username, password string) error {
+	return c.do(ctx, c.authClient, http.MethodPost, "credentials", map[string]string{
+		"username": username,
+		"password": password,
+	}, nil)
+}
+
+// ChangePassword changes the password of the authenticated user
+func (c *Client) ChangePassword(ctx context.Context, oldPassword, newPassword string) error {
+	return c.do(ctx, c.authClient, http.MethodPut, "credentials/password", map[string]string{
+		"old_password": oldPassword,
+		"new_password": newPassword,
+	}, nil)
+}
+
+// EnrollTOTP starts the TOTP enrollment of the authenticated user
+func (c *Client) EnrollTOTP(ctx context.Context) (*TOTPEnrollment, error) {
+	var res TOTPEnrollment
+	if err := c.do(ctx, c.authClient, http.MethodPost, "mfa/totp", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ConfirmTOTP enables TOTP with the first code from the authenticator app. Returns the recovery codes
+func (c *Client) ConfirmTOTP(ctx context.Context, code string) ([]string, error) {
+	var res recoveryCodesResponse
+	if err := c.do(ctx, c.authClient, http.MethodPost, "mfa/totp/confirm", map[string]string{"code": code}, &res); err != nil {
+		return nil, err
+	}
+	return res.RecoveryCodes, nil
+}
+
+// DisableTOTP disables TOTP. The session must have been created with MFA
+func (c *Client) DisableTOTP(ctx context.Context) error {
+	return c.do(ctx, c.authClient, http.MethodDelete, "mfa/totp", nil, nil)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes. The session must have been created with MFA
+func (c *Client) RegenerateRecoveryCodes(ctx context.Context) ([]string, error) {
+	var res recoveryCodesResponse
+	if err := c.do(ctx, c.authClient, http.MethodPost, "mfa/recovery-codes", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.RecoveryCodes, nil
+}
+
+// ListRoles lists all roles. Requires the auth:admin scope
+func (c *Client) ListRoles(ctx context.Context) ([]Role, error) {
+	var res []Role
+	if err := c.do(ctx, c.authClient, http.MethodGet, "admin/roles", nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SaveRole creates the role or replaces its scopes. Requires the auth:admin scope
+func (c *Client) SaveRole(ctx context.Context, name string, scopes []string) (*Role, error) {
+	var res Role
+	err := c.do(ctx, c.authClient, http.MethodPut, "admin/roles/"+url.PathEscape(name), map[string][]string{"scopes": scopes}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// DeleteRole deletes the role. Requires the auth:admin scope
+func (c *Client) DeleteRole(ctx context.Context, name string) error {
+	return c.do(ctx, c.authClient, http.MethodDelete, "admin/roles/"+url.PathEscape(name), nil, nil)
+}
+
+// ListUserRoles lists the roles of the user. Requires the auth:admin scope
+func (c *Client) ListUserRoles(ctx context.Context, guid string) ([]Role, error) {
+	var res []Role
+	if err := c.do(ctx, c.authClient, http.MethodGet, "admin/users/"+url.PathEscape(guid)+"/roles", nil, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// AssignRole assigns the role to the user. Requires the auth:admin scope
+func (c *Client) AssignRole(ctx context.Context, guid, name string) error {
+	return c.do(ctx, c.authClient, http.MethodPut, "admin/users/"+url.PathEscape(guid)+"/roles/"+url.PathEscape(name), nil, nil)
+}
+
+// UnassignRole removes the role from the user. Requires the auth:admin scope
+func (c *Client) UnassignRole(ctx context.Context, guid, name string) error {
+	return c.do(ctx, c.authClient, http.MethodDelete, "admin/users/"+url.PathEscape(guid)+"/roles/"+url.PathEscape(name), nil, nil)
+}
+
+// apiTokenPair is the token pair as the API returns it
+type apiTokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// saveTokens decodes the token pair and saves it to the store
+func (c *Client) saveTokens(ctx context.Context, res apiTokenPair) (*TokenPair, error) {
+	tokens, err := decodeTokenPair(res)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.store.Save(ctx, tokens); err != nil {
+		return nil, fmt.Errorf("failed to save tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// encodeRefreshToken wraps the refresh token in base64 the way the API expects it
+func encodeRefreshToken(token string) string {
+	return base64.StdEncoding.EncodeToString([]byte(token))
+}
+
+func decodeTokenPair(res apiTokenPair) (*TokenPair, error) {
+	if res.AccessToken == "" || res.RefreshToken == "" {
+		return nil, errors.New("the response has no token pair")
+	}
+
+	refreshToken, err := base64.StdEncoding.DecodeString(res.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode refresh token: %w", err)
+	}
+
+	tokens := &TokenPair{AccessToken: res.AccessToken, RefreshToken: string(refreshToken)}
+	// the signature is checked by the service, the client only needs to know when to refresh
+	var claims jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(res.AccessToken, &claims); err == nil && claims.ExpiresAt != nil {
+		tokens.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return tokens, nil
+}
+
+// do sends the JSON request and decodes the response into out. Error responses are returned as *Error
+func (c *Client) do(ctx context.Context, httpClient *http.Client, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.JoinPath(path).String(), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return decodeError(res)
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// decodeError reads the problem details. Responses that aren't problems, e.g. from a proxy, only get the status
+func decodeError(res *http.Response) error {
+	apiErr := &Error{Status: res.StatusCode}
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/problem+json") {
+		_ = json.NewDecoder(res.Body).Decode(apiErr)
+		apiErr.Status = res.StatusCode
+	}
+	return apiErr
+}
@@ -0,0 +1,303 @@
+package authclient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testGUID = "12345678-1234-1234-1234-123456789012"
+
+// fakeAPI issues JWTs that expire in ttl and accepts only the latest token pair
+type fakeAPI struct {
+	t         *testing.T
+	ttl       time.Duration
+	mfaToken  string
+	refreshes atomic.Int32
+
+	mu           sync.Mutex
+	generation   int
+	accessToken  string
+	refreshToken string
+}
+
+func (a *fakeAPI) issue(w http.ResponseWriter) {
+	a.generation++
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   fmt.Sprint(a.generation),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(a.ttl)),
+	}).SignedString([]byte("key"))
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	a.accessToken = token
+	a.refreshToken = fmt.Sprintf("refresh.%d", a.generation)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"access_token":  a.accessToken,
+		"refresh_token": base64.StdEncoding.EncodeToString([]byte(a.refreshToken)),
+	})
+}
+
+func (a *fakeAPI) problem(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"status": status, "code": code})
+}
+
+func (a *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	switch r.Method + " " + r.URL.Path {
+	case "POST /v1/login":
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.mfaToken != "" {
+			_ = json.NewEncoder(w).Encode(map[string]any{"mfa_required": true, "mfa_token": a.mfaToken})
+			return
+		}
+		a.issue(w)
+	case "POST /v1/login/mfa":
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if body["mfa_token"] != a.mfaToken || body["code"] != "123456" {
+			a.problem(w, http.StatusUnauthorized, CodeInvalidMFACode)
+			return
+		}
+		a.issue(w)
+	case "PUT /v1/refresh":
+		a.refreshes.Add(1)
+		// give the concurrent requests time to pile up
+		time.Sleep(20 * time.Millisecond)
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		token, err := base64.StdEncoding.DecodeString(body["refresh_token"])
+		if err != nil || string(token) != a.refreshToken {
+			a.problem(w, http.StatusUnauthorized, CodeInvalidRefreshToken)
+			return
+		}
+		a.issue(w)
+	case "GET /v1/me":
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+a.accessToken {
+			a.problem(w, http.StatusUnauthorized, CodeSessionExpired)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"guid": testGUID})
+	default:
+		a.problem(w, http.StatusNotFound, CodeNotFound)
+	}
+}
+
+// rotate invalidates the tokens the client has, as if they were refreshed by someone else
+func (a *fakeAPI) rotate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.generation++
+	a.accessToken = fmt.Sprintf("rotated.%d", a.generation)
+	a.refreshToken = fmt.Sprintf("refresh.%d", a.generation)
+}
+
+func newTestClient(t *testing.T, api *fakeAPI, now func() time.Time) *Client {
+	t.Helper()
+
+	api.t = t
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	client, err := New(Config{BaseURL: server.URL, HTTPClient: server.Client(), Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestLogin(t *testing.T) {
+	api := &fakeAPI{ttl: 5 * time.Minute}
+	client := newTestClient(t, api, nil)
+
+	if _, err := client.Me(context.Background()); !errors.Is(err, ErrNoTokens) {
+		t.Fatalf("expected %v before login, got %v", ErrNoTokens, err)
+	}
+
+	res, err := client.Login(context.Background(), testGUID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MFARequired || res.Tokens.RefreshToken != api.refreshToken || res.Tokens.ExpiresAt.IsZero() {
+		t.Fatalf("expected the decoded token pair, got %+v", res.Tokens)
+	}
+
+	guid, err := client.Me(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if guid != testGUID {
+		t.Errorf("expected %s, got %s", testGUID, guid)
+	}
+}
+
+func TestMFALogin(t *testing.T) {
+	api := &fakeAPI{ttl: 5 * time.Minute, mfaToken: "challenge"}
+	client := newTestClient(t, api, nil)
+
+	res, err := client.Login(context.Background(), testGUID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.MFARequired || res.MFAToken != "challenge" || res.Tokens != nil {
+		t.Fatalf("expected an MFA challenge, got %+v", res)
+	}
+	if _, err := client.Tokens(context.Background()); !errors.Is(err, ErrNoTokens) {
+		t.Errorf("expected no tokens before the second factor, got %v", err)
+	}
+
+	_, err = client.MFALogin(context.Background(), res.MFAToken, "000000", "")
+	if !IsCode(err, CodeInvalidMFACode) {
+		t.Errorf("expected %s, got %v", CodeInvalidMFACode, err)
+	}
+
+	if _, err := client.MFALogin(context.Background(), res.MFAToken, "123456", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Me(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshOnUnauthorized(t *testing.T) {
+	api := &fakeAPI{ttl: 5 * time.Minute}
+	client := newTestClient(t, api, nil)
+	if _, err := client.Login(context.Background(), testGUID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// the access token is rejected, but the refresh token is still valid
+	api.mu.Lock()
+	api.accessToken = "revoked"
+	api.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Me(context.Background())
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if refreshes := api.refreshes.Load(); refreshes != 1 {
+		t.Errorf("expected the concurrent requests to share 1 refresh, got %d", refreshes)
+	}
+}
+
+func TestRefreshBeforeExpiry(t *testing.T) {
+	api := &fakeAPI{ttl: 5 * time.Minute}
+	now := time.Now()
+	client := newTestClient(t, api, func() time.Time { return now })
+	if _, err := client.Login(context.Background(), testGUID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Me(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if refreshes := api.refreshes.Load(); refreshes != 0 {
+		t.Fatalf("expected no refresh while the token is fresh, got %d", refreshes)
+	}
+
+	now = now.Add(5*time.Minute - defaultRefreshBefore/2)
+	if _, err := client.Me(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if refreshes := api.refreshes.Load(); refreshes != 1 {
+		t.Errorf("expected the token to be refreshed before it expires, got %d refreshes", refreshes)
+	}
+}
+
+func TestExpiredSessionClearsTokens(t *testing.T) {
+	api := &fakeAPI{ttl: 5 * time.Minute}
+	client := newTestClient(t, api, nil)
+	if _, err := client.Login(context.Background(), testGUID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	api.rotate()
+
+	_, err := client.Me(context.Background())
+	if !IsCode(err, CodeSessionExpired) {
+		t.Fatalf("expected the original %s error, got %v", CodeSessionExpired, err)
+	}
+	if _, err := client.Tokens(context.Background()); !errors.Is(err, ErrNoTokens) {
+		t.Errorf("expected the tokens to be cleared, got %v", err)
+	}
+}
+
+// trackedBody records whether the transport closed the request body
+type trackedBody struct {
+	closed atomic.Bool
+}
+
+func (b *trackedBody) Read([]byte) (int, error) { return 0, io.EOF }
+
+func (b *trackedBody) Close() error {
+	b.closed.Store(true)
+	return nil
+}
+
+func TestTransportClosesUnsentBody(t *testing.T) {
+	cases := map[string]func(t *testing.T, api *fakeAPI, client *Client, now *time.Time){
+		"no tokens": func(t *testing.T, api *fakeAPI, client *Client, now *time.Time) {},
+		"expired session": func(t *testing.T, api *fakeAPI, client *Client, now *time.Time) {
+			if _, err := client.Login(context.Background(), testGUID, ""); err != nil {
+				t.Fatal(err)
+			}
+			api.rotate()
+			*now = now.Add(10 * time.Minute)
+		},
+	}
+
+	for name, prepare := range cases {
+		t.Run(name, func(t *testing.T) {
+			api := &fakeAPI{ttl: 5 * time.Minute}
+			now := time.Now()
+			client := newTestClient(t, api, func() time.Time { return now })
+			prepare(t, api, client, &now)
+
+			body := &trackedBody{}
+			req, err := http.NewRequest(http.MethodPost, "http://example.com", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.Transport(nil).RoundTrip(req); err == nil {
+				t.Fatal("expected an error")
+			}
+			if !body.closed.Load() {
+				t.Error("expected the request body to be closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package authclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Stable error codes of the API, see Error.Code
+const (
+	CodeInternalError            = "internal_error"
+	CodeNotFound                 = "not_found"
+	CodeMalformedRequest         = "malformed_request"
+	CodeValidationFailed         = "validation_failed"
+	CodeMissingAccessToken       = "missing_access_token"
+	CodeCSRFTokenMismatch        = "csrf_token_mismatch"
+	CodeInvalidAccessToken       = "invalid_access_token"
+	CodeSessionExpired           = "session_expired"
+	CodeSessionRevokedUAMismatch = "session_revoked_ua_mismatch"
+	CodeInvalidRefreshToken      = "invalid_refresh_token"
+	CodeIdentityNotVerified      = "identity_not_verified"
+	CodeInvalidCredentials       = "invalid_credentials"
+	CodeCredentialsExist         = "credentials_exist"
+	CodeInvalidMFAChallenge      = "invalid_mfa_challenge"
+	CodeInvalidMFACode           = "invalid_mfa_code"
+	CodeMFANotEnrolled           = "mfa_not_enrolled"
+	CodeMFAAlreadyEnabled        = "mfa_already_enabled"
+	CodeMFARequired              = "mfa_required"
+	CodeInsufficientScope        = "insufficient_scope"
+	CodeRoleNotFound             = "role_not_found"
+)
+
+// ErrNoTokens is returned by the authenticated calls when the TokenStore has no tokens, i.e. the client must log in first
+var ErrNoTokens = errors.New("no tokens, log in first")
+
+// Error is a problem details response of the API (RFC 7807)
+type Error struct {
+	// Status is the HTTP status of the response
+	Status int `json:"status"`
+	// Code is the stable error code, one of the Code* constants. Rely on it instead of the status or the detail
+	Code string `json:"code"`
+	// Detail is a human-readable explanation, it may change and must not be parsed
+	Detail string `json:"detail"`
+	// Errors lists the invalid fields, only set for CodeValidationFailed
+	Errors []FieldError `json:"errors"`
+	// MissingScopes are the scopes the route requires, but the token lacks. Only set for CodeInsufficientScope
+	MissingScopes []string `json:"missing_scopes"`
+}
+
+// FieldError describes a single invalid field of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("auth: %d %s", e.Status, e.Code)
+	}
+	return fmt.Sprintf("auth: %d %s: %s", e.Status, e.Code, e.Detail)
+}
+
+// IsCode reports whether err is an Error with the code
+func IsCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// isUnauthorized reports whether the tokens were rejected, so they can't be used anymore
+func isUnauthorized(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized
+}
@@ -0,0 +1,56 @@
+package authclient
+
+import (
+	"context"
+	"sync"
+)
+
+// TokenStore keeps the token pair of the client. Implementations must be safe for concurrent use.
+// The client saves the pair after every login and refresh, so e.g. a store backed by a file or a database
+// lets the session survive restarts.
+type TokenStore interface {
+	// Load returns the current token pair, or ErrNoTokens if there's none
+	Load(ctx context.Context) (*TokenPair, error)
+	// Save replaces the token pair
+	Save(ctx context.Context, tokens *TokenPair) error
+	// Clear removes the token pair, e.g. after logout or when the session is expired
+	Clear(ctx context.Context) error
+}
+
+type memoryStore struct {
+	mu     sync.Mutex
+	tokens *TokenPair
+}
+
+// NewMemoryStore creates a TokenStore that keeps the token pair in memory
+func NewMemoryStore() TokenStore {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) Load(context.Context) (*TokenPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens == nil {
+		return nil, ErrNoTokens
+	}
+	tokens := *s.tokens
+	return &tokens, nil
+}
+
+func (s *memoryStore) Save(_ context.Context, tokens *TokenPair) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := *tokens
+	s.tokens = &saved
+	return nil
+}
+
+func (s *memoryStore) Clear(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = nil
+	return nil
+}
@@ -0,0 +1,135 @@
+package authclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Transport returns a RoundTripper that sends the requests with the stored access token in the Authorization header.
+// The token is refreshed before it expires, and once more if the request is rejected with 401. Requests with a body
+// are only retried if the body can be rewound, see http.Request.GetBody. If the tokens can't be refreshed, the 401
+// response is returned as is. base sends the requests, http.DefaultTransport if nil.
+//
+// The RoundTripper can be used for the APIs of other services that accept the access tokens.
+func (c *Client) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{client: c, base: base}
+}
+
+type transport struct {
+	client *Client
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	tokens, err := t.client.store.Load(ctx)
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+
+	if t.client.expiresSoon(tokens) {
+		refreshed, err := t.client.refresh(ctx, tokens)
+		switch {
+		case err == nil:
+			tokens = refreshed
+		case !t.client.now().Before(tokens.ExpiresAt):
+			closeBody(req)
+			return nil, err
+		}
+		// the token is still valid, it's refreshed again on 401
+	}
+
+	res, err := t.send(req, tokens)
+	if err != nil || !shouldRefresh(req, res) {
+		return res, err
+	}
+
+	refreshed, err := t.client.refresh(ctx, tokens)
+	if err != nil {
+		return res, nil
+	}
+
+	retry := req.Clone(ctx)
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return res, nil
+		}
+	}
+	_ = res.Body.Close()
+	return t.send(retry, refreshed)
+}
+
+// closeBody closes the body of a request that isn't sent, a RoundTripper must close it even on errors
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+// send sends a copy of the request with the access token, so the caller's request isn't modified
+func (t *transport) send(req *http.Request, tokens *TokenPair) (*http.Response, error) {
+	authorized := req.Clone(req.Context())
+	authorized.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	return t.base.RoundTrip(authorized)
+}
+
+// shouldRefresh reports whether the request was rejected because of the access token and can be sent again.
+// Routes that require a session created with MFA reject it with 401 too, a refresh doesn't help there.
+func shouldRefresh(req *http.Request, res *http.Response) bool {
+	if res.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	if strings.Contains(res.Header.Get("WWW-Authenticate"), "insufficient_user_authentication") {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+func (c *Client) expiresSoon(tokens *TokenPair) bool {
+	return !tokens.ExpiresAt.IsZero() && !c.now().Add(c.refreshBefore).Before(tokens.ExpiresAt)
+}
+
+// refresh rotates the stored token pair, unless it was rotated since stale was loaded. Concurrent refreshes share
+// one request, the refresh token can only be used once. If the session is expired or revoked, the store is cleared.
+func (c *Client) refresh(ctx context.Context, stale *TokenPair) (*TokenPair, error) {
+	result := c.refreshes.DoChan("refresh", func() (any, error) {
+		// the request is shared, so it must not be canceled with the context of the caller that started it
+		ctx := context.WithoutCancel(ctx)
+
+		current, err := c.store.Load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if stale != nil && current.AccessToken != stale.AccessToken {
+			return current, nil
+		}
+
+		var res apiTokenPair
+		err = c.do(ctx, c.httpClient, http.MethodPut, "refresh", map[string]string{
+			"refresh_token": encodeRefreshToken(current.RefreshToken),
+		}, &res)
+		if err != nil {
+			if isUnauthorized(err) {
+				_ = c.store.Clear(ctx)
+			}
+			return nil, err
+		}
+		return c.saveTokens(ctx, res)
+	})
+
+	select {
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*TokenPair), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,160 @@
+// Package grpcauth authenticates incoming gRPC calls against the auth service.
+//
+// The interceptors take the access token from the `authorization` metadata, validate it with
+// the ValidateAccessToken call of the auth service and put the claims into the context of the call:
+//
+//	conn, err := grpc.NewClient("auth:9090", grpc.WithTransportCredentials(creds))
+//	server := grpc.NewServer(
+//		grpc.ChainUnaryInterceptor(grpcauth.UnaryServerInterceptor(grpcauth.Config{
+//			Client: authpb.NewAuthServiceClient(conn),
+//		})),
+//	)
+//
+// Handlers read the claims with ClaimsFromContext.
+package grpcauth
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kwinso/medods-test-task/pkg/authpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationMetadata is the metadata key of the access token, sent with the Bearer scheme
+const AuthorizationMetadata = "authorization"
+
+// Claims of a validated access token
+type Claims struct {
+	// GUID of the authenticated user
+	GUID string
+	// AuthID is the ID of the session
+	AuthID string
+	// AMR lists the authentication methods the session was created with
+	AMR []string
+	// ACR is the assurance level of the session
+	ACR string
+	// Roles of the user at the time the token was issued
+	Roles []string
+	// Scopes granted by the roles
+	Scopes []string
+	// ExpiresAt is when the access token expires
+	ExpiresAt time.Time
+}
+
+// HasScopes reports whether the token has all the given scopes
+func (c *Claims) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the claims put into the context by the interceptors
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// BearerToken reads the access token from the `authorization` metadata of an incoming call
+func BearerToken(ctx context.Context) (string, bool) {
+	values := metadata.ValueFromIncomingContext(ctx, AuthorizationMetadata)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || scheme != "Bearer" || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// WithBearerToken adds the access token to the metadata of the outgoing calls made with ctx
+func WithBearerToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, AuthorizationMetadata, "Bearer "+token)
+}
+
+// Config of the interceptors
+type Config struct {
+	// Client of the auth service the tokens are validated with
+	Client authpb.AuthServiceClient
+	// SkipMethods are the full method names called without authentication, e.g. "/grpc.health.v1.Health/Check"
+	SkipMethods []string
+}
+
+// UnaryServerInterceptor rejects the calls without a valid access token with codes.Unauthenticated.
+// If the auth service can't be reached, the calls fail with codes.Unavailable.
+func UnaryServerInterceptor(cfg Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if slices.Contains(cfg.SkipMethods, info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		ctx, err := authenticate(ctx, cfg.Client)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streams. The stream is authenticated once, when it's opened.
+func StreamServerInterceptor(cfg Config) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if slices.Contains(cfg.SkipMethods, info.FullMethod) {
+			return handler(srv, stream)
+		}
+
+		ctx, err := authenticate(stream.Context(), cfg.Client)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authenticate validates the bearer token of the call and returns the context with its claims
+func authenticate(ctx context.Context, client authpb.AuthServiceClient) (context.Context, error) {
+	token, ok := BearerToken(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "the call must have a bearer token in the authorization metadata")
+	}
+
+	res, err := client.ValidateAccessToken(ctx, &authpb.ValidateAccessTokenRequest{AccessToken: token})
+	if err != nil {
+		if status.Code(err) == codes.Unauthenticated {
+			return nil, err
+		}
+		return nil, status.Errorf(codes.Unavailable, "failed to validate the access token: %v", status.Convert(err).Message())
+	}
+
+	return context.WithValue(ctx, claimsKey{}, &Claims{
+		GUID:      res.GetGuid(),
+		AuthID:    res.GetAuthId(),
+		AMR:       res.GetAmr(),
+		ACR:       res.GetAcr(),
+		Roles:     res.GetRoles(),
+		Scopes:    res.GetScopes(),
+		ExpiresAt: res.GetExpiresAt().AsTime(),
+	}), nil
+}
+
+// authenticatedStream overrides the context of the stream with the one carrying the claims
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,106 @@
+package grpcauth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kwinso/medods-test-task/pkg/authpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAuthClient accepts only the "valid" token
+type fakeAuthClient struct {
+	authpb.AuthServiceClient
+	err error
+}
+
+func (c *fakeAuthClient) ValidateAccessToken(_ context.Context, in *authpb.ValidateAccessTokenRequest, _ ...grpc.CallOption) (*authpb.ValidateAccessTokenResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if in.GetAccessToken() != "valid" {
+		return nil, status.Error(codes.Unauthenticated, "the access token is invalid")
+	}
+	return &authpb.ValidateAccessTokenResponse{Guid: "guid", AuthId: "auth", Scopes: []string{"reports:read"}}, nil
+}
+
+func incoming(authorization string) context.Context {
+	if authorization == "" {
+		return context.Background()
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthorizationMetadata, authorization))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Call"}
+
+	cases := map[string]struct {
+		authorization string
+		client        *fakeAuthClient
+		skip          []string
+		code          codes.Code
+	}{
+		"valid token":          {authorization: "Bearer valid", client: &fakeAuthClient{}, code: codes.OK},
+		"invalid token":        {authorization: "Bearer stolen", client: &fakeAuthClient{}, code: codes.Unauthenticated},
+		"missing token":        {client: &fakeAuthClient{}, code: codes.Unauthenticated},
+		"wrong scheme":         {authorization: "Basic valid", client: &fakeAuthClient{}, code: codes.Unauthenticated},
+		"auth service is down": {authorization: "Bearer valid", client: &fakeAuthClient{err: status.Error(codes.Unavailable, "down")}, code: codes.Unavailable},
+		"skipped method":       {client: &fakeAuthClient{}, skip: []string{info.FullMethod}, code: codes.OK},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			interceptor := UnaryServerInterceptor(Config{Client: tc.client, SkipMethods: tc.skip})
+
+			var claims *Claims
+			_, err := interceptor(incoming(tc.authorization), nil, info, func(ctx context.Context, _ any) (any, error) {
+				claims, _ = ClaimsFromContext(ctx)
+				return nil, nil
+			})
+
+			if code := status.Code(err); code != tc.code {
+				t.Fatalf("expected %s, got %s", tc.code, code)
+			}
+			if tc.code == codes.OK && tc.skip == nil && (claims == nil || claims.GUID != "guid" || !claims.HasScopes("reports:read")) {
+				t.Errorf("expected the claims in the context, got %+v", claims)
+			}
+		})
+	}
+}
+
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor(Config{Client: &fakeAuthClient{}})
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Stream"}
+
+	var claims *Claims
+	err := interceptor(nil, &testStream{ctx: incoming("Bearer valid")}, info, func(_ any, stream grpc.ServerStream) error {
+		claims, _ = ClaimsFromContext(stream.Context())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims == nil || claims.AuthID != "auth" {
+		t.Errorf("expected the claims in the stream context, got %+v", claims)
+	}
+
+	err = interceptor(nil, &testStream{ctx: incoming("")}, info, func(any, grpc.ServerStream) error {
+		t.Fatal("expected the stream to be rejected")
+		return nil
+	})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected %s, got %s", codes.Unauthenticated, status.Code(err))
+	}
+}
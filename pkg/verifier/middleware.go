@@ -0,0 +1,78 @@
+package verifier
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kwinso/medods-test-task/internal/api"
+)
+
+// Middleware verifies the bearer token of the request and puts its claims into the request context, see
+// ClaimsFromContext. Requests without a valid token are rejected with 401 and a problem+json body with the same
+// error codes the auth service uses.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := v.verifyRequest(r)
+		if err != nil {
+			problem := problemFor(err)
+			problem.Instance = r.URL.Path
+			if problem.Status == http.StatusUnauthorized {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			w.Header().Set("Content-Type", api.ProblemContentType)
+			w.WriteHeader(problem.Status)
+			_ = json.NewEncoder(w).Encode(problem)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
+	})
+}
+
+// Gin is Middleware for gin. The claims are put into the context of c.Request, so they're read with
+// ClaimsFromContext(c.Request.Context())
+func (v *Verifier) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, err := v.verifyRequest(c.Request)
+		if err != nil {
+			problem := problemFor(err)
+			problem.Instance = c.Request.URL.Path
+			if problem.Status == http.StatusUnauthorized {
+				c.Header("WWW-Authenticate", "Bearer")
+			}
+			c.Header("Content-Type", api.ProblemContentType)
+			c.AbortWithStatusJSON(problem.Status, problem)
+			return
+		}
+
+		c.Request = c.Request.WithContext(WithClaims(c.Request.Context(), claims))
+		c.Next()
+	}
+}
+
+func (v *Verifier) verifyRequest(r *http.Request) (*Claims, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || scheme != "Bearer" || token == "" {
+		return nil, ErrMissingToken
+	}
+	return v.Verify(r.Context(), token)
+}
+
+// problemFor maps the verification error to the problem the auth service responds with in the same case.
+// Failures of the session check itself are answered with 500, so the details don't leak to the client.
+func problemFor(err error) api.Problem {
+	switch {
+	case errors.Is(err, ErrMissingToken):
+		return api.NewProblem(http.StatusUnauthorized, api.CodeMissingAccessToken,
+			"The request must have a bearer token in the Authorization header")
+	case errors.Is(err, ErrTokenExpired), errors.Is(err, ErrSessionNotAlive):
+		return api.NewProblem(http.StatusUnauthorized, api.CodeSessionExpired, "The session is expired or was logged out")
+	case errors.Is(err, ErrInvalidToken):
+		return api.NewProblem(http.StatusUnauthorized, api.CodeInvalidAccessToken, "The access token is invalid")
+	default:
+		return api.NewProblem(http.StatusInternalServerError, api.CodeInternalError, "")
+	}
+}
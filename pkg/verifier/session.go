@@ -0,0 +1,45 @@
+package verifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// HTTPSessionCheck checks the session with the GET /v1/me route of the auth service at baseURL.
+// It costs a request per verified token, so it's meant for the routes where logout must apply immediately.
+// httpClient is http.DefaultClient if nil.
+func HTTPSessionCheck(baseURL string, httpClient *http.Client) (SessionCheck, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid base URL %q: must be an absolute http or https URL", baseURL)
+	}
+	meURL := u.JoinPath("v1", "me").String()
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return func(ctx context.Context, token string, _ *Claims) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, meURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		res, err := httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to check session: %w", err)
+		}
+		defer res.Body.Close()
+
+		switch res.StatusCode {
+		case http.StatusOK:
+			return nil
+		case http.StatusUnauthorized:
+			return ErrSessionNotAlive
+		default:
+			return fmt.Errorf("failed to check session: unexpected status %d", res.StatusCode)
+		}
+	}, nil
+}
@@ -0,0 +1,206 @@
+// Package verifier verifies the access tokens of the auth service in other Go services, without a call to the
+// service for every request. It provides net/http and gin middleware that put the claims of the token into the
+// request context:
+//
+//	v, err := verifier.New(verifier.Config{Key: os.Getenv("AUTH_JWT_KEY")})
+//	if err != nil { ... }
+//	http.Handle("/reports", v.Middleware(reportsHandler))
+//
+//	func reportsHandler(w http.ResponseWriter, r *http.Request) {
+//		guid := verifier.GUID(r.Context())
+//		...
+//	}
+//
+// The tokens are checked the same way the auth service does it: signature, issuer, audience, expiry and the claims.
+// Logout and revocations aren't visible this way, set Config.CheckSession (e.g. to HTTPSessionCheck) where that matters.
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+var (
+	// ErrMissingToken is returned when the request has no bearer token
+	ErrMissingToken = errors.New("missing bearer token")
+	// ErrInvalidToken is returned when the token is malformed, has a wrong signature or fails the claims validation
+	ErrInvalidToken = errors.New("invalid access token")
+	// ErrTokenExpired is returned when the token is expired
+	ErrTokenExpired = errors.New("access token expired")
+	// ErrSessionNotAlive must be returned by Config.CheckSession when the session is expired, logged out or revoked
+	ErrSessionNotAlive = errors.New("session is not alive")
+	// ErrKeyRequired is returned by New without Config.Key
+	ErrKeyRequired = errors.New("the shared key is required")
+)
+
+// SessionCheck checks that the session of a verified token is still alive. It must return an error wrapping
+// ErrSessionNotAlive if the session is gone, other errors are treated as a failure of the check itself.
+type SessionCheck func(ctx context.Context, token string, claims *Claims) error
+
+// Config of the Verifier. Key is required
+type Config struct {
+	// Key is the shared signing key, the AUTH_JWT_KEY of the auth service
+	Key string
+	// KeyID is the AUTH_JWT_KEY_ID of the auth service. Tokens with another `kid` are only accepted with PreviousKeys
+	KeyID string
+	// PreviousKeys are the AUTH_JWT_PREVIOUS_KEYS of the auth service by their IDs
+	PreviousKeys map[string]string
+
+	// Issuer must match the `iss` claim. `medods-auth` by default
+	Issuer string
+	// Audiences are accepted in the `aud` claim, the token must be issued for at least one of them. `medods` by default
+	Audiences []string
+	// Leeway is the allowed clock skew for the time claims
+	Leeway time.Duration
+
+	// CheckSession is called after the token is verified, nil skips the check
+	CheckSession SessionCheck
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+}
+
+// Claims of a verified access token
+type Claims struct {
+	// GUID of the authenticated user
+	GUID string
+	// AuthID is the ID of the session
+	AuthID uuid.UUID
+	// AMR lists the authentication methods the session was created with
+	AMR []string
+	// ACR is the assurance level of the session, `aal1` or `aal2` if it was created with MFA
+	ACR string
+	// Roles of the user at the time the token was issued
+	Roles []string
+	// Scopes granted by the roles
+	Scopes []string
+	// ExpiresAt is when the token expires
+	ExpiresAt time.Time
+}
+
+// HasScopes reports whether the token has all the given scopes
+func (c *Claims) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Verifier verifies access tokens. It's safe for concurrent use
+type Verifier struct {
+	jwtConfig    tokens.JWTConfig
+	checkSession SessionCheck
+	clock        clockFunc
+}
+
+// clockFunc adapts Config.Now to tokens.Clock
+type clockFunc func() time.Time
+
+func (f clockFunc) Now() time.Time {
+	return f()
+}
+
+// New creates a Verifier
+func New(cfg Config) (*Verifier, error) {
+	if cfg.Key == "" {
+		return nil, ErrKeyRequired
+	}
+
+	issuer := cfg.Issuer
+	if issuer == "" {
+		issuer = "medods-auth"
+	}
+	audiences := cfg.Audiences
+	if len(audiences) == 0 {
+		audiences = []string{"medods"}
+	}
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Verifier{
+		jwtConfig: tokens.JWTConfig{
+			Key:              cfg.Key,
+			KeyID:            cfg.KeyID,
+			PreviousKeys:     cfg.PreviousKeys,
+			Issuer:           issuer,
+			AllowedAudiences: audiences,
+			Leeway:           cfg.Leeway,
+		},
+		checkSession: cfg.CheckSession,
+		clock:        now,
+	}, nil
+}
+
+// Verify checks the access token and, if Config.CheckSession is set, that its session is alive.
+//
+// Returns:
+//   - ErrTokenExpired if the token is expired
+//   - ErrInvalidToken if the token is malformed, has a wrong signature or fails the claims validation
+//   - the error of Config.CheckSession
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parsed, err := tokens.ParseAccessToken(token, v.jwtConfig, v.clock)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims := &Claims{
+		GUID:   parsed.Guid,
+		AuthID: parsed.AuthId,
+		AMR:    parsed.AMR,
+		ACR:    parsed.ACR,
+		Roles:  parsed.Roles,
+		Scopes: parsed.Scopes(),
+	}
+	if parsed.ExpiresAt != nil {
+		claims.ExpiresAt = parsed.ExpiresAt.Time
+	}
+
+	if v.checkSession != nil {
+		if err := v.checkSession(ctx, token, claims); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+type claimsKey struct{}
+
+// WithClaims returns a copy of ctx with the claims, e.g. to test handlers that use ClaimsFromContext
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims put into the request context by the middleware
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// GUID returns the GUID of the authenticated user, or an empty string outside the middleware
+func GUID(ctx context.Context) string {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims.GUID
+	}
+	return ""
+}
+
+// AuthID returns the ID of the session, or uuid.Nil outside the middleware
+func AuthID(ctx context.Context) uuid.UUID {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims.AuthID
+	}
+	return uuid.Nil
+}
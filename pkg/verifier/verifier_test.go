@@ -0,0 +1,186 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kwinso/medods-test-task/internal/api"
+	"github.com/kwinso/medods-test-task/internal/tokens"
+)
+
+const testKey = "verifier-test-key"
+
+var testGUID = uuid.NewString()
+
+// issue generates an access token the way the auth service does with the default issuer and audience
+func issue(t *testing.T, key string, now time.Time) (string, uuid.UUID) {
+	t.Helper()
+
+	authID := uuid.New()
+	token, err := tokens.GenerateAccessToken(tokens.AccessTokenParams{
+		Guid:   testGUID,
+		AuthId: authID,
+		ACR:    tokens.ACRSingleFactor,
+		Scopes: []string{"reports:read"},
+	}, tokens.JWTConfig{
+		Key:      key,
+		KeyID:    "current",
+		TTL:      5 * time.Minute,
+		Issuer:   "medods-auth",
+		Audience: []string{"medods"},
+	}, fixedClock(now), tokens.NewSystemEntropy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, authID
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// serve sends the request with the token through the middleware. The handler responds with the GUID from the context
+func serve(t *testing.T, v *Verifier, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	handler := v.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(GUID(r.Context())))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func assertProblem(t *testing.T, w *httptest.ResponseRecorder, expectedStatus int, expectedCode string) {
+	t.Helper()
+
+	var problem api.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != expectedStatus || problem.Code != expectedCode {
+		t.Errorf("expected %d %s, got %d %s", expectedStatus, expectedCode, w.Code, problem.Code)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	now := time.Now()
+	v, err := New(Config{Key: testKey, KeyID: "current", Now: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := issue(t, testKey, now)
+
+	w := serve(t, v, token)
+	if w.Code != http.StatusOK || w.Body.String() != testGUID {
+		t.Errorf("expected the GUID in the context, got %d %s", w.Code, w.Body)
+	}
+
+	assertProblem(t, serve(t, v, ""), http.StatusUnauthorized, api.CodeMissingAccessToken)
+
+	forged, _ := issue(t, "another-key", now)
+	assertProblem(t, serve(t, v, forged), http.StatusUnauthorized, api.CodeInvalidAccessToken)
+
+	expired, _ := issue(t, testKey, now.Add(-time.Hour))
+	assertProblem(t, serve(t, v, expired), http.StatusUnauthorized, api.CodeSessionExpired)
+}
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	v, err := New(Config{Key: testKey, KeyID: "current"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, authID := issue(t, testKey, time.Now())
+
+	router := gin.New()
+	router.GET("/reports", v.Gin(), func(c *gin.Context) {
+		claims, ok := ClaimsFromContext(c.Request.Context())
+		if !ok || claims.AuthID != authID || !claims.HasScopes("reports:read") {
+			t.Errorf("expected the claims of the session %s, got %+v", authID, claims)
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/reports", nil))
+	assertProblem(t, w, http.StatusUnauthorized, api.CodeMissingAccessToken)
+}
+
+func TestCheckSession(t *testing.T) {
+	var checkErr error
+	v, err := New(Config{Key: testKey, KeyID: "current", CheckSession: func(_ context.Context, _ string, claims *Claims) error {
+		if claims.GUID != testGUID {
+			t.Errorf("expected the claims of %s, got %+v", testGUID, claims)
+		}
+		return checkErr
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := issue(t, testKey, time.Now())
+
+	if w := serve(t, v, token); w.Code != http.StatusOK {
+		t.Errorf("expected 200 for a live session, got %d", w.Code)
+	}
+
+	checkErr = ErrSessionNotAlive
+	assertProblem(t, serve(t, v, token), http.StatusUnauthorized, api.CodeSessionExpired)
+
+	checkErr = errors.New("auth service is down")
+	assertProblem(t, serve(t, v, token), http.StatusInternalServerError, api.CodeInternalError)
+}
+
+func TestHTTPSessionCheck(t *testing.T) {
+	token, _ := issue(t, testKey, time.Now())
+	loggedOut := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/me" || r.Header.Get("Authorization") != "Bearer "+token || loggedOut {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	check, err := HTTPSessionCheck(server.URL, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := New(Config{Key: testKey, KeyID: "current", CheckSession: check})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+
+	loggedOut = true
+	if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrSessionNotAlive) {
+		t.Errorf("expected %v, got %v", ErrSessionNotAlive, err)
+	}
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS credentials;
\ No newline at end of file
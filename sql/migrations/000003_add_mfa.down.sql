@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS totp_secrets;
+
+ALTER TABLE auths
+  DROP COLUMN IF EXISTS amr,
+  DROP COLUMN IF EXISTS acr;
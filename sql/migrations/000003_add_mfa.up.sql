@@ -0,0 +1,20 @@
+ALTER TABLE auths
+  ADD COLUMN amr TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN acr VARCHAR(16) NOT NULL DEFAULT 'aal1';
+
+CREATE TABLE
+  totp_secrets (
+    guid VARCHAR(36) PRIMARY KEY,
+    secret VARCHAR(128) NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+  );
+
+CREATE TABLE
+  recovery_codes (
+    guid VARCHAR(36) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    PRIMARY KEY (guid, code_hash)
+  );
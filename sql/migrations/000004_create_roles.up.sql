@@ -0,0 +1,16 @@
+CREATE TABLE
+  roles (
+    name VARCHAR(64) PRIMARY KEY,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+  );
+
+CREATE TABLE
+  user_roles (
+    guid VARCHAR(36) NOT NULL,
+    role VARCHAR(64) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (guid, role)
+  );
+
+INSERT INTO roles (name, scopes) VALUES ('admin', '{auth:admin}');
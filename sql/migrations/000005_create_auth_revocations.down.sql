@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS auth_revocations_notify ON auth_revocations;
+DROP FUNCTION IF EXISTS notify_auth_revocation;
+DROP TABLE IF EXISTS auth_revocations;
@@ -0,0 +1,16 @@
+CREATE TABLE
+  auth_revocations (
+    auth_id UUID PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+  );
+
+CREATE FUNCTION notify_auth_revocation () RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('auth_revocations', NEW.auth_id::TEXT);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auth_revocations_notify
+AFTER INSERT OR UPDATE ON auth_revocations
+FOR EACH ROW EXECUTE FUNCTION notify_auth_revocation ();
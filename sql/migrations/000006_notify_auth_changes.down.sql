@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS auths_notify_change ON auths;
+DROP FUNCTION IF EXISTS notify_auth_change;
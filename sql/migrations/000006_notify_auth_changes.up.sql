@@ -0,0 +1,10 @@
+CREATE FUNCTION notify_auth_change () RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('auth_changes', OLD.id::TEXT);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auths_notify_change
+AFTER UPDATE OR DELETE ON auths
+FOR EACH ROW EXECUTE FUNCTION notify_auth_change ();
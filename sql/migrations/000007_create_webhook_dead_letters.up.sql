@@ -0,0 +1,10 @@
+CREATE TABLE
+  webhook_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    guid VARCHAR(36) NOT NULL,
+    auth_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    error TEXT NOT NULL,
+    attempts INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+  );
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS mfa_challenges;
+ALTER TABLE totp_secrets
+  DROP COLUMN IF EXISTS attempts,
+  DROP COLUMN IF EXISTS locked_until;
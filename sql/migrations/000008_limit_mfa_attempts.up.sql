@@ -0,0 +1,12 @@
+ALTER TABLE totp_secrets
+  ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+  ADD COLUMN locked_until TIMESTAMPTZ;
+
+CREATE TABLE
+  mfa_challenges (
+    id UUID PRIMARY KEY,
+    guid VARCHAR(36) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    consumed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL
+  );
@@ -0,0 +1,6 @@
+CREATE TABLE
+  login_attempts (
+    subject VARCHAR(300) PRIMARY KEY,
+    attempts INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ
+  );
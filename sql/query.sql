@@ -2,16 +2,161 @@
 
 -- name: CreateAuth :one
 INSERT INTO auths 
-  (id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at)
+  (id, guid, refresh_token_hash, ip_address, user_agent, refreshed_at, amr, acr)
 VALUES 
-  ($1, $2, $3, $4, $5, $6)
+  ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING *;
 
 -- name: GetAuthById :one
 SELECT * FROM auths WHERE id = $1;
 
--- name: UpdateAuthRefreshToken :exec
-UPDATE auths SET refresh_token_hash = $1, refreshed_at = NOW() WHERE id = $2;
+-- name: UpdateAuthRefreshToken :execrows
+UPDATE auths SET refresh_token_hash = @refresh_token_hash, refreshed_at = @refreshed_at
+WHERE id = @id AND refresh_token_hash = @old_refresh_token_hash;
 
 -- name: DeleteAuthById :exec
-DELETE FROM auths WHERE id = $1;
\ No newline at end of file
+DELETE FROM auths WHERE id = $1;
+
+-- name: ListAuthsByGuid :many
+SELECT * FROM auths WHERE guid = $1 ORDER BY created_at;
+
+-- name: DeleteAuthsByGuid :many
+DELETE FROM auths WHERE guid = $1 RETURNING id;
+
+-- name: CountAuthsRefreshedSince :one
+SELECT COUNT(*) FROM auths WHERE refreshed_at > $1;
+
+-- name: CreateCredentials :one
+INSERT INTO credentials
+  (guid, username, password_hash)
+VALUES
+  ($1, $2, $3)
+RETURNING *;
+
+-- name: GetCredentialsByUsername :one
+SELECT * FROM credentials WHERE username = $1;
+
+-- name: GetCredentialsByGuid :one
+SELECT * FROM credentials WHERE guid = $1;
+
+-- name: UpdateCredentialsPasswordHash :exec
+UPDATE credentials SET password_hash = $1, updated_at = NOW() WHERE guid = $2;
+
+-- name: UpsertUnconfirmedTotpSecret :execrows
+INSERT INTO totp_secrets
+  (guid, secret)
+VALUES
+  ($1, $2)
+ON CONFLICT (guid) DO UPDATE
+  SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+  WHERE totp_secrets.confirmed_at IS NULL;
+
+-- name: GetTotpSecret :one
+SELECT * FROM totp_secrets WHERE guid = $1;
+
+-- name: ConfirmTotpSecret :exec
+UPDATE totp_secrets SET confirmed_at = NOW() WHERE guid = $1;
+
+-- name: UpdateTotpLastUsedStep :execrows
+UPDATE totp_secrets SET last_used_step = $2 WHERE guid = $1 AND last_used_step < $2;
+
+-- name: DeleteTotpSecret :exec
+DELETE FROM totp_secrets WHERE guid = $1;
+
+-- name: StartLoginAttempt :execrows
+INSERT INTO login_attempts
+  (subject, attempts, locked_until)
+VALUES
+  (@subject, 1, CASE WHEN @max_attempts::INT <= 1 THEN @locked_until::TIMESTAMPTZ END)
+ON CONFLICT (subject) DO UPDATE
+  SET
+    attempts = login_attempts.attempts + 1,
+    locked_until = CASE WHEN login_attempts.attempts + 1 >= @max_attempts::INT THEN @locked_until::TIMESTAMPTZ END
+  WHERE login_attempts.locked_until IS NULL OR login_attempts.locked_until <= @now::TIMESTAMPTZ;
+
+-- name: DeleteLoginAttempts :exec
+DELETE FROM login_attempts WHERE subject = $1;
+
+-- name: StartTotpAttempt :execrows
+UPDATE totp_secrets SET
+  attempts = attempts + 1,
+  locked_until = CASE WHEN attempts + 1 >= @max_attempts::INT THEN @locked_until::TIMESTAMPTZ ELSE NULL END
+WHERE guid = @guid AND (locked_until IS NULL OR locked_until <= @now::TIMESTAMPTZ);
+
+-- name: ResetTotpAttempts :exec
+UPDATE totp_secrets SET attempts = 0, locked_until = NULL WHERE guid = $1;
+
+-- name: StartMfaChallengeAttempt :execrows
+INSERT INTO mfa_challenges
+  (id, guid, attempts, expires_at)
+VALUES
+  (@id, @guid, 1, @expires_at)
+ON CONFLICT (id) DO UPDATE
+  SET attempts = mfa_challenges.attempts + 1
+  WHERE mfa_challenges.consumed_at IS NULL AND mfa_challenges.attempts < @max_attempts::INT;
+
+-- name: ConsumeMfaChallenge :execrows
+UPDATE mfa_challenges SET consumed_at = NOW() WHERE id = $1 AND consumed_at IS NULL;
+
+-- name: DeleteExpiredMfaChallenges :exec
+DELETE FROM mfa_challenges WHERE expires_at <= NOW();
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (guid, code_hash) VALUES ($1, $2);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE guid = $1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes SET used_at = NOW() WHERE guid = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: UpsertRole :one
+INSERT INTO roles
+  (name, scopes)
+VALUES
+  ($1, $2)
+ON CONFLICT (name) DO UPDATE SET scopes = EXCLUDED.scopes
+RETURNING *;
+
+-- name: ListRoles :many
+SELECT * FROM roles ORDER BY name;
+
+-- name: DeleteRole :execrows
+DELETE FROM roles WHERE name = $1;
+
+-- name: AssignRole :exec
+INSERT INTO user_roles (guid, role) VALUES ($1, $2) ON CONFLICT DO NOTHING;
+
+-- name: UnassignRole :execrows
+DELETE FROM user_roles WHERE guid = $1 AND role = $2;
+
+-- name: ListRolesByGuid :many
+SELECT roles.* FROM roles
+  JOIN user_roles ON user_roles.role = roles.name
+WHERE user_roles.guid = $1
+ORDER BY roles.name;
+
+-- name: CreateAuthRevocation :exec
+INSERT INTO auth_revocations
+  (auth_id, expires_at)
+VALUES
+  ($1, $2)
+ON CONFLICT (auth_id) DO UPDATE SET expires_at = EXCLUDED.expires_at;
+
+-- name: ListActiveAuthRevocations :many
+SELECT * FROM auth_revocations WHERE expires_at > NOW();
+
+-- name: DeleteExpiredAuthRevocations :exec
+DELETE FROM auth_revocations WHERE expires_at <= NOW();
+
+-- name: CreateWebhookDeadLetter :exec
+INSERT INTO webhook_dead_letters
+  (guid, auth_id, payload, error, attempts)
+VALUES
+  ($1, $2, $3, $4, $5);
+
+-- name: ListWebhookDeadLetters :many
+SELECT * FROM webhook_dead_letters ORDER BY id LIMIT $1;
+
+-- name: DeleteWebhookDeadLetter :exec
+DELETE FROM webhook_dead_letters WHERE id = $1;
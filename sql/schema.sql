@@ -6,5 +6,106 @@ CREATE TABLE
     ip_address INET NOT NULL,
     user_agent TEXT NOT NULL,
     refreshed_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    amr TEXT[] NOT NULL DEFAULT '{}',
+    acr VARCHAR(16) NOT NULL DEFAULT 'aal1'
+  );
+
+CREATE TABLE
+  credentials (
+    guid VARCHAR(36) PRIMARY KEY,
+    username VARCHAR(255) NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
+  );
+
+
+CREATE TABLE
+  totp_secrets (
+    guid VARCHAR(36) PRIMARY KEY,
+    secret VARCHAR(128) NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    attempts INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ
+  );
+
+CREATE TABLE
+  recovery_codes (
+    guid VARCHAR(36) NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMPTZ,
+    PRIMARY KEY (guid, code_hash)
+  );
+
+CREATE TABLE
+  roles (
+    name VARCHAR(64) PRIMARY KEY,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW ()
-  );
\ No newline at end of file
+  );
+
+CREATE TABLE
+  user_roles (
+    guid VARCHAR(36) NOT NULL,
+    role VARCHAR(64) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (guid, role)
+  );
+
+CREATE TABLE
+  auth_revocations (
+    auth_id UUID PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+  );
+
+CREATE FUNCTION notify_auth_revocation () RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('auth_revocations', NEW.auth_id::TEXT);
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auth_revocations_notify
+AFTER INSERT OR UPDATE ON auth_revocations
+FOR EACH ROW EXECUTE FUNCTION notify_auth_revocation ();
+
+CREATE FUNCTION notify_auth_change () RETURNS TRIGGER AS $$
+BEGIN
+  PERFORM pg_notify('auth_changes', OLD.id::TEXT);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER auths_notify_change
+AFTER UPDATE OR DELETE ON auths
+FOR EACH ROW EXECUTE FUNCTION notify_auth_change ();
+
+CREATE TABLE
+  webhook_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    guid VARCHAR(36) NOT NULL,
+    auth_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    error TEXT NOT NULL,
+    attempts INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+  );
+
+CREATE TABLE
+  mfa_challenges (
+    id UUID PRIMARY KEY,
+    guid VARCHAR(36) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    consumed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL
+  );
+
+CREATE TABLE
+  login_attempts (
+    subject VARCHAR(300) PRIMARY KEY,
+    attempts INT NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ
+  );